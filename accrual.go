@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// AccrualMethod selects how flat interest is recognised over the life of a loan
+type AccrualMethod string
+
+const (
+	// AccrualStraightLine recognises the same amount of interest every day
+	AccrualStraightLine AccrualMethod = "straight_line"
+
+	// AccrualEffectiveInterest recognises interest on the carrying amount at the
+	// loan's implied weekly rate, so more interest is earned early in the term
+	AccrualEffectiveInterest AccrualMethod = "effective_interest"
+)
+
+// ParseAccrualMethod validates an accrual method name
+func ParseAccrualMethod(s string) (AccrualMethod, error) {
+	switch AccrualMethod(s) {
+	case AccrualStraightLine, AccrualEffectiveInterest:
+		return AccrualMethod(s), nil
+	}
+	return "", fmt.Errorf("unknown accrual method %q", s)
+}
+
+// InterestAccrual is the interest income recognised for one loan on one day
+type InterestAccrual struct {
+	LoanID string        `json:"loan_id"`
+	Date   time.Time     `json:"date"`
+	Amount int64         `json:"amount"`
+	Method AccrualMethod `json:"method"`
+}
+
+// InterestSummary compares recognised and collected interest
+type InterestSummary struct {
+	TotalInterest     int64      `json:"total_interest"`
+	AccruedInterest   int64      `json:"accrued_interest"`
+	CollectedInterest int64      `json:"collected_interest"`
+	AccruedThrough    *time.Time `json:"accrued_through,omitempty"`
+}
+
+// TotalInterest returns the interest charged over the whole schedule
+func (l *Loan) TotalInterest() int64 {
+	total := int64(0)
+	for _, week := range l.Schedule {
+		total += week.Amount
+	}
+	return total - l.Principal
+}
+
+// CollectedInterest returns the interest portion of the weeks paid so far
+func (l *Loan) CollectedInterest() int64 {
+	collected := int64(0)
+	for i, week := range l.Schedule {
+		if week.Paid {
+			_, interest := l.InstallmentSplit(i + 1)
+			collected += interest
+		}
+	}
+	return collected
+}
+
+// termDays returns the number of days over which interest is recognised,
+// from the start date up to the due date of the last week
+func (l *Loan) termDays() int {
+	if len(l.Schedule) == 0 {
+		return 0
+	}
+	return daysBetween(l.StartDate, l.Schedule[len(l.Schedule)-1].DueDate)
+}
+
+// RecognizedInterestThrough returns the cumulative interest that should have
+// been recognised by the end of the given day under the chosen method.
+// Days are counted in the loan's time zone. A refinanced loan recognises all
+// remaining interest on the refinance date.
+func (l *Loan) RecognizedInterestThrough(day time.Time, method AccrualMethod) int64 {
+	if day.Before(l.StartDate) {
+		return 0
+	}
+
+	elapsed := daysBetween(l.StartDate, day) + 1
+	term := l.termDays()
+	total := l.TotalInterest()
+	if elapsed >= term {
+		return total
+	}
+	if l.RefinancedAt != nil && !day.Before(dayStart(l.RefinancedAt.In(l.Location()))) {
+		return total
+	}
+
+	if method == AccrualEffectiveInterest {
+		return l.effectiveInterestThrough(elapsed)
+	}
+	return total * int64(elapsed) / int64(term)
+}
+
+// effectiveInterestThrough recognises interest on the opening carrying amount of
+// each seven-day period at the weekly rate that discounts the schedule back to
+// Principal. Installments reduce the carrying amount at the end of the period
+// they fall due in, and interest within a period is spread evenly across its days.
+func (l *Loan) effectiveInterestThrough(elapsedDays int) int64 {
+	rate := l.weeklyEffectiveRate()
+	balance := float64(l.Principal)
+	recognized := 0.0
+
+	next := 0
+	fullWeeks := elapsedDays / 7
+	for k := 0; k < fullWeeks; k++ {
+		interest := balance * rate
+		recognized += interest
+		balance += interest
+
+		periodEnd := l.StartDate.AddDate(0, 0, 7*(k+1))
+		for ; next < len(l.Schedule) && !l.Schedule[next].DueDate.After(periodEnd); next++ {
+			balance -= float64(l.Schedule[next].Amount)
+		}
+	}
+	if partial := elapsedDays % 7; partial > 0 {
+		recognized += balance * rate * float64(partial) / 7
+	}
+
+	return int64(math.Round(recognized))
+}
+
+// weeklyEffectiveRate solves PV(schedule, r) = Principal for r by bisection
+func (l *Loan) weeklyEffectiveRate() float64 {
+	if l.TotalInterest() <= 0 {
+		return 0
+	}
+
+	presentValue := func(rate float64) float64 {
+		pv := 0.0
+		for _, week := range l.Schedule {
+			weeks := float64(daysBetween(l.StartDate, week.DueDate)) / 7
+			pv += float64(week.Amount) / math.Pow(1+rate, weeks)
+		}
+		return pv
+	}
+
+	low, high := 0.0, 1.0
+	for i := 0; i < 100; i++ {
+		mid := (low + high) / 2
+		if presentValue(mid) > float64(l.Principal) {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2
+}
+
+// AccrueInterest returns the daily accruals for each day after alreadyThrough
+// up to and including the calendar date of asOf, stopping the day before a
+// write-off. Days are the loan's local calendar days. accrued is the interest
+// recognised so far; each day books the difference between the target
+// cumulative amount and what has already been recognised, so changes to the
+// schedule are picked up prospectively.
+func (l *Loan) AccrueInterest(accrued int64, alreadyThrough *time.Time, asOf time.Time, method AccrualMethod) []InterestAccrual {
+	loc := l.Location()
+	day := dayStart(l.StartDate)
+	if alreadyThrough != nil {
+		day = dayStart(alreadyThrough.In(loc)).AddDate(0, 0, 1)
+	}
+	last := dayStart(l.StartDate).AddDate(0, 0, l.termDays()-1)
+	if y, m, d := asOf.Date(); time.Date(y, m, d, 0, 0, 0, 0, loc).Before(last) {
+		last = time.Date(y, m, d, 0, 0, 0, 0, loc)
+	}
+	// Interest stops accruing once the loan is written off
+	if l.WrittenOffAt != nil {
+		if stop := dayStart(l.WrittenOffAt.In(loc)).AddDate(0, 0, -1); stop.Before(last) {
+			last = stop
+		}
+	}
+
+	var accruals []InterestAccrual
+	for ; !day.After(last); day = day.AddDate(0, 0, 1) {
+		amount := l.RecognizedInterestThrough(day, method) - accrued
+		if amount <= 0 {
+			continue
+		}
+		accruals = append(accruals, InterestAccrual{
+			LoanID: l.ID,
+			Date:   day,
+			Amount: amount,
+			Method: method,
+		})
+		accrued += amount
+	}
+	return accruals
+}
+
+// SummarizeInterest compares the stored accruals of a loan with the interest collected
+func SummarizeInterest(loan *Loan, accruals []InterestAccrual) InterestSummary {
+	summary := InterestSummary{
+		TotalInterest:     loan.TotalInterest(),
+		CollectedInterest: loan.CollectedInterest(),
+	}
+	for i := range accruals {
+		summary.AccruedInterest += accruals[i].Amount
+		if summary.AccruedThrough == nil || accruals[i].Date.After(*summary.AccruedThrough) {
+			summary.AccruedThrough = &accruals[i].Date
+		}
+	}
+	return summary
+}
+
+// AccrualEntry books interest recognised on a loan during one accrual run
+func AccrualEntry(loanID string, accruals []InterestAccrual, asOf time.Time, chart ChartOfAccounts) *JournalEntry {
+	total := int64(0)
+	for _, accrual := range accruals {
+		total += accrual.Amount
+	}
+
+	return &JournalEntry{
+		ID:       fmt.Sprintf("je_%s_accrual_%s", loanID, asOf.Format("20060102")),
+		LoanID:   loanID,
+		Event:    JournalEventAccrual,
+		PostedAt: dayStart(asOf),
+		Lines: []JournalLine{
+			{Account: chart.InterestReceivable, Debit: total},
+			{Account: chart.InterestIncome, Credit: total},
+		},
+	}
+}
+
+// AccrualRunResult summarises one run of the accrual job
+type AccrualRunResult struct {
+	LoansProcessed int   `json:"loans_processed"`
+	LoansAccrued   int   `json:"loans_accrued"`
+	Accrued        int64 `json:"accrued"`
+}
+
+// RunInterestAccrual accrues interest for every loan through asOf, persisting
+// the daily accrual records and booking one journal entry per loan. Each
+// loan's records and entry are written in one unit of work, so a failed
+// posting leaves the period to be accrued again on the next run.
+func RunInterestAccrual(ctx context.Context, repo LoanRepository, chart ChartOfAccounts, method AccrualMethod, asOf time.Time) (AccrualRunResult, error) {
+	var result AccrualRunResult
+
+	loans, err := repo.List(ctx, LoanFilter{})
+	if err != nil {
+		return result, err
+	}
+
+	for _, summary := range loans {
+		var entry *JournalEntry
+		err := repo.WithTx(ctx, func(tx LoanRepository) error {
+			loan, err := tx.GetByID(ctx, summary.ID)
+			if err != nil {
+				return err
+			}
+
+			existing, err := tx.ListAccruals(ctx, loan.ID)
+			if err != nil {
+				return err
+			}
+			status := SummarizeInterest(loan, existing)
+
+			accruals := loan.AccrueInterest(status.AccruedInterest, status.AccruedThrough, asOf, method)
+			if len(accruals) == 0 {
+				return nil
+			}
+
+			if err := tx.SaveAccruals(ctx, accruals); err != nil {
+				return err
+			}
+			booked := AccrualEntry(loan.ID, accruals, asOf, chart)
+			if err := tx.PostJournalEntry(ctx, booked); err != nil {
+				return err
+			}
+			entry = booked
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+
+		result.LoansProcessed++
+		if entry != nil {
+			result.LoansAccrued++
+			result.Accrued += entry.Lines[0].Debit
+		}
+	}
+
+	return result, nil
+}
+
+// dayStart truncates t to midnight of its calendar day in t's location
+func dayStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
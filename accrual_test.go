@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRecognizedInterestThrough(t *testing.T) {
+	startDate := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	loan, err := NewLoan("test", 5_000_000, 0.10, startDate)
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		day      time.Time
+		method   AccrualMethod
+		expected int64
+	}{
+		{name: "before start", day: startDate.AddDate(0, 0, -1), method: AccrualStraightLine, expected: 0},
+		{name: "straight line first day", day: startDate, method: AccrualStraightLine, expected: 1_428},
+		{name: "straight line one week", day: startDate.AddDate(0, 0, 6), method: AccrualStraightLine, expected: 10_000},
+		{name: "straight line maturity", day: startDate.AddDate(0, 0, 349), method: AccrualStraightLine, expected: 500_000},
+		{name: "straight line after maturity", day: startDate.AddDate(1, 0, 0), method: AccrualStraightLine, expected: 500_000},
+		{name: "effective interest maturity", day: startDate.AddDate(0, 0, 349), method: AccrualEffectiveInterest, expected: 500_000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loan.RecognizedInterestThrough(tt.day, tt.method); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+
+	// Effective interest is front-loaded: more than half is earned by mid-term
+	// and the cumulative amount never decreases
+	midTerm := startDate.AddDate(0, 0, 174)
+	if got := loan.RecognizedInterestThrough(midTerm, AccrualEffectiveInterest); got <= 250_000 {
+		t.Errorf("expected effective interest above 250000 at mid-term, got %d", got)
+	}
+	previous := int64(0)
+	for day := startDate; day.Before(startDate.AddDate(0, 0, 350)); day = day.AddDate(0, 0, 1) {
+		got := loan.RecognizedInterestThrough(day, AccrualEffectiveInterest)
+		if got < previous {
+			t.Fatalf("effective interest decreased on %s: %d < %d", day.Format("2006-01-02"), got, previous)
+		}
+		previous = got
+	}
+}
+
+func TestAccrueInterest(t *testing.T) {
+	startDate := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	loan, err := NewLoan("test", 5_000_000, 0.10, startDate)
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+
+	for _, method := range []AccrualMethod{AccrualStraightLine, AccrualEffectiveInterest} {
+		t.Run(string(method), func(t *testing.T) {
+			// Accrue in two runs and make sure they add up to the whole interest
+			first := loan.AccrueInterest(0, nil, startDate.AddDate(0, 0, 99), method)
+			var accrued int64
+			for _, accrual := range first {
+				if accrual.Amount <= 0 {
+					t.Fatalf("non-positive accrual %+v", accrual)
+				}
+				accrued += accrual.Amount
+			}
+			through := first[len(first)-1].Date
+			if !through.Equal(startDate.AddDate(0, 0, 99)) {
+				t.Errorf("expected first run through day 99, got %s", through.Format("2006-01-02"))
+			}
+
+			// Re-running for the same day accrues nothing
+			if again := loan.AccrueInterest(accrued, &through, through, method); len(again) != 0 {
+				t.Errorf("expected no accruals on re-run, got %d", len(again))
+			}
+
+			// Running far past maturity stops at the last day of the term
+			second := loan.AccrueInterest(accrued, &through, startDate.AddDate(2, 0, 0), method)
+			for _, accrual := range second {
+				accrued += accrual.Amount
+			}
+			last := second[len(second)-1].Date
+			if !last.Equal(startDate.AddDate(0, 0, 349)) {
+				t.Errorf("expected last accrual on day 349, got %s", last.Format("2006-01-02"))
+			}
+			if accrued != loan.TotalInterest() {
+				t.Errorf("expected total accrued %d, got %d", loan.TotalInterest(), accrued)
+			}
+		})
+	}
+}
+
+func TestRunInterestAccrual(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewSQLiteLoanRepository(db)
+	chart := DefaultChartOfAccounts()
+
+	startDate := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	loan, err := NewLoan("accrual-loan", 5_000_000, 0.10, startDate)
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+	if err := repo.Create(context.Background(), loan); err != nil {
+		t.Fatalf("failed to store loan: %v", err)
+	}
+
+	asOf := startDate.AddDate(0, 0, 6)
+	result, err := RunInterestAccrual(context.Background(), repo, chart, AccrualStraightLine, asOf)
+	if err != nil {
+		t.Fatalf("accrual failed: %v", err)
+	}
+	if result.LoansProcessed != 1 || result.LoansAccrued != 1 || result.Accrued != 10_000 {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	accruals, err := repo.ListAccruals(context.Background(), loan.ID)
+	if err != nil {
+		t.Fatalf("failed to list accruals: %v", err)
+	}
+	if len(accruals) != 7 {
+		t.Errorf("expected 7 daily accruals, got %d", len(accruals))
+	}
+
+	// The run is idempotent for the same as-of date
+	result, err = RunInterestAccrual(context.Background(), repo, chart, AccrualStraightLine, asOf)
+	if err != nil {
+		t.Fatalf("second accrual failed: %v", err)
+	}
+	if result.LoansAccrued != 0 || result.Accrued != 0 {
+		t.Errorf("expected nothing accrued on re-run, got %+v", result)
+	}
+
+	entries, err := repo.ListJournalEntries(context.Background(), startDate, startDate.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("failed to list journal: %v", err)
+	}
+	var accrualEntries int
+	for _, entry := range entries {
+		if entry.Event != JournalEventAccrual {
+			continue
+		}
+		accrualEntries++
+		if entry.Lines[0].Account != chart.InterestReceivable || entry.Lines[1].Account != chart.InterestIncome || entry.Lines[1].Credit != 10_000 {
+			t.Errorf("unexpected accrual entry %+v", entry)
+		}
+	}
+	if accrualEntries != 1 {
+		t.Errorf("expected 1 accrual journal entry, got %d", accrualEntries)
+	}
+}
+
+func TestRunInterestAccrualJournalFailure(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewSQLiteLoanRepository(db)
+	chart := DefaultChartOfAccounts()
+
+	startDate := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	loan, err := NewLoan("accrual-loan", 5_000_000, 0.10, startDate)
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+	if err := repo.Create(context.Background(), loan); err != nil {
+		t.Fatalf("failed to store loan: %v", err)
+	}
+
+	// No accrual is kept when its journal entry cannot be posted
+	asOf := startDate.AddDate(0, 0, 6)
+	if _, err := RunInterestAccrual(context.Background(), failingJournalRepository{repo}, chart, AccrualStraightLine, asOf); !errors.Is(err, errJournalUnavailable) {
+		t.Fatalf("expected the journal failure, got %v", err)
+	}
+	accruals, err := repo.ListAccruals(context.Background(), loan.ID)
+	if err != nil {
+		t.Fatalf("failed to list accruals: %v", err)
+	}
+	if len(accruals) != 0 {
+		t.Errorf("expected no accruals kept, got %d", len(accruals))
+	}
+
+	// The next run accrues the whole period and books it
+	result, err := RunInterestAccrual(context.Background(), repo, chart, AccrualStraightLine, asOf)
+	if err != nil {
+		t.Fatalf("accrual failed: %v", err)
+	}
+	if result.LoansAccrued != 1 || result.Accrued != 10_000 {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestParseAccrualMethod(t *testing.T) {
+	for _, name := range []string{"straight_line", "effective_interest"} {
+		if _, err := ParseAccrualMethod(name); err != nil {
+			t.Errorf("expected %q to be valid: %v", name, err)
+		}
+	}
+	if _, err := ParseAccrualMethod("sum_of_digits"); err == nil {
+		t.Error("expected unknown method to be rejected")
+	}
+}
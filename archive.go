@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// ArchiveRunResult summarises one run of the archival job
+type ArchiveRunResult struct {
+	Before   time.Time `json:"before"`
+	Archived []string  `json:"archived"`
+}
+
+// RunArchive moves every loan paid off more than years before now into the
+// archive tables, where reads no longer see it until it is restored
+func RunArchive(ctx context.Context, repo LoanRepository, years int, now time.Time) (ArchiveRunResult, error) {
+	result := ArchiveRunResult{Before: now.AddDate(-years, 0, 0), Archived: []string{}}
+
+	archived, err := repo.Archive(ctx, result.Before)
+	if err != nil {
+		return result, err
+	}
+	result.Archived = append(result.Archived, archived...)
+	return result, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunArchive(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	clock := NewSimulatedClock(time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC))
+	repo := NewSQLiteLoanRepository(db).WithClock(clock)
+	ctx := context.Background()
+
+	startDate := time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC)
+	var loans []*Loan
+	for _, id := range []string{"paid-2023", "paid-2024", "active-loan"} {
+		loan, err := NewLoan(id, 1_000_000, 0.10, startDate)
+		if err != nil {
+			t.Fatalf("failed to create loan: %v", err)
+		}
+		if err := repo.Create(ctx, loan); err != nil {
+			t.Fatalf("failed to store loan: %v", err)
+		}
+		loans = append(loans, loan)
+	}
+
+	// The first loan is paid off in March 2023, the second in March 2024
+	for _, loan := range loans[:2] {
+		for loan.Status != LoanStatusPaidOff {
+			if err := loan.MakePayment(loan.Schedule[loan.PaidCount].Amount, clock.Now()); err != nil {
+				t.Fatalf("failed to make payment: %v", err)
+			}
+		}
+		if err := repo.Update(ctx, loan); err != nil {
+			t.Fatalf("failed to update loan: %v", err)
+		}
+		clock.Advance(366 * 24 * time.Hour)
+	}
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	result, err := RunArchive(ctx, repo, 3, now)
+	if err != nil {
+		t.Fatalf("archive run failed: %v", err)
+	}
+	if !result.Before.Equal(time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected cutoff 2023-03-01 12:00, got %v", result.Before)
+	}
+	if len(result.Archived) != 1 || result.Archived[0] != "paid-2023" {
+		t.Errorf("expected only paid-2023 archived, got %v", result.Archived)
+	}
+	if _, err := repo.GetByID(ctx, "paid-2023"); err != ErrLoanNotFound {
+		t.Errorf("expected archived loan to be hidden, got %v", err)
+	}
+
+	// Nothing is left to archive on a re-run
+	result, err = RunArchive(ctx, repo, 3, now)
+	if err != nil {
+		t.Fatalf("second archive run failed: %v", err)
+	}
+	if result.Archived == nil || len(result.Archived) != 0 {
+		t.Errorf("expected an empty list on re-run, got %#v", result.Archived)
+	}
+}
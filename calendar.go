@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// BusinessCalendar decides which calendar days are business days
+type BusinessCalendar interface {
+	IsBusinessDay(day time.Time) bool
+}
+
+// HolidayCalendar is a BusinessCalendar made of weekend days and a list of
+// public holidays, typically loaded from a JSON file
+type HolidayCalendar struct {
+	Name     string
+	weekend  map[time.Weekday]bool
+	holidays map[string]string // YYYY-MM-DD -> holiday name
+}
+
+// holidayCalendarFile is the on-disk format of a holiday calendar
+type holidayCalendarFile struct {
+	Name     string   `json:"name"`
+	Weekend  []string `json:"weekend"`
+	Holidays []struct {
+		Date string `json:"date"`
+		Name string `json:"name"`
+	} `json:"holidays"`
+}
+
+// LoadHolidayCalendar reads a JSON holiday calendar from path.
+// The weekend defaults to Saturday and Sunday when the file does not list it.
+func LoadHolidayCalendar(path string) (*HolidayCalendar, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read holiday calendar: %w", err)
+	}
+
+	var file holidayCalendarFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse holiday calendar: %w", err)
+	}
+	if file.Weekend == nil {
+		file.Weekend = []string{"saturday", "sunday"}
+	}
+
+	calendar := &HolidayCalendar{
+		Name:     file.Name,
+		weekend:  make(map[time.Weekday]bool),
+		holidays: make(map[string]string),
+	}
+	for _, name := range file.Weekend {
+		day, ok := parseWeekday(name)
+		if !ok {
+			return nil, fmt.Errorf("failed to parse holiday calendar: unknown weekday %q", name)
+		}
+		calendar.weekend[day] = true
+	}
+	for _, holiday := range file.Holidays {
+		if _, err := time.Parse("2006-01-02", holiday.Date); err != nil {
+			return nil, fmt.Errorf("failed to parse holiday calendar: invalid date %q", holiday.Date)
+		}
+		calendar.holidays[holiday.Date] = holiday.Name
+	}
+	return calendar, nil
+}
+
+// IsBusinessDay reports whether day, taken in its own location, is neither a
+// weekend day nor a holiday
+func (c *HolidayCalendar) IsBusinessDay(day time.Time) bool {
+	if c.weekend[day.Weekday()] {
+		return false
+	}
+	_, holiday := c.holidays[day.Format("2006-01-02")]
+	return !holiday
+}
+
+// parseWeekday parses an English weekday name such as "saturday"
+func parseWeekday(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), name) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// RollConvention says how a due date on a non-business day is moved
+type RollConvention string
+
+const (
+	// RollNone keeps due dates as scheduled
+	RollNone RollConvention = "none"
+
+	// RollFollowing moves a due date to the next business day
+	RollFollowing RollConvention = "following"
+
+	// RollPreceding moves a due date to the previous business day
+	RollPreceding RollConvention = "preceding"
+
+	// RollModifiedFollowing moves a due date to the next business day unless
+	// that falls in the next month, in which case it moves to the previous one
+	RollModifiedFollowing RollConvention = "modified_following"
+)
+
+// ParseRollConvention validates a roll convention name
+func ParseRollConvention(s string) (RollConvention, error) {
+	switch RollConvention(s) {
+	case RollNone, RollFollowing, RollPreceding, RollModifiedFollowing:
+		return RollConvention(s), nil
+	}
+	return "", fmt.Errorf("unknown roll convention %q", s)
+}
+
+// maxRollDays bounds the search for a business day
+const maxRollDays = 31
+
+// DueDatePolicy rolls scheduled due dates that fall on non-business days.
+// The zero value leaves due dates untouched.
+type DueDatePolicy struct {
+	Calendar BusinessCalendar
+	Roll     RollConvention
+}
+
+// Adjust returns the due date for a week scheduled on the given day
+func (p DueDatePolicy) Adjust(scheduled time.Time) time.Time {
+	if p.Calendar == nil || p.Roll == "" || p.Roll == RollNone {
+		return scheduled
+	}
+
+	switch p.Roll {
+	case RollFollowing:
+		return p.roll(scheduled, 1)
+	case RollPreceding:
+		return p.roll(scheduled, -1)
+	case RollModifiedFollowing:
+		following := p.roll(scheduled, 1)
+		if following.Month() != scheduled.Month() {
+			return p.roll(scheduled, -1)
+		}
+		return following
+	}
+	return scheduled
+}
+
+// roll steps day by day in the given direction until a business day is found
+func (p DueDatePolicy) roll(day time.Time, step int) time.Time {
+	for i := 0; i <= maxRollDays; i++ {
+		candidate := day.AddDate(0, 0, i*step)
+		if p.Calendar.IsBusinessDay(candidate) {
+			return candidate
+		}
+	}
+	return day
+}
+
+// ApplyDueDatePolicy sets the due date of every unpaid week from its scheduled
+// date under the given policy. Paid weeks keep the due date they were paid against.
+func (l *Loan) ApplyDueDatePolicy(policy DueDatePolicy) {
+	for i := range l.Schedule {
+		if l.Schedule[i].Paid {
+			continue
+		}
+		l.Schedule[i].DueDate = policy.Adjust(l.Schedule[i].ScheduledDate)
+	}
+}
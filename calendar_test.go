@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadHolidayCalendar(t *testing.T) {
+	calendar, err := LoadHolidayCalendar("calendars/indonesia-2025.json")
+	if err != nil {
+		t.Fatalf("failed to load calendar: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		day      time.Time
+		expected bool
+	}{
+		{name: "regular weekday", day: time.Date(2025, 9, 4, 0, 0, 0, 0, time.UTC), expected: true},
+		{name: "public holiday", day: time.Date(2025, 9, 5, 0, 0, 0, 0, time.UTC), expected: false},
+		{name: "saturday", day: time.Date(2025, 9, 6, 0, 0, 0, 0, time.UTC), expected: false},
+		{name: "sunday", day: time.Date(2025, 9, 7, 0, 0, 0, 0, time.UTC), expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calendar.IsBusinessDay(tt.day); got != tt.expected {
+				t.Errorf("expected business day %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"weekend": ["caturday"]}`), 0o644); err != nil {
+		t.Fatalf("failed to write calendar: %v", err)
+	}
+	if _, err := LoadHolidayCalendar(invalid); err == nil {
+		t.Error("expected error for unknown weekday")
+	}
+	if _, err := LoadHolidayCalendar(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestDueDatePolicyAdjust(t *testing.T) {
+	calendar, err := LoadHolidayCalendar("calendars/indonesia-2025.json")
+	if err != nil {
+		t.Fatalf("failed to load calendar: %v", err)
+	}
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2025, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		roll      RollConvention
+		scheduled time.Time
+		expected  time.Time
+	}{
+		{name: "business day unchanged", roll: RollFollowing, scheduled: date(time.September, 4), expected: date(time.September, 4)},
+		{name: "none", roll: RollNone, scheduled: date(time.September, 5), expected: date(time.September, 5)},
+		{name: "following over holiday and weekend", roll: RollFollowing, scheduled: date(time.September, 5), expected: date(time.September, 8)},
+		{name: "preceding", roll: RollPreceding, scheduled: date(time.September, 5), expected: date(time.September, 4)},
+		{name: "modified following within month", roll: RollModifiedFollowing, scheduled: date(time.August, 17), expected: date(time.August, 18)},
+		{name: "modified following at month end", roll: RollModifiedFollowing, scheduled: date(time.August, 31), expected: date(time.August, 29)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := DueDatePolicy{Calendar: calendar, Roll: tt.roll}
+			if got := policy.Adjust(tt.scheduled); !got.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	// The zero policy never moves dates
+	if got := (DueDatePolicy{}).Adjust(date(time.September, 5)); !got.Equal(date(time.September, 5)) {
+		t.Errorf("expected zero policy to keep the date, got %v", got)
+	}
+}
+
+func TestLoanApplyDueDatePolicy(t *testing.T) {
+	calendar, err := LoadHolidayCalendar("calendars/indonesia-2025.json")
+	if err != nil {
+		t.Fatalf("failed to load calendar: %v", err)
+	}
+	policy := DueDatePolicy{Calendar: calendar, Roll: RollFollowing}
+
+	// Weekly on Fridays; week 5 is scheduled on the 2025-09-05 holiday
+	loan := newPaidLoan(t, 4)
+	loan.ApplyDueDatePolicy(policy)
+
+	week5 := loan.Schedule[4]
+	if !week5.ScheduledDate.Equal(time.Date(2025, 9, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected scheduled date to be kept, got %v", week5.ScheduledDate)
+	}
+	if !week5.DueDate.Equal(time.Date(2025, 9, 8, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected due date rolled to 2025-09-08, got %v", week5.DueDate)
+	}
+
+	// Week 5 is not yet due over the long weekend, so weeks 4 and 5 are the
+	// latest two and week 4 is paid
+	saturday := time.Date(2025, 9, 6, 0, 0, 0, 0, time.UTC)
+	if delinquent, _, _ := loan.IsDelinquent(saturday); delinquent {
+		t.Error("expected rolled due date to postpone delinquency")
+	}
+	if delinquent, _, _ := loan.IsDelinquent(time.Date(2025, 9, 8, 0, 0, 0, 0, time.UTC)); !delinquent {
+		t.Error("expected delinquency once the rolled due date is reached")
+	}
+
+	// Restructured weeks keep the weekly cadence and are rolled again
+	if _, err := loan.Restructure(RestructureOptions{ExtendWeeks: 2, DueDates: policy}, time.Date(2025, 8, 25, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("restructure failed: %v", err)
+	}
+	for _, week := range loan.Schedule[3:] {
+		if week.ScheduledDate.Weekday() != time.Friday {
+			t.Errorf("week %d scheduled on %v, expected a Friday", week.Index, week.ScheduledDate.Weekday())
+		}
+		if !calendar.IsBusinessDay(week.DueDate) {
+			t.Errorf("week %d due on non-business day %v", week.Index, week.DueDate)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -12,6 +12,21 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// openCLIRepository opens the configured backend, or the database at dsn when
+// set, and returns its loan repository with a function that releases it
+func openCLIRepository(dsn string, clock Clock) (LoanRepository, func() error) {
+	dbCfg, err := loadDatabaseConfig()
+	if err != nil {
+		log.Fatalf("Invalid database configuration: %v", err)
+	}
+
+	repo, closeRepo, err := dbCfg.OpenRepository(dsn, clock)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	return repo, closeRepo
+}
+
 func runCLI() {
 	// Skip the "cli" argument
 	args := flag.NewFlagSet("cli", flag.ExitOnError)
@@ -23,7 +38,7 @@ func runCLI() {
 		now       = args.String("now", "", "Current date override (YYYY-MM-DD)")
 		repeat    = args.Int("repeat", 1, "Number of payments to make")
 		verbose   = args.Bool("verbose", false, "Verbose output")
-		dbPath    = args.String("db", "./pinjol.db", "Database path")
+		dbPath    = args.String("db", "", "Database path, or connection URL for PostgreSQL (defaults to the configured database)")
 	)
 	if err := args.Parse(os.Args[2:]); err != nil { // Skip "program" and "cli"
 		log.Fatalf("failed to parse flags: %v", err)
@@ -38,7 +53,8 @@ func runCLI() {
 		log.Fatalf("Invalid start date: %v", err)
 	}
 
-	currentTime := time.Now()
+	clock := loadCLIClock()
+	currentTime := clock.Now()
 	if *now != "" {
 		currentTime, err = time.Parse("2006-01-02", *now)
 		if err != nil {
@@ -46,45 +62,53 @@ func runCLI() {
 		}
 	}
 
-	// Initialize database for CLI
-	db, err := sql.Open("sqlite3", *dbPath)
-	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
-	}
-	defer db.Close()
+	// Initialize database and repository for CLI
+	repo, closeRepo := openCLIRepository(*dbPath, clock)
+	defer closeRepo()
+	ctx := context.Background()
 
-	// Initialize schema
-	if err := InitDatabase(db); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+	chart, err := loadChartOfAccounts()
+	if err != nil {
+		log.Fatalf("Failed to load chart of accounts: %v", err)
 	}
 
-	// Create repository
-	repo := NewSQLiteLoanRepository(db)
-
 	// Create loan
-	loan, err := NewLoan("cli-test", *principal, *rate, start)
+	id, err := NewIDGenerator(clock, nil).NewLoanID()
+	if err != nil {
+		log.Fatalf("Failed to generate loan ID: %v", err)
+	}
+	loan, err := NewLoan(id, *principal, *rate, start)
 	if err != nil {
 		log.Fatalf("Failed to create loan: %v", err)
 	}
 
-	// Save loan to database
-	if err := repo.Create(loan); err != nil {
+	// Save loan and its disbursement to database
+	err = repo.WithTx(ctx, func(tx LoanRepository) error {
+		if err := tx.Create(ctx, loan); err != nil {
+			return fmt.Errorf("save loan: %w", err)
+		}
+		if err := tx.PostJournalEntry(ctx, DisbursementEntry(loan, chart)); err != nil {
+			return fmt.Errorf("record disbursement: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
 		log.Fatalf("Failed to save loan to database: %v", err)
 	}
 
 	switch *scenario {
 	case "ontime":
-		runOntimeScenario(repo, currentTime, *repeat, *verbose)
+		runOntimeScenario(ctx, repo, chart, id, currentTime, *repeat, *verbose)
 	case "skip2":
-		runSkip2Scenario(repo, start, *verbose)
+		runSkip2Scenario(ctx, repo, chart, id, start, *verbose)
 	case "fullpay":
-		runFullPayScenario(repo, currentTime, *verbose)
+		runFullPayScenario(ctx, repo, chart, id, currentTime, *verbose)
 	default:
 		log.Fatalf("Unknown scenario: %s", *scenario)
 	}
 
 	// Get final state from database
-	finalLoan, err := repo.GetByID("cli-test")
+	finalLoan, err := repo.GetByID(ctx, id)
 	if err != nil {
 		log.Fatalf("Failed to get final loan state: %v", err)
 	}
@@ -105,12 +129,12 @@ func runCLI() {
 	fmt.Println(string(output))
 }
 
-func runOntimeScenario(repo LoanRepository, startTime time.Time, repeat int, verbose bool) {
+func runOntimeScenario(ctx context.Context, repo LoanRepository, chart ChartOfAccounts, id string, startTime time.Time, repeat int, verbose bool) {
 	fmt.Println("=== On-time Payment Scenario ===")
 
 	for i := 0; i < repeat && i < 50; i++ {
 		// Get current loan state from database
-		loan, err := repo.GetByID("cli-test")
+		loan, err := repo.GetByID(ctx, id)
 		if err != nil {
 			log.Printf("Failed to get loan for payment %d: %v", i+1, err)
 			break
@@ -126,7 +150,7 @@ func runOntimeScenario(repo LoanRepository, startTime time.Time, repeat int, ver
 		}
 
 		// Save updated loan to database
-		if err := repo.Update(loan); err != nil {
+		if err := recordScenarioPayment(ctx, repo, chart, loan, paymentTime); err != nil {
 			log.Printf("Failed to save payment %d: %v", i+1, err)
 			break
 		}
@@ -141,13 +165,13 @@ func runOntimeScenario(repo LoanRepository, startTime time.Time, repeat int, ver
 	}
 }
 
-func runSkip2Scenario(repo LoanRepository, startDate time.Time, verbose bool) {
+func runSkip2Scenario(ctx context.Context, repo LoanRepository, chart ChartOfAccounts, id string, startDate time.Time, verbose bool) {
 	fmt.Println("=== Skip 2 Weeks Scenario ===")
 
 	// Simulate being 14 days after start (week 3)
 	checkTime := startDate.Add(14 * 24 * time.Hour)
 
-	loan, err := repo.GetByID("cli-test")
+	loan, err := repo.GetByID(ctx, id)
 	if err != nil {
 		log.Fatalf("Failed to get loan: %v", err)
 	}
@@ -164,7 +188,7 @@ func runSkip2Scenario(repo LoanRepository, startDate time.Time, verbose bool) {
 	fmt.Println("Making catch-up payments...")
 	for i := 0; i < 2; i++ {
 		// Get fresh loan state
-		loan, err := repo.GetByID("cli-test")
+		loan, err := repo.GetByID(ctx, id)
 		if err != nil {
 			log.Printf("Failed to get loan for catch-up payment %d: %v", i+1, err)
 			break
@@ -177,7 +201,7 @@ func runSkip2Scenario(repo LoanRepository, startDate time.Time, verbose bool) {
 		}
 
 		// Save updated loan
-		if err := repo.Update(loan); err != nil {
+		if err := recordScenarioPayment(ctx, repo, chart, loan, checkTime); err != nil {
 			log.Printf("Failed to save catch-up payment %d: %v", i+1, err)
 			break
 		}
@@ -188,7 +212,7 @@ func runSkip2Scenario(repo LoanRepository, startDate time.Time, verbose bool) {
 	}
 
 	// Check delinquency again
-	loan, err = repo.GetByID("cli-test")
+	loan, err = repo.GetByID(ctx, id)
 	if err != nil {
 		log.Fatalf("Failed to get final loan state: %v", err)
 	}
@@ -198,13 +222,13 @@ func runSkip2Scenario(repo LoanRepository, startDate time.Time, verbose bool) {
 		delinquent, streak, observedWeek)
 }
 
-func runFullPayScenario(repo LoanRepository, currentTime time.Time, verbose bool) {
+func runFullPayScenario(ctx context.Context, repo LoanRepository, chart ChartOfAccounts, id string, currentTime time.Time, verbose bool) {
 	fmt.Println("=== Full Payment Scenario ===")
 
 	// Pay all 50 weeks
 	for i := 0; i < 50; i++ {
 		// Get current loan state
-		loan, err := repo.GetByID("cli-test")
+		loan, err := repo.GetByID(ctx, id)
 		if err != nil {
 			log.Printf("Failed to get loan for payment %d: %v", i+1, err)
 			break
@@ -217,7 +241,7 @@ func runFullPayScenario(repo LoanRepository, currentTime time.Time, verbose bool
 		}
 
 		// Save updated loan
-		if err := repo.Update(loan); err != nil {
+		if err := recordScenarioPayment(ctx, repo, chart, loan, currentTime); err != nil {
 			log.Printf("Failed to save payment %d: %v", i+1, err)
 			break
 		}
@@ -228,7 +252,7 @@ func runFullPayScenario(repo LoanRepository, currentTime time.Time, verbose bool
 	}
 
 	// Get final state
-	loan, err := repo.GetByID("cli-test")
+	loan, err := repo.GetByID(ctx, id)
 	if err != nil {
 		log.Fatalf("Failed to get final loan state: %v", err)
 	}
@@ -249,3 +273,201 @@ func runFullPayScenario(repo LoanRepository, currentTime time.Time, verbose bool
 		log.Fatal("Extra payment should have been rejected")
 	}
 }
+
+// recordScenarioPayment saves a payment the scenario has made on loan
+// together with its journal entry, so neither is stored without the other
+func recordScenarioPayment(ctx context.Context, repo LoanRepository, chart ChartOfAccounts, loan *Loan, paidAt time.Time) error {
+	return repo.WithTx(ctx, func(tx LoanRepository) error {
+		if err := tx.Update(ctx, loan); err != nil {
+			return err
+		}
+		return tx.PostJournalEntry(ctx, PaymentEntry(loan, loan.PaidCount, paidAt, chart))
+	})
+}
+
+func runJournalExport() {
+	args := flag.NewFlagSet("journal-export", flag.ExitOnError)
+	var (
+		from   = args.String("from", "", "First posting date to export (YYYY-MM-DD)")
+		to     = args.String("to", "", "Last posting date to export (YYYY-MM-DD)")
+		format = args.String("format", "csv", "Output format: csv, json")
+		dbPath = args.String("db", "", "Database path, or connection URL for PostgreSQL (defaults to the configured database)")
+	)
+	if err := args.Parse(os.Args[2:]); err != nil { // Skip "program" and "journal-export"
+		log.Fatalf("failed to parse flags: %v", err)
+	}
+
+	fromDate, toDate, err := parseJournalRange(*from, *to)
+	if err != nil {
+		log.Fatal("Please specify --from and --to as YYYY-MM-DD with from <= to")
+	}
+
+	repo, closeRepo := openCLIRepository(*dbPath, SystemClock)
+	defer closeRepo()
+	ctx := context.Background()
+
+	entries, err := repo.ListJournalEntries(ctx, fromDate, toDate)
+	if err != nil {
+		log.Fatalf("Failed to list journal entries: %v", err)
+	}
+
+	switch *format {
+	case "csv":
+		if err := WriteJournalCSV(os.Stdout, entries); err != nil {
+			log.Fatalf("Failed to write journal: %v", err)
+		}
+	case "json":
+		if entries == nil {
+			entries = []*JournalEntry{}
+		}
+		output, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal journal: %v", err)
+		}
+		fmt.Println(string(output))
+	default:
+		log.Fatalf("Unknown format: %s", *format)
+	}
+}
+
+func runAccrue() {
+	args := flag.NewFlagSet("accrue", flag.ExitOnError)
+	var (
+		asOf   = args.String("as-of", "", "Accrue interest through this date (YYYY-MM-DD), defaults to yesterday")
+		method = args.String("method", getEnv("ACCRUAL_METHOD", string(AccrualStraightLine)), "Accrual method: straight_line, effective_interest")
+		dbPath = args.String("db", "", "Database path, or connection URL for PostgreSQL (defaults to the configured database)")
+	)
+	if err := args.Parse(os.Args[2:]); err != nil { // Skip "program" and "accrue"
+		log.Fatalf("failed to parse flags: %v", err)
+	}
+
+	accrualMethod, err := ParseAccrualMethod(*method)
+	if err != nil {
+		log.Fatalf("Invalid method: %v", err)
+	}
+
+	clock := loadCLIClock()
+	through := dayStart(clock.Now()).AddDate(0, 0, -1)
+	if *asOf != "" {
+		through, err = time.Parse("2006-01-02", *asOf)
+		if err != nil {
+			log.Fatalf("Invalid as-of date: %v", err)
+		}
+	}
+
+	chart, err := loadChartOfAccounts()
+	if err != nil {
+		log.Fatalf("Failed to load chart of accounts: %v", err)
+	}
+
+	repo, closeRepo := openCLIRepository(*dbPath, clock)
+	defer closeRepo()
+	ctx := context.Background()
+
+	result, err := RunInterestAccrual(ctx, repo, chart, accrualMethod, through)
+	if err != nil {
+		log.Fatalf("Interest accrual failed: %v", err)
+	}
+
+	output, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to marshal result: %v", err)
+	}
+	fmt.Println(string(output))
+}
+
+func runWriteOff() {
+	args := flag.NewFlagSet("write-off", flag.ExitOnError)
+	var (
+		dpd    = args.Int("dpd", 90, "Write off loans at least this many days past due")
+		asOf   = args.String("as-of", "", "Evaluate days past due at this date (YYYY-MM-DD), defaults to now")
+		dbPath = args.String("db", "", "Database path, or connection URL for PostgreSQL (defaults to the configured database)")
+	)
+	if err := args.Parse(os.Args[2:]); err != nil { // Skip "program" and "write-off"
+		log.Fatalf("failed to parse flags: %v", err)
+	}
+
+	if *dpd <= 0 {
+		log.Fatal("Please specify a positive --dpd threshold")
+	}
+
+	clock := loadCLIClock()
+	now := clock.Now()
+	if *asOf != "" {
+		var err error
+		now, err = time.Parse("2006-01-02", *asOf)
+		if err != nil {
+			log.Fatalf("Invalid as-of date: %v", err)
+		}
+	}
+
+	chart, err := loadChartOfAccounts()
+	if err != nil {
+		log.Fatalf("Failed to load chart of accounts: %v", err)
+	}
+
+	repo, closeRepo := openCLIRepository(*dbPath, clock)
+	defer closeRepo()
+	ctx := context.Background()
+
+	result, err := RunAutoWriteOff(ctx, repo, chart, *dpd, now)
+	if err != nil {
+		log.Fatalf("Write-off failed: %v", err)
+	}
+
+	output, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to marshal result: %v", err)
+	}
+	fmt.Println(string(output))
+}
+
+func runArchive() {
+	args := flag.NewFlagSet("archive", flag.ExitOnError)
+	var (
+		years  = args.Int("years", 0, "Archive loans paid off at least this many years ago")
+		asOf   = args.String("as-of", "", "Count the years back from this date (YYYY-MM-DD), defaults to now")
+		dbPath = args.String("db", "", "Database path, or connection URL for PostgreSQL (defaults to the configured database)")
+	)
+	if err := args.Parse(os.Args[2:]); err != nil { // Skip "program" and "archive"
+		log.Fatalf("failed to parse flags: %v", err)
+	}
+
+	if *years <= 0 {
+		log.Fatal("Please specify a positive --years threshold")
+	}
+
+	clock := loadCLIClock()
+	now := clock.Now()
+	if *asOf != "" {
+		var err error
+		now, err = time.Parse("2006-01-02", *asOf)
+		if err != nil {
+			log.Fatalf("Invalid as-of date: %v", err)
+		}
+	}
+
+	repo, closeRepo := openCLIRepository(*dbPath, clock)
+	defer closeRepo()
+	ctx := context.Background()
+
+	result, err := RunArchive(ctx, repo, *years, now)
+	if err != nil {
+		log.Fatalf("Archive failed: %v", err)
+	}
+
+	output, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to marshal result: %v", err)
+	}
+	fmt.Println(string(output))
+}
+
+// loadCLIClock returns the clock the CLI commands run at, honouring SIMULATED_NOW
+func loadCLIClock() Clock {
+	clock, err := loadClock(getEnv("APP_ENV", "dev"))
+	if err != nil {
+		log.Fatalf("Invalid clock configuration: %v", err)
+	}
+	return clock
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClockNotSimulated is returned when moving a clock that follows real time
+var ErrClockNotSimulated = errors.New("clock is not simulated")
+
+// Clock tells the service what time it is. Handlers, jobs, the repository and
+// the CLI read the current time through a Clock so that the whole service can
+// run at a simulated date.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock reports the real time in UTC
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// SystemClock is the clock used in production
+var SystemClock Clock = systemClock{}
+
+// SimulatedClock is a clock that stands still until it is set or advanced
+type SimulatedClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewSimulatedClock creates a simulated clock showing now
+func NewSimulatedClock(now time.Time) *SimulatedClock {
+	return &SimulatedClock{now: now.UTC()}
+}
+
+// Now returns the simulated time
+func (c *SimulatedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set moves the clock to now, which may be in the past
+func (c *SimulatedClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now.UTC()
+}
+
+// Advance moves the clock forward by d and returns the new time
+func (c *SimulatedClock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// parseClockTime parses a simulated time given either as a date (midnight UTC)
+// or as an RFC 3339 timestamp
+func parseClockTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
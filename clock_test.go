@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimulatedClock(t *testing.T) {
+	start := time.Date(2025, 8, 1, 9, 0, 0, 0, time.UTC)
+	clock := NewSimulatedClock(start)
+
+	if got := clock.Now(); !got.Equal(start) {
+		t.Errorf("expected %v, got %v", start, got)
+	}
+	if got := clock.Now(); !got.Equal(start) {
+		t.Errorf("expected the clock to stand still, got %v", got)
+	}
+
+	if got := clock.Advance(36 * time.Hour); !got.Equal(start.Add(36 * time.Hour)) {
+		t.Errorf("expected %v after advancing, got %v", start.Add(36*time.Hour), got)
+	}
+
+	clock.Set(start.AddDate(0, 0, -1))
+	if got := clock.Now(); !got.Equal(start.AddDate(0, 0, -1)) {
+		t.Errorf("expected the clock to move back, got %v", got)
+	}
+}
+
+func TestLoadClock(t *testing.T) {
+	t.Setenv("SIMULATED_NOW", "")
+	clock, err := loadClock("dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if clock != SystemClock {
+		t.Errorf("expected the system clock without SIMULATED_NOW")
+	}
+
+	t.Setenv("SIMULATED_NOW", "2025-09-01")
+	clock, err = loadClock("staging")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC); !clock.Now().Equal(want) {
+		t.Errorf("expected %v, got %v", want, clock.Now())
+	}
+
+	if _, err := loadClock("prod"); err == nil {
+		t.Error("expected simulated time to be refused in prod")
+	}
+
+	t.Setenv("SIMULATED_NOW", "next tuesday")
+	if _, err := loadClock("dev"); err == nil {
+		t.Error("expected an error for an invalid SIMULATED_NOW")
+	}
+}
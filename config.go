@@ -1,6 +1,12 @@
 package main
 
-import "os"
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
 
 func getEnv(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
@@ -8,3 +14,180 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// loadChartOfAccounts returns the chart configured via CHART_OF_ACCOUNTS_PATH,
+// falling back to the default chart when the variable is unset
+func loadChartOfAccounts() (ChartOfAccounts, error) {
+	path := getEnv("CHART_OF_ACCOUNTS_PATH", "")
+	if path == "" {
+		return DefaultChartOfAccounts(), nil
+	}
+	return LoadChartOfAccounts(path)
+}
+
+// loadDueDatePolicy returns the due date policy configured via
+// HOLIDAY_CALENDAR_PATH and DUE_DATE_ROLL. Without a calendar due dates
+// follow the weekly cadence unchanged.
+func loadDueDatePolicy() (DueDatePolicy, error) {
+	roll, err := ParseRollConvention(getEnv("DUE_DATE_ROLL", string(RollFollowing)))
+	if err != nil {
+		return DueDatePolicy{}, fmt.Errorf("invalid DUE_DATE_ROLL: %w", err)
+	}
+
+	path := getEnv("HOLIDAY_CALENDAR_PATH", "")
+	if path == "" {
+		return DueDatePolicy{}, nil
+	}
+	calendar, err := LoadHolidayCalendar(path)
+	if err != nil {
+		return DueDatePolicy{}, err
+	}
+	return DueDatePolicy{Calendar: calendar, Roll: roll}, nil
+}
+
+// serviceConfig holds the settings injected into the loan endpoints
+type serviceConfig struct {
+	Chart    ChartOfAccounts
+	DueDates DueDatePolicy
+	Location *time.Location // time zone of new loans that do not name one
+	Clock    Clock
+
+	MaxBackdateDays int // how many days a payment's value date may lie in the past
+}
+
+// defaultServiceConfig returns the configuration used when nothing is overridden
+func defaultServiceConfig() serviceConfig {
+	return serviceConfig{
+		Chart:    DefaultChartOfAccounts(),
+		Location: time.UTC,
+		Clock:    SystemClock,
+
+		MaxBackdateDays: 7,
+	}
+}
+
+// loadServiceConfig reads the chart of accounts, due date policy, default
+// time zone (DEFAULT_TIMEZONE, an IANA name, UTC when unset) and payment
+// backdating limit (PAYMENT_MAX_BACKDATE_DAYS, 7 when unset) from the environment
+func loadServiceConfig() (serviceConfig, error) {
+	cfg := defaultServiceConfig()
+
+	var err error
+	if cfg.Chart, err = loadChartOfAccounts(); err != nil {
+		return cfg, err
+	}
+	if cfg.DueDates, err = loadDueDatePolicy(); err != nil {
+		return cfg, err
+	}
+	if cfg.Location, err = time.LoadLocation(getEnv("DEFAULT_TIMEZONE", "UTC")); err != nil {
+		return cfg, fmt.Errorf("invalid DEFAULT_TIMEZONE: %w", err)
+	}
+	if cfg.MaxBackdateDays, err = strconv.Atoi(getEnv("PAYMENT_MAX_BACKDATE_DAYS", "7")); err != nil || cfg.MaxBackdateDays < 0 {
+		return cfg, fmt.Errorf("invalid PAYMENT_MAX_BACKDATE_DAYS: must be a non-negative number of days")
+	}
+	return cfg, nil
+}
+
+// loadClock returns the system clock, or a simulated clock starting at
+// SIMULATED_NOW (a date or RFC 3339 timestamp) when that is set. Simulated
+// time is refused in production.
+func loadClock(env string) (Clock, error) {
+	value := getEnv("SIMULATED_NOW", "")
+	if value == "" {
+		return SystemClock, nil
+	}
+	if env == "prod" {
+		return nil, fmt.Errorf("SIMULATED_NOW is not allowed in prod")
+	}
+	now, err := parseClockTime(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIMULATED_NOW: %w", err)
+	}
+	return NewSimulatedClock(now), nil
+}
+
+// databaseConfig selects the storage backend
+type databaseConfig struct {
+	Driver       string        // "sqlite", "postgres" or "memory"
+	DSN          string        // database file for SQLite, connection URL for PostgreSQL
+	QueryTimeout time.Duration // limit on each repository call; zero means none
+}
+
+// loadDatabaseConfig reads the backend from DATABASE_DRIVER (sqlite when
+// unset). SQLite uses the file at DATABASE_PATH, PostgreSQL connects to
+// DATABASE_URL and memory keeps everything in process, starting empty.
+// DATABASE_QUERY_TIMEOUT (5s when unset, 0 to disable) limits each query.
+func loadDatabaseConfig() (databaseConfig, error) {
+	timeout, err := time.ParseDuration(getEnv("DATABASE_QUERY_TIMEOUT", "5s"))
+	if err != nil || timeout < 0 {
+		return databaseConfig{}, fmt.Errorf("invalid DATABASE_QUERY_TIMEOUT: must be a non-negative duration such as 5s")
+	}
+
+	switch driver := getEnv("DATABASE_DRIVER", "sqlite"); driver {
+	case "sqlite":
+		if !sqliteSupported {
+			return databaseConfig{}, fmt.Errorf("DATABASE_DRIVER sqlite needs a build with cgo: use postgres or memory")
+		}
+		return databaseConfig{Driver: driver, DSN: getEnv("DATABASE_PATH", "./pinjol.db"), QueryTimeout: timeout}, nil
+	case "postgres":
+		url := getEnv("DATABASE_URL", "")
+		if url == "" {
+			return databaseConfig{}, fmt.Errorf("DATABASE_URL is required when DATABASE_DRIVER is postgres")
+		}
+		return databaseConfig{Driver: driver, DSN: url, QueryTimeout: timeout}, nil
+	case "memory":
+		return databaseConfig{Driver: driver, QueryTimeout: timeout}, nil
+	default:
+		return databaseConfig{}, fmt.Errorf("invalid DATABASE_DRIVER %q: must be sqlite, postgres or memory", driver)
+	}
+}
+
+// Open opens the configured database with its connection pool sized for the
+// backend; dsn overrides the configured DSN when set
+func (c databaseConfig) Open(dsn string) (*sql.DB, error) {
+	if dsn == "" {
+		dsn = c.DSN
+	}
+	switch c.Driver {
+	case "postgres":
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return nil, err
+		}
+		db.SetMaxOpenConns(25)
+		db.SetMaxIdleConns(25)
+		db.SetConnMaxLifetime(5 * time.Minute)
+		return db, nil
+	case "memory":
+		return nil, fmt.Errorf("the memory backend has no database")
+	}
+	return openSQLite(dsn)
+}
+
+// OpenRepository opens the configured backend, or the database at dsn when
+// set, applies pending migrations and returns the loan repository, limited to
+// the query timeout, together with a function that releases it
+func (c databaseConfig) OpenRepository(dsn string, clock Clock) (LoanRepository, func() error, error) {
+	if c.Driver == "memory" {
+		return WithQueryTimeout(NewMemoryLoanRepository().WithClock(clock), c.QueryTimeout), func() error { return nil }, nil
+	}
+
+	db, err := c.Open(dsn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	if err := InitDatabase(db); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	if c.Driver == "postgres" {
+		return WithQueryTimeout(NewPostgresLoanRepository(db).WithClock(clock), c.QueryTimeout), db.Close, nil
+	}
+	return WithQueryTimeout(NewSQLiteLoanRepository(db).WithClock(clock), c.QueryTimeout), db.Close, nil
+}
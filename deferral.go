@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// Deferral records unpaid installments moved to the end of the schedule.
+// Weeks are their 1-based indexes when deferred, which later deferrals and
+// restructures renumber; Moved identifies them by scheduled date instead.
+type Deferral struct {
+	ID         int64          `json:"id"`
+	Weeks      []int          `json:"weeks"`
+	Moved      []DeferredWeek `json:"moved"`
+	Reason     string         `json:"reason"`
+	DeferredAt time.Time      `json:"deferred_at"`
+}
+
+// DeferredWeek is one installment a deferral moved, identified by the date it
+// was scheduled for before the deferral and the date it was moved to
+type DeferredWeek struct {
+	ScheduledDate time.Time `json:"scheduled_date"`
+	DeferredTo    time.Time `json:"deferred_to"`
+}
+
+// DeferWeeks moves the given unpaid weeks (1-based indexes) to the end of the
+// schedule. The remaining weeks keep their due dates, leaving a payment
+// holiday where the deferred weeks were, and the deferred weeks are scheduled
+// weekly after the current maturity and rolled under the due date policy.
+// The schedule is renumbered so that Index still matches each week's position.
+func (l *Loan) DeferWeeks(weeks []int, reason string, policy DueDatePolicy, now time.Time) (*Deferral, error) {
+	if l.Status == LoanStatusWrittenOff {
+		return nil, ErrLoanWrittenOff
+	}
+	if l.firstUnpaidIndex() == -1 {
+		return nil, ErrAlreadyPaid
+	}
+	if len(weeks) == 0 || reason == "" {
+		return nil, ErrInvalidDeferral
+	}
+
+	deferred := make(map[int]bool, len(weeks))
+	for _, index := range weeks {
+		if index < 1 || index > len(l.Schedule) || deferred[index] {
+			return nil, ErrInvalidDeferral
+		}
+		week := l.Schedule[index-1]
+		if week.Paid || week.Deferred {
+			return nil, ErrInvalidDeferral
+		}
+		deferred[index] = true
+	}
+
+	schedule := make([]Week, 0, len(l.Schedule))
+	var moved []Week
+	for _, week := range l.Schedule {
+		if deferred[week.Index] {
+			moved = append(moved, week)
+			continue
+		}
+		schedule = append(schedule, week)
+	}
+
+	maturity := l.Schedule[len(l.Schedule)-1].ScheduledDate
+	record := make([]DeferredWeek, len(moved))
+	for i, week := range moved {
+		record[i].ScheduledDate = week.ScheduledDate
+		week.ScheduledDate = maturity.AddDate(0, 0, 7*(i+1))
+		record[i].DeferredTo = week.ScheduledDate
+		week.DueDate = policy.Adjust(week.ScheduledDate)
+		week.Deferred = true
+		schedule = append(schedule, week)
+	}
+	for i := range schedule {
+		schedule[i].Index = i + 1
+	}
+	l.Schedule = schedule
+
+	sorted := append([]int(nil), weeks...)
+	sort.Ints(sorted)
+	l.Deferrals = append(l.Deferrals, Deferral{
+		Weeks:      sorted,
+		Moved:      record,
+		Reason:     reason,
+		DeferredAt: now,
+	})
+	return &l.Deferrals[len(l.Deferrals)-1], nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoanDeferWeeks(t *testing.T) {
+	loan := newPaidLoan(t, 2)
+	now := time.Date(2025, 8, 20, 0, 0, 0, 0, time.UTC)
+
+	deferral, err := loan.DeferWeeks([]int{4, 3}, "flood", DueDatePolicy{}, now)
+	if err != nil {
+		t.Fatalf("deferral failed: %v", err)
+	}
+	if len(deferral.Weeks) != 2 || deferral.Weeks[0] != 3 || deferral.Weeks[1] != 4 || deferral.Reason != "flood" {
+		t.Errorf("unexpected deferral %+v", deferral)
+	}
+
+	if len(loan.Schedule) != 50 {
+		t.Fatalf("expected 50 weeks, got %d", len(loan.Schedule))
+	}
+	for i, week := range loan.Schedule {
+		if week.Index != i+1 {
+			t.Errorf("expected week index %d, got %d", i+1, week.Index)
+		}
+	}
+
+	// Week 5 now comes next and keeps its own due date
+	next := loan.Schedule[2]
+	if next.Deferred || !next.DueDate.Equal(time.Date(2025, 9, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected next week %+v", next)
+	}
+
+	// The deferred weeks fall due after the original maturity of 2026-07-17
+	for i, expected := range []time.Time{
+		time.Date(2026, 7, 24, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 7, 31, 0, 0, 0, 0, time.UTC),
+	} {
+		week := loan.Schedule[48+i]
+		if !week.Deferred || week.Paid || !week.DueDate.Equal(expected) {
+			t.Errorf("unexpected deferred week %+v", week)
+		}
+	}
+	if loan.GetOutstanding() != 5_280_000 {
+		t.Errorf("expected outstanding 5280000, got %d", loan.GetOutstanding())
+	}
+}
+
+// TestLoanDeferWeeksTwice defers week 3 twice: the second time it is the
+// installment first scheduled as week 4, which the record must tell apart
+func TestLoanDeferWeeksTwice(t *testing.T) {
+	loan := newPaidLoan(t, 2)
+	now := time.Date(2025, 8, 20, 0, 0, 0, 0, time.UTC)
+
+	for _, reason := range []string{"flood", "landslide"} {
+		if _, err := loan.DeferWeeks([]int{3}, reason, DueDatePolicy{}, now); err != nil {
+			t.Fatalf("deferral failed: %v", err)
+		}
+	}
+
+	expected := []DeferredWeek{
+		{ScheduledDate: time.Date(2025, 8, 22, 0, 0, 0, 0, time.UTC), DeferredTo: time.Date(2026, 7, 24, 0, 0, 0, 0, time.UTC)},
+		{ScheduledDate: time.Date(2025, 8, 29, 0, 0, 0, 0, time.UTC), DeferredTo: time.Date(2026, 7, 31, 0, 0, 0, 0, time.UTC)},
+	}
+	for i, deferral := range loan.Deferrals {
+		if len(deferral.Weeks) != 1 || deferral.Weeks[0] != 3 {
+			t.Errorf("expected deferral %d of week 3, got %v", i+1, deferral.Weeks)
+		}
+		if len(deferral.Moved) != 1 || !deferral.Moved[0].ScheduledDate.Equal(expected[i].ScheduledDate) || !deferral.Moved[0].DeferredTo.Equal(expected[i].DeferredTo) {
+			t.Errorf("expected deferral %d to move %+v, got %+v", i+1, expected[i], deferral.Moved)
+		}
+
+		// The installment is still found where the deferral put it
+		week := loan.Schedule[48+i]
+		if !week.Deferred || !week.ScheduledDate.Equal(deferral.Moved[0].DeferredTo) {
+			t.Errorf("expected week %d to be the installment deferred to %v, got %+v", 49+i, deferral.Moved[0].DeferredTo, week)
+		}
+	}
+}
+
+func TestLoanDeferWeeksErrors(t *testing.T) {
+	now := time.Date(2025, 8, 20, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		weeks    []int
+		reason   string
+		expected error
+	}{
+		{name: "no weeks", weeks: nil, reason: "flood", expected: ErrInvalidDeferral},
+		{name: "no reason", weeks: []int{3}, reason: "", expected: ErrInvalidDeferral},
+		{name: "paid week", weeks: []int{2}, reason: "flood", expected: ErrInvalidDeferral},
+		{name: "out of range", weeks: []int{51}, reason: "flood", expected: ErrInvalidDeferral},
+		{name: "duplicate week", weeks: []int{3, 3}, reason: "flood", expected: ErrInvalidDeferral},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan := newPaidLoan(t, 2)
+			if _, err := loan.DeferWeeks(tt.weeks, tt.reason, DueDatePolicy{}, now); err != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+
+	// A week can only be deferred once
+	loan := newPaidLoan(t, 2)
+	if _, err := loan.DeferWeeks([]int{3}, "flood", DueDatePolicy{}, now); err != nil {
+		t.Fatalf("deferral failed: %v", err)
+	}
+	if _, err := loan.DeferWeeks([]int{50}, "flood", DueDatePolicy{}, now); err != ErrInvalidDeferral {
+		t.Errorf("expected ErrInvalidDeferral for deferred week, got %v", err)
+	}
+
+	if err := loan.WriteOff(now); err != nil {
+		t.Fatalf("write-off failed: %v", err)
+	}
+	if _, err := loan.DeferWeeks([]int{3}, "flood", DueDatePolicy{}, now); err != ErrLoanWrittenOff {
+		t.Errorf("expected ErrLoanWrittenOff, got %v", err)
+	}
+}
+
+func TestDeferredWeeksDelinquency(t *testing.T) {
+	loan := newPaidLoan(t, 2)
+	if _, err := loan.DeferWeeks([]int{3, 4}, "national holiday", DueDatePolicy{}, time.Date(2025, 8, 20, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("deferral failed: %v", err)
+	}
+
+	// Originally weeks 3 and 4 would both be unpaid on 2025-09-04
+	if delinquent, _, _ := loan.IsDelinquent(time.Date(2025, 9, 4, 0, 0, 0, 0, time.UTC)); delinquent {
+		t.Error("expected deferred weeks not to make the loan delinquent")
+	}
+	// Missing the two weeks after the holiday still counts
+	if delinquent, streak, _ := loan.IsDelinquent(time.Date(2025, 9, 12, 0, 0, 0, 0, time.UTC)); !delinquent || streak != 2 {
+		t.Errorf("expected delinquency with streak 2, got %v/%d", delinquent, streak)
+	}
+
+	// Deferred weeks that fall due at the end and go unpaid count like any other
+	for i := 2; i < 48; i++ {
+		if err := loan.MakePayment(loan.Schedule[i].Amount, loan.Schedule[i].DueDate); err != nil {
+			t.Fatalf("payment %d failed: %v", i+1, err)
+		}
+	}
+	checkAt := time.Date(2026, 8, 15, 0, 0, 0, 0, time.UTC)
+	if delinquent, streak, _ := loan.IsDelinquent(checkAt); !delinquent || streak != 2 {
+		t.Errorf("expected unpaid deferred weeks to make the loan delinquent, got %v/%d", delinquent, streak)
+	}
+	for i := 48; i < 50; i++ {
+		if !loan.Schedule[i].Deferred {
+			t.Fatalf("expected week %d to be a deferred week", i+1)
+		}
+		if err := loan.MakePayment(loan.Schedule[i].Amount, loan.Schedule[i].DueDate); err != nil {
+			t.Fatalf("payment %d failed: %v", i+1, err)
+		}
+	}
+	if delinquent, _, _ := loan.IsDelinquent(checkAt); delinquent {
+		t.Error("expected the loan to be current once the deferred weeks are paid")
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
-import "errors"
+import (
+	"errors"
+	"net/http"
+)
 
 var (
 	// ErrInvalidRequest represents invalid request data
@@ -12,9 +15,172 @@ var (
 	// ErrLoanNotFound represents a loan that doesn't exist
 	ErrLoanNotFound = errors.New("loan not found")
 	
+	// ErrLoanExists represents a loan created with an ID that is already taken
+	ErrLoanExists = errors.New("loan already exists")
+
+	// ErrExternalIDExists represents a loan created with a partner reference that is already taken
+	ErrExternalIDExists = errors.New("external_id already exists")
+
 	// ErrAlreadyPaid represents an attempt to pay when all weeks are paid
 	ErrAlreadyPaid = errors.New("loan already fully paid")
 	
 	// ErrWrongAmount represents a payment with incorrect amount
 	ErrWrongAmount = errors.New("amount must equal this week's payable")
+
+	// ErrInvalidValueDate represents a payment value date outside the allowed window
+	ErrInvalidValueDate = errors.New("paid_at must be between the loan start and now, within the backdating limit")
+
+	// ErrVersionConflict represents a write against a stale copy of a loan
+	ErrVersionConflict = errors.New("loan was modified concurrently")
+
+	// ErrUnbalancedEntry represents a journal entry whose debits and credits differ
+	ErrUnbalancedEntry = errors.New("journal entry is not balanced")
+
+	// ErrJournalEntryNotFound represents a journal entry that doesn't exist
+	ErrJournalEntryNotFound = errors.New("journal entry not found")
+
+	// ErrJournalEntryExists represents a journal entry posted with an ID that is already taken
+	ErrJournalEntryExists = errors.New("journal entry already posted")
+
+	// ErrReversalNotAllowed represents a reversal of an entry that is itself a reversal
+	ErrReversalNotAllowed = errors.New("reversal entries cannot be reversed")
+
+	// ErrLoanWrittenOff represents an operation that is not allowed on a written-off loan
+	ErrLoanWrittenOff = errors.New("loan is written off")
+
+	// ErrLoanNotWrittenOff represents a recovery against a loan that was never written off
+	ErrLoanNotWrittenOff = errors.New("loan is not written off")
+
+	// ErrRecoveryExceedsBalance represents recoveries larger than the written-off balance
+	ErrRecoveryExceedsBalance = errors.New("recovery exceeds written-off balance")
+
+	// ErrInvalidRestructure represents restructuring terms that cannot be applied
+	ErrInvalidRestructure = errors.New("invalid restructure terms")
+
+	// ErrInvalidDeferral represents a deferral of weeks that cannot be deferred
+	ErrInvalidDeferral = errors.New("invalid deferral")
+
+	// ErrRefinanceNotAllowed represents a refinance of a loan that is not active or not in good standing
+	ErrRefinanceNotAllowed = errors.New("loan is not eligible for refinancing")
+
+	// ErrRefinanceTooSmall represents a new principal that does not cover the payoff
+	ErrRefinanceTooSmall = errors.New("new principal must exceed the payoff amount")
+
+	// ErrQueryTimeout represents a repository call that exceeded the configured query timeout
+	ErrQueryTimeout = errors.New("database query timed out")
+
+	// ErrLoanNotDeleted represents a restore of a loan that is neither deleted nor archived
+	ErrLoanNotDeleted = errors.New("loan is not deleted or archived")
 )
+
+// Error codes returned to clients. Codes are stable; messages may change.
+const (
+	CodeInvalidRequest         = "INVALID_REQUEST"
+	CodeUnsupportedProduct     = "UNSUPPORTED_PRODUCT"
+	CodeLoanNotFound           = "LOAN_NOT_FOUND"
+	CodeLoanExists             = "LOAN_EXISTS"
+	CodeExternalIDExists       = "EXTERNAL_ID_EXISTS"
+	CodeAlreadyPaid            = "ALREADY_PAID"
+	CodeWrongAmount            = "WRONG_AMOUNT"
+	CodeInvalidValueDate       = "INVALID_VALUE_DATE"
+	CodeVersionConflict        = "VERSION_CONFLICT"
+	CodeJournalEntryNotFound   = "JOURNAL_ENTRY_NOT_FOUND"
+	CodeJournalEntryExists     = "JOURNAL_ENTRY_EXISTS"
+	CodeReversalNotAllowed     = "REVERSAL_NOT_ALLOWED"
+	CodeLoanWrittenOff         = "LOAN_WRITTEN_OFF"
+	CodeLoanNotWrittenOff      = "LOAN_NOT_WRITTEN_OFF"
+	CodeRecoveryExceedsBalance = "RECOVERY_EXCEEDS_BALANCE"
+	CodeInvalidRestructure     = "INVALID_RESTRUCTURE"
+	CodeInvalidDeferral        = "INVALID_DEFERRAL"
+	CodeRefinanceNotAllowed    = "REFINANCE_NOT_ALLOWED"
+	CodeRefinanceTooSmall      = "REFINANCE_TOO_SMALL"
+	CodeClockNotSimulated      = "CLOCK_NOT_SIMULATED"
+	CodeQueryTimeout           = "QUERY_TIMEOUT"
+	CodeLoanNotDeleted         = "LOAN_NOT_DELETED"
+	CodeNotFound               = "NOT_FOUND"
+	CodeMethodNotAllowed       = "METHOD_NOT_ALLOWED"
+	CodeInternal               = "INTERNAL_ERROR"
+)
+
+// errorCodes maps domain errors to their code and default HTTP status
+var errorCodes = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{ErrInvalidRequest, http.StatusBadRequest, CodeInvalidRequest},
+	{ErrUnsupportedProduct, http.StatusBadRequest, CodeUnsupportedProduct},
+	{ErrLoanNotFound, http.StatusNotFound, CodeLoanNotFound},
+	{ErrLoanExists, http.StatusConflict, CodeLoanExists},
+	{ErrExternalIDExists, http.StatusConflict, CodeExternalIDExists},
+	{ErrAlreadyPaid, http.StatusConflict, CodeAlreadyPaid},
+	{ErrWrongAmount, http.StatusBadRequest, CodeWrongAmount},
+	{ErrInvalidValueDate, http.StatusBadRequest, CodeInvalidValueDate},
+	{ErrVersionConflict, http.StatusConflict, CodeVersionConflict},
+	{ErrJournalEntryNotFound, http.StatusNotFound, CodeJournalEntryNotFound},
+	{ErrJournalEntryExists, http.StatusConflict, CodeJournalEntryExists},
+	{ErrReversalNotAllowed, http.StatusConflict, CodeReversalNotAllowed},
+	{ErrLoanWrittenOff, http.StatusConflict, CodeLoanWrittenOff},
+	{ErrLoanNotWrittenOff, http.StatusConflict, CodeLoanNotWrittenOff},
+	{ErrRecoveryExceedsBalance, http.StatusBadRequest, CodeRecoveryExceedsBalance},
+	{ErrInvalidRestructure, http.StatusBadRequest, CodeInvalidRestructure},
+	{ErrInvalidDeferral, http.StatusBadRequest, CodeInvalidDeferral},
+	{ErrRefinanceNotAllowed, http.StatusConflict, CodeRefinanceNotAllowed},
+	{ErrRefinanceTooSmall, http.StatusBadRequest, CodeRefinanceTooSmall},
+	{ErrClockNotSimulated, http.StatusConflict, CodeClockNotSimulated},
+	{ErrQueryTimeout, http.StatusServiceUnavailable, CodeQueryTimeout},
+	{ErrLoanNotDeleted, http.StatusConflict, CodeLoanNotDeleted},
+}
+
+// APIError is an error reported to API clients as a code, a message and
+// optional details. Err is the underlying cause; it is logged but never sent.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Details map[string]any
+	Err     error
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil && e.Err.Error() != e.Message {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// toAPIError maps err to the error reported to clients. Domain errors get
+// their code and default status; anything else is an internal error.
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			return &APIError{Status: known.status, Code: known.code, Message: known.err.Error(), Err: err}
+		}
+	}
+	return &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal server error", Err: err}
+}
+
+// withStatus reports a domain error with a status other than its default,
+// keeping its code
+func withStatus(status int, err error) *APIError {
+	apiErr := *toAPIError(err)
+	apiErr.Status = status
+	return &apiErr
+}
+
+// orInternal returns domain errors unchanged so they keep their code, and
+// reports any other error as an internal error with the given message
+func orInternal(err error, message string) error {
+	if apiErr := toAPIError(err); apiErr.Code != CodeInternal {
+		return err
+	}
+	return &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: message, Err: err}
+}
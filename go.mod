@@ -4,6 +4,7 @@ go 1.24.5
 
 require (
 	github.com/labstack/echo/v4 v4.13.4
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.22
 )
 
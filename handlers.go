@@ -1,25 +1,36 @@
 package main
 
 import (
-	"encoding/base32"
-	"fmt"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
-// CreateLoanRequest represents the request body for creating a loan
+// CreateLoanRequest represents the request body for creating a loan.
+// ID is generated when empty and ExternalID is an optional, unique partner reference.
 type CreateLoanRequest struct {
-	Principal  int64   `json:"principal"`
-	AnnualRate float64 `json:"annual_rate"`
-	StartDate  string  `json:"start_date"`
+	ID         string  `json:"id" validate:"id"`
+	ExternalID string  `json:"external_id" validate:"max=64"`
+	Principal  int64   `json:"principal" validate:"required,min=1"`
+	AnnualRate float64 `json:"annual_rate" validate:"min=0"`
+	StartDate  string  `json:"start_date" validate:"required,date"`
+	Timezone   string  `json:"timezone" validate:"timezone"`
 }
 
-// PaymentRequest represents the request body for making a payment
+// maxPaymentAttempts bounds how often a payment is retried after losing a
+// version conflict before the client gets a 409
+const maxPaymentAttempts = 3
+
+// PaymentRequest represents the request body for making a payment.
+// PaidAt is the value date the money arrived, either a date (midnight in the
+// loan's time zone) or an RFC 3339 timestamp; it defaults to now.
 type PaymentRequest struct {
-	Amount int64 `json:"amount"`
+	Amount int64  `json:"amount" validate:"required,min=1"`
+	PaidAt string `json:"paid_at" validate:"datetime"`
 }
 
 // PaymentResponse represents the response for a successful payment
@@ -33,6 +44,65 @@ type OutstandingResponse struct {
 	Outstanding int64 `json:"outstanding"`
 }
 
+// RecoveryRequest represents the request body for a recovery payment
+type RecoveryRequest struct {
+	Amount int64 `json:"amount" validate:"required,min=1"`
+}
+
+// RecoveryResponse represents the response for a recorded recovery
+type RecoveryResponse struct {
+	Recovery            Recovery `json:"recovery"`
+	TotalRecovered      int64    `json:"total_recovered"`
+	RemainingWrittenOff int64    `json:"remaining_written_off"`
+}
+
+// FeeRequest represents the request body for charging a fee. Reference is the
+// caller's unique ID for the fee; repeating it does not charge the fee twice.
+type FeeRequest struct {
+	Reference string `json:"reference" validate:"required,id"`
+	Amount    int64  `json:"amount" validate:"required,min=1"`
+}
+
+// RestructureRequest represents the request body for restructuring a loan
+type RestructureRequest struct {
+	ExtendWeeks       int    `json:"extend_weeks" validate:"min=0"`
+	InstallmentAmount int64  `json:"installment_amount" validate:"min=0"`
+	HolidayWeeks      int    `json:"holiday_weeks" validate:"min=0"`
+	Reason            string `json:"reason" validate:"max=500"`
+}
+
+// DeferralRequest represents the request body for deferring installments
+type DeferralRequest struct {
+	Weeks  []int  `json:"weeks" validate:"required"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// RefinanceRequest represents the request body for refinancing a loan.
+// StartDate defaults to today; the new loan keeps the old loan's time zone.
+type RefinanceRequest struct {
+	Principal  int64   `json:"principal" validate:"required,min=1"`
+	AnnualRate float64 `json:"annual_rate" validate:"min=0"`
+	StartDate  string  `json:"start_date" validate:"date"`
+}
+
+// RefinanceResponse represents the response for a refinanced loan
+type RefinanceResponse struct {
+	Refinancing *Refinancing `json:"refinancing"`
+	Loan        *Loan        `json:"loan"`
+}
+
+// LoanInterestResponse represents accrued vs collected interest of one loan
+type LoanInterestResponse struct {
+	LoanID string `json:"loan_id"`
+	InterestSummary
+}
+
+// PortfolioInterestResponse represents accrued vs collected interest across all loans
+type PortfolioInterestResponse struct {
+	Loans int `json:"loans"`
+	InterestSummary
+}
+
 // DelinquencyResponse represents the response for delinquency status
 type DelinquencyResponse struct {
 	Delinquent   bool `json:"delinquent"`
@@ -40,6 +110,20 @@ type DelinquencyResponse struct {
 	ObservedWeek int  `json:"observed_week"`
 }
 
+// ClockRequest represents the request body for moving the simulated clock.
+// Now sets the clock (a date or RFC 3339 timestamp); Advance moves it forward
+// by a Go duration such as "24h".
+type ClockRequest struct {
+	Now     string `json:"now" validate:"datetime"`
+	Advance string `json:"advance" validate:"duration"`
+}
+
+// ClockResponse represents the service's current time
+type ClockResponse struct {
+	Now       time.Time `json:"now"`
+	Simulated bool      `json:"simulated"`
+}
+
 func healthHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
 }
@@ -54,10 +138,11 @@ func versionHandler(version, buildTime string) echo.HandlerFunc {
 	}
 }
 
-func createLoanHandler(c echo.Context, repo LoanRepository) error {
+func createLoanHandler(c echo.Context, repo LoanRepository, chart ChartOfAccounts, dueDates DueDatePolicy, defaultLoc *time.Location, ids *IDGenerator) error {
+	ctx := c.Request().Context()
 	var req CreateLoanRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": ErrInvalidRequest.Error()})
+	if err := bindRequest(c, &req); err != nil {
+		return err
 	}
 
 	// Default annual rate
@@ -65,103 +150,241 @@ func createLoanHandler(c echo.Context, repo LoanRepository) error {
 		req.AnnualRate = 0.10
 	}
 
-	// Parse start date
-	startDate, err := time.Parse("2006-01-02", req.StartDate)
+	// Resolve the loan's time zone
+	loc := defaultLoc
+	if req.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(req.Timezone)
+		if err != nil {
+			return ErrInvalidRequest
+		}
+	}
+
+	// Parse start date as local midnight
+	startDate, err := time.ParseInLocation("2006-01-02", req.StartDate, loc)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": ErrInvalidRequest.Error()})
+		return ErrInvalidRequest
 	}
 
-	// Generate unique ID (base36 timestamp)
-	id := generateLoanID()
+	// Blank partner references are the same as none
+	req.ExternalID = strings.TrimSpace(req.ExternalID)
+
+	// Use the client's ID or generate a unique, time-ordered one
+	id := req.ID
+	if id == "" {
+		if id, err = ids.NewLoanID(); err != nil {
+			return orInternal(err, "Failed to generate loan ID")
+		}
+	}
 
 	// Create loan
 	loan, err := NewLoan(id, req.Principal, req.AnnualRate, startDate)
 	if err != nil {
-		if err == ErrUnsupportedProduct {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		if errors.Is(err, ErrUnsupportedProduct) {
+			return err
 		}
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": ErrInvalidRequest.Error()})
+		return ErrInvalidRequest
 	}
+	loan.ExternalID = req.ExternalID
+	loan.ApplyDueDatePolicy(dueDates)
 
-	// Store loan in database
-	if err := repo.Create(loan); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create loan"})
+	// Store and book the loan in one unit of work
+	err = repo.WithTx(ctx, func(tx LoanRepository) error {
+		if err := tx.Create(ctx, loan); err != nil {
+			return orInternal(err, "Failed to create loan")
+		}
+
+		// Book the disbursement
+		if err := tx.PostJournalEntry(ctx, DisbursementEntry(loan, chart)); err != nil {
+			return orInternal(err, "Failed to record journal entry")
+		}
+		return nil
+	})
+	if err != nil {
+		return orInternal(err, "Failed to create loan")
 	}
 
 	return c.JSON(http.StatusCreated, loan)
 }
 
 func getLoanHandler(c echo.Context, repo LoanRepository) error {
+	ctx := c.Request().Context()
 	id := c.Param("id")
 
-	loan, err := repo.GetByID(id)
+	loan, err := repo.GetByID(ctx, id)
 	if err != nil {
-		if err == ErrLoanNotFound {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
-		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve loan"})
+		return orInternal(err, "Failed to retrieve loan")
 	}
 
 	return c.JSON(http.StatusOK, loan)
 }
 
-func payLoanHandler(c echo.Context, repo LoanRepository) error {
+// deleteLoanHandler soft-deletes a loan, keeping its rows for restore
+func deleteLoanHandler(c echo.Context, repo LoanRepository) error {
+	if err := repo.Delete(c.Request().Context(), c.Param("id")); err != nil {
+		return orInternal(err, "Failed to delete loan")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// restoreLoanHandler brings back a deleted or archived loan
+func restoreLoanHandler(c echo.Context, repo LoanRepository) error {
+	ctx := c.Request().Context()
 	id := c.Param("id")
 
-	var req PaymentRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": ErrInvalidRequest.Error()})
+	if err := repo.Restore(ctx, id); err != nil {
+		return orInternal(err, "Failed to restore loan")
 	}
-
-	// Get loan from database
-	loan, err := repo.GetByID(id)
+	loan, err := repo.GetByID(ctx, id)
 	if err != nil {
-		if err == ErrLoanNotFound {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		return orInternal(err, "Failed to retrieve loan")
+	}
+	return c.JSON(http.StatusOK, loan)
+}
+
+// listLoansHandler lists loans, or resolves a partner reference when
+// external_id is given, in which case at most one loan is returned.
+// updated_since (RFC 3339) keeps the loans written at or after that instant;
+// include_deleted=true also lists soft-deleted loans.
+func listLoansHandler(c echo.Context, repo LoanRepository) error {
+	ctx := c.Request().Context()
+	if externalID := c.QueryParam("external_id"); externalID != "" {
+		loan, err := repo.GetByExternalID(ctx, externalID)
+		if err != nil {
+			if errors.Is(err, ErrLoanNotFound) {
+				return c.JSON(http.StatusOK, []*Loan{})
+			}
+			return orInternal(err, "Failed to retrieve loan")
 		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve loan"})
+		return c.JSON(http.StatusOK, []*Loan{loan})
 	}
 
-	// Find the first unpaid week index (1-based) before making payment
-	firstUnpaidWeek := 0
-	for i, week := range loan.Schedule {
-		if !week.Paid {
-			firstUnpaidWeek = i + 1 // Convert to 1-based index
-			break
+	var filter LoanFilter
+	if updatedSince := c.QueryParam("updated_since"); updatedSince != "" {
+		since, err := time.Parse(time.RFC3339Nano, updatedSince)
+		if err != nil {
+			return ErrInvalidRequest
+		}
+		filter.UpdatedSince = since
+	}
+	if includeDeleted := c.QueryParam("include_deleted"); includeDeleted != "" {
+		include, err := strconv.ParseBool(includeDeleted)
+		if err != nil {
+			return ErrInvalidRequest
 		}
+		filter.IncludeDeleted = include
 	}
 
-	now := time.Now().UTC()
-	err = loan.MakePayment(req.Amount, now)
+	loans, err := repo.List(ctx, filter)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return orInternal(err, "Failed to list loans")
 	}
+	if loans == nil {
+		loans = []*Loan{}
+	}
+	return c.JSON(http.StatusOK, loans)
+}
 
-	// Update loan in database
-	if err := repo.Update(loan); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update loan"})
+func getLoanByRefHandler(c echo.Context, repo LoanRepository) error {
+	ctx := c.Request().Context()
+	loan, err := repo.GetByExternalID(ctx, c.Param("ref"))
+	if err != nil {
+		return orInternal(err, "Failed to retrieve loan")
 	}
 
-	// Recompute outstanding after payment
-	remainingOutstanding := loan.GetOutstanding()
+	return c.JSON(http.StatusOK, loan)
+}
+
+func payLoanHandler(c echo.Context, repo LoanRepository, chart ChartOfAccounts, clock Clock, maxBackdateDays int) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
 
-	response := PaymentResponse{
-		PaidWeek:             firstUnpaidWeek,
-		RemainingOutstanding: remainingOutstanding,
+	var req PaymentRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
 	}
 
-	return c.JSON(http.StatusOK, response)
+	// Read, pay and book in one unit of work; the loan stays locked until the
+	// payment is stored and booked, so concurrent payments queue up behind it.
+	// A write against a stale copy still loses the version check, so re-read
+	// and retry a bounded number of times.
+	for attempt := 1; ; attempt++ {
+		var response PaymentResponse
+		err := repo.WithTx(ctx, func(tx LoanRepository) error {
+			// Get loan from database
+			loan, err := tx.GetByID(ctx, id)
+			if err != nil {
+				return orInternal(err, "Failed to retrieve loan")
+			}
+
+			// Find the first unpaid week index (1-based) before making payment
+			firstUnpaidWeek := 0
+			for i, week := range loan.Schedule {
+				if !week.Paid {
+					firstUnpaidWeek = i + 1 // Convert to 1-based index
+					break
+				}
+			}
+
+			// Resolve the value date; backdated payments come from late settlement files
+			now := clock.Now()
+			paidAt := now
+			if req.PaidAt != "" {
+				paidAt, err = parseValueDate(req.PaidAt, loan.Location())
+				if err != nil {
+					return ErrInvalidRequest
+				}
+				if err := loan.CheckValueDate(paidAt, now, maxBackdateDays); err != nil {
+					apiErr := toAPIError(err)
+					apiErr.Details = map[string]any{"max_backdate_days": maxBackdateDays}
+					return apiErr
+				}
+			}
+
+			// Payments that cannot be applied are rejected as bad requests
+			err = loan.MakePayment(req.Amount, paidAt)
+			if err != nil {
+				apiErr := withStatus(http.StatusBadRequest, err)
+				if errors.Is(err, ErrWrongAmount) {
+					apiErr.Details = map[string]any{"expected_amount": loan.Schedule[firstUnpaidWeek-1].Amount}
+				}
+				return apiErr
+			}
+
+			// Update loan in database
+			if err := tx.Update(ctx, loan); err != nil {
+				return orInternal(err, "Failed to update loan")
+			}
+
+			// Book the payment
+			if err := tx.PostJournalEntry(ctx, PaymentEntry(loan, firstUnpaidWeek, paidAt, chart)); err != nil {
+				return orInternal(err, "Failed to record journal entry")
+			}
+
+			// Recompute outstanding after payment
+			response = PaymentResponse{
+				PaidWeek:             firstUnpaidWeek,
+				RemainingOutstanding: loan.GetOutstanding(),
+			}
+			return nil
+		})
+		if errors.Is(err, ErrVersionConflict) && attempt < maxPaymentAttempts {
+			continue
+		}
+		if err != nil {
+			return orInternal(err, "Failed to record payment")
+		}
+		return c.JSON(http.StatusOK, response)
+	}
 }
 
 func getOutstandingHandler(c echo.Context, repo LoanRepository) error {
+	ctx := c.Request().Context()
 	id := c.Param("id")
 
-	loan, err := repo.GetByID(id)
+	loan, err := repo.GetByID(ctx, id)
 	if err != nil {
-		if err == ErrLoanNotFound {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
-		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve loan"})
+		return orInternal(err, "Failed to retrieve loan")
 	}
 
 	// Recompute outstanding from schedule to ensure consistency
@@ -174,21 +397,20 @@ func getOutstandingHandler(c echo.Context, repo LoanRepository) error {
 	return c.JSON(http.StatusOK, response)
 }
 
-func getDelinquencyHandler(c echo.Context, repo LoanRepository) error {
+func getDelinquencyHandler(c echo.Context, repo LoanRepository, clock Clock) error {
+	ctx := c.Request().Context()
 	id := c.Param("id")
 
-	loan, err := repo.GetByID(id)
+	loan, err := repo.GetByID(ctx, id)
 	if err != nil {
-		if err == ErrLoanNotFound {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
-		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve loan"})
+		return orInternal(err, "Failed to retrieve loan")
 	}
 
-	// Check for time override in query parameter
-	now := time.Now().UTC()
+	// Check for time override in query parameter; a bare date is the start of
+	// that day in the loan's time zone
+	now := clock.Now()
 	if nowParam := c.QueryParam("now"); nowParam != "" {
-		if parsedTime, err := time.Parse("2006-01-02", nowParam); err == nil {
+		if parsedTime, err := time.ParseInLocation("2006-01-02", nowParam, loan.Location()); err == nil {
 			now = parsedTime
 		} else if parsedTime, err := time.Parse(time.RFC3339, nowParam); err == nil {
 			now = parsedTime
@@ -206,9 +428,350 @@ func getDelinquencyHandler(c echo.Context, repo LoanRepository) error {
 	return c.JSON(http.StatusOK, response)
 }
 
-// generateLoanID generates a unique loan ID using base32 timestamp
-func generateLoanID() string {
-	timestamp := time.Now().UnixNano()
-	encoded := base32.StdEncoding.EncodeToString([]byte(strconv.FormatInt(timestamp, 36)))
-	return fmt.Sprintf("loan_%s", encoded[:8])
+func writeOffLoanHandler(c echo.Context, repo LoanRepository, chart ChartOfAccounts, clock Clock) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+
+	var loan *Loan
+	err := repo.WithTx(ctx, func(tx LoanRepository) error {
+		var err error
+		if loan, err = tx.GetByID(ctx, id); err != nil {
+			return orInternal(err, "Failed to retrieve loan")
+		}
+		return writeOffLoan(ctx, tx, chart, loan, clock.Now())
+	})
+	if err != nil {
+		return orInternal(err, "Failed to write off loan")
+	}
+
+	return c.JSON(http.StatusOK, loan)
+}
+
+func recoveryHandler(c echo.Context, repo LoanRepository, chart ChartOfAccounts, clock Clock) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+
+	var req RecoveryRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	// Store and book the recovery in one unit of work, so a client retrying
+	// after a failure cannot record it twice
+	var loan *Loan
+	var recovery *Recovery
+	err := repo.WithTx(ctx, func(tx LoanRepository) error {
+		var err error
+		if loan, err = tx.GetByID(ctx, id); err != nil {
+			return orInternal(err, "Failed to retrieve loan")
+		}
+
+		if recovery, err = loan.RecordRecovery(req.Amount, clock.Now()); err != nil {
+			return orInternal(err, "Failed to record recovery")
+		}
+
+		if err := tx.Update(ctx, loan); err != nil {
+			return orInternal(err, "Failed to update loan")
+		}
+
+		sequence := len(loan.Recoveries)
+		if err := tx.PostJournalEntry(ctx, RecoveryEntry(loan, sequence, recovery, chart)); err != nil {
+			return orInternal(err, "Failed to record journal entry")
+		}
+		return nil
+	})
+	if err != nil {
+		return orInternal(err, "Failed to record recovery")
+	}
+
+	return c.JSON(http.StatusCreated, RecoveryResponse{
+		Recovery:            *recovery,
+		TotalRecovered:      loan.RecoveredAmount(),
+		RemainingWrittenOff: loan.WrittenOffAmount - loan.RecoveredAmount(),
+	})
+}
+
+func restructureLoanHandler(c echo.Context, repo LoanRepository, dueDates DueDatePolicy, clock Clock) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+
+	var req RestructureRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	var loan *Loan
+	err := repo.WithTx(ctx, func(tx LoanRepository) error {
+		var err error
+		if loan, err = tx.GetByID(ctx, id); err != nil {
+			return orInternal(err, "Failed to retrieve loan")
+		}
+
+		_, err = loan.Restructure(RestructureOptions{
+			ExtendWeeks:       req.ExtendWeeks,
+			InstallmentAmount: req.InstallmentAmount,
+			HolidayWeeks:      req.HolidayWeeks,
+			Reason:            req.Reason,
+			DueDates:          dueDates,
+		}, clock.Now())
+		if err != nil {
+			return orInternal(err, "Failed to restructure loan")
+		}
+
+		if err := tx.Update(ctx, loan); err != nil {
+			return orInternal(err, "Failed to update loan")
+		}
+		return nil
+	})
+	if err != nil {
+		return orInternal(err, "Failed to restructure loan")
+	}
+
+	return c.JSON(http.StatusOK, loan)
+}
+
+func deferWeeksHandler(c echo.Context, repo LoanRepository, dueDates DueDatePolicy, clock Clock) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+
+	var req DeferralRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	var loan *Loan
+	err := repo.WithTx(ctx, func(tx LoanRepository) error {
+		var err error
+		if loan, err = tx.GetByID(ctx, id); err != nil {
+			return orInternal(err, "Failed to retrieve loan")
+		}
+
+		if _, err := loan.DeferWeeks(req.Weeks, req.Reason, dueDates, clock.Now()); err != nil {
+			return orInternal(err, "Failed to defer installments")
+		}
+
+		if err := tx.Update(ctx, loan); err != nil {
+			return orInternal(err, "Failed to update loan")
+		}
+		return nil
+	})
+	if err != nil {
+		return orInternal(err, "Failed to defer installments")
+	}
+
+	return c.JSON(http.StatusOK, loan)
+}
+
+func refinanceLoanHandler(c echo.Context, repo LoanRepository, chart ChartOfAccounts, dueDates DueDatePolicy, clock Clock, ids *IDGenerator) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+
+	var req RefinanceRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	// Default annual rate
+	if req.AnnualRate == 0 {
+		req.AnnualRate = 0.10
+	}
+
+	old, err := repo.GetByID(ctx, id)
+	if err != nil {
+		return orInternal(err, "Failed to retrieve loan")
+	}
+
+	now := clock.Now()
+	startDate := dayStart(now.In(old.Location()))
+	if req.StartDate != "" {
+		startDate, err = time.ParseInLocation("2006-01-02", req.StartDate, old.Location())
+		if err != nil {
+			return ErrInvalidRequest
+		}
+	}
+
+	newID, err := ids.NewLoanID()
+	if err != nil {
+		return orInternal(err, "Failed to generate loan ID")
+	}
+
+	loan, refinancing, err := refinanceLoan(ctx, repo, chart, dueDates, old, newID, req.Principal, req.AnnualRate, startDate, now)
+	if err != nil {
+		return orInternal(err, "Failed to refinance loan")
+	}
+
+	return c.JSON(http.StatusCreated, RefinanceResponse{Refinancing: refinancing, Loan: loan})
+}
+
+func getLoanInterestHandler(c echo.Context, repo LoanRepository) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+
+	loan, err := repo.GetByID(ctx, id)
+	if err != nil {
+		return orInternal(err, "Failed to retrieve loan")
+	}
+
+	accruals, err := repo.ListAccruals(ctx, id)
+	if err != nil {
+		return orInternal(err, "Failed to retrieve accruals")
+	}
+
+	return c.JSON(http.StatusOK, LoanInterestResponse{
+		LoanID:          id,
+		InterestSummary: SummarizeInterest(loan, accruals),
+	})
+}
+
+func getPortfolioInterestHandler(c echo.Context, repo LoanRepository) error {
+	ctx := c.Request().Context()
+	loans, err := repo.List(ctx, LoanFilter{})
+	if err != nil {
+		return orInternal(err, "Failed to list loans")
+	}
+
+	var response PortfolioInterestResponse
+	for _, summary := range loans {
+		loan, err := repo.GetByID(ctx, summary.ID)
+		if err != nil {
+			return orInternal(err, "Failed to retrieve loan")
+		}
+		accruals, err := repo.ListAccruals(ctx, loan.ID)
+		if err != nil {
+			return orInternal(err, "Failed to retrieve accruals")
+		}
+
+		interest := SummarizeInterest(loan, accruals)
+		response.Loans++
+		response.TotalInterest += interest.TotalInterest
+		response.AccruedInterest += interest.AccruedInterest
+		response.CollectedInterest += interest.CollectedInterest
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func chargeFeeHandler(c echo.Context, repo LoanRepository, chart ChartOfAccounts, clock Clock) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+
+	var req FeeRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	var entry *JournalEntry
+	err := repo.WithTx(ctx, func(tx LoanRepository) error {
+		loan, err := tx.GetByID(ctx, id)
+		if err != nil {
+			return orInternal(err, "Failed to retrieve loan")
+		}
+		if loan.Status == LoanStatusWrittenOff {
+			return ErrLoanWrittenOff
+		}
+
+		entry = FeeEntry(loan, req.Reference, req.Amount, clock.Now(), chart)
+		return postNewJournalEntry(ctx, tx, entry)
+	})
+	if err != nil {
+		return orInternal(err, "Failed to charge fee")
+	}
+
+	return c.JSON(http.StatusCreated, entry)
+}
+
+func reverseJournalEntryHandler(c echo.Context, repo LoanRepository, clock Clock) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+
+	var reversal *JournalEntry
+	err := repo.WithTx(ctx, func(tx LoanRepository) error {
+		entry, err := tx.GetJournalEntry(ctx, id)
+		if err != nil {
+			return orInternal(err, "Failed to retrieve journal entry")
+		}
+		if entry.Event == JournalEventReversal {
+			return ErrReversalNotAllowed
+		}
+
+		reversal = ReversalEntry(entry, clock.Now())
+		return postNewJournalEntry(ctx, tx, reversal)
+	})
+	if err != nil {
+		return orInternal(err, "Failed to reverse journal entry")
+	}
+
+	return c.JSON(http.StatusCreated, reversal)
+}
+
+func getJournalHandler(c echo.Context, repo LoanRepository) error {
+	ctx := c.Request().Context()
+	from, to, err := parseJournalRange(c.QueryParam("from"), c.QueryParam("to"))
+	if err != nil {
+		return err
+	}
+
+	entries, err := repo.ListJournalEntries(ctx, from, to)
+	if err != nil {
+		return orInternal(err, "Failed to retrieve journal")
+	}
+
+	switch c.QueryParam("format") {
+	case "", "json":
+		if entries == nil {
+			entries = []*JournalEntry{}
+		}
+		return c.JSON(http.StatusOK, entries)
+	case "csv":
+		c.Response().Header().Set(echo.HeaderContentType, "text/csv")
+		c.Response().WriteHeader(http.StatusOK)
+		return WriteJournalCSV(c.Response(), entries)
+	default:
+		return ErrInvalidRequest
+	}
+}
+
+// parseValueDate parses a payment value date given either as a date, which is
+// the start of that day in loc, or as an RFC 3339 timestamp
+func parseValueDate(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func getClockHandler(c echo.Context, clock Clock) error {
+	_, simulated := clock.(*SimulatedClock)
+	return c.JSON(http.StatusOK, ClockResponse{Now: clock.Now(), Simulated: simulated})
+}
+
+func setClockHandler(c echo.Context, clock Clock) error {
+	var req ClockRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	simulated, ok := clock.(*SimulatedClock)
+	if !ok {
+		return ErrClockNotSimulated
+	}
+
+	switch {
+	case req.Now != "" && req.Advance == "":
+		now, err := parseClockTime(req.Now)
+		if err != nil {
+			return ErrInvalidRequest
+		}
+		simulated.Set(now)
+	case req.Advance != "" && req.Now == "":
+		d, err := time.ParseDuration(req.Advance)
+		if err != nil || d < 0 {
+			return ErrInvalidRequest
+		}
+		simulated.Advance(d)
+	default:
+		return ErrInvalidRequest
+	}
+
+	return c.JSON(http.StatusOK, ClockResponse{Now: simulated.Now(), Simulated: true})
 }
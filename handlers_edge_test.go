@@ -128,12 +128,15 @@ func TestWrongAmountAfterPayments(t *testing.T) {
 		t.Errorf("expected wrong amount to fail with 400, got %d", payRec2.Code)
 	}
 
-	var errorResp map[string]string
+	var errorResp ErrorResponse
 	if err := json.Unmarshal(payRec2.Body.Bytes(), &errorResp); err != nil {
 		t.Fatalf("failed to unmarshal error response: %v", err)
 	}
-	if errorResp["error"] != "amount must equal this week's payable" {
-		t.Errorf("expected specific error message, got %q", errorResp["error"])
+	if errorResp.Error != "amount must equal this week's payable" {
+		t.Errorf("expected specific error message, got %q", errorResp.Error)
+	}
+	if errorResp.Code != CodeWrongAmount {
+		t.Errorf("expected code %s, got %q", CodeWrongAmount, errorResp.Code)
 	}
 
 	// Then pay correct amount
@@ -279,18 +282,21 @@ func TestInvalidCreatePayloads(t *testing.T) {
 		body           string
 		expectedStatus int
 		expectedError  string
+		expectedField  string
 	}{
 		{
 			name:           "negative principal",
 			body:           `{"principal": -1, "annual_rate": 0.10, "start_date": "2025-08-01"}`,
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  "invalid request",
+			expectedField:  "principal",
 		},
 		{
 			name:           "bad date format",
 			body:           `{"principal": 5000000, "annual_rate": 0.10, "start_date": "2025-13-40"}`,
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  "invalid request",
+			expectedField:  "start_date",
 		},
 	}
 
@@ -306,12 +312,20 @@ func TestInvalidCreatePayloads(t *testing.T) {
 				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
 			}
 
-			var errorResp map[string]string
+			var errorResp struct {
+				Error   string `json:"error"`
+				Details struct {
+					Fields []FieldError `json:"fields"`
+				} `json:"details"`
+			}
 			if err := json.Unmarshal(rec.Body.Bytes(), &errorResp); err != nil {
 				t.Fatalf("failed to unmarshal response: %v", err)
 			}
-			if errorResp["error"] != tt.expectedError {
-				t.Errorf("expected error %q, got %q", tt.expectedError, errorResp["error"])
+			if errorResp.Error != tt.expectedError {
+				t.Errorf("expected error %q, got %q", tt.expectedError, errorResp.Error)
+			}
+			if fields := errorResp.Details.Fields; len(fields) != 1 || fields[0].Field != tt.expectedField {
+				t.Errorf("expected a field error for %s, got %+v", tt.expectedField, fields)
 			}
 		})
 	}
@@ -1,23 +1,37 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func setupTestServer() *echo.Echo {
+	e := newServer()
+	if !sqliteSupported {
+		// Without cgo the API is tested against the memory backend
+		registerRoutes(e, NewMemoryLoanRepository(), defaultServiceConfig())
+		return e
+	}
+
 	// Create in-memory database
 	db, err := sql.Open("sqlite3", ":memory:")
 	if err != nil {
 		panic(err)
 	}
+	// A single connection keeps every request on the same in-memory database
+	db.SetMaxOpenConns(1)
 
 	// Initialize schema
 	if err := InitDatabase(db); err != nil {
@@ -27,12 +41,7 @@ func setupTestServer() *echo.Echo {
 	// Create repository
 	repo := NewSQLiteLoanRepository(db)
 
-	e := echo.New()
-	e.POST("/loans", func(c echo.Context) error { return createLoanHandler(c, repo) })
-	e.GET("/loans/:id", func(c echo.Context) error { return getLoanHandler(c, repo) })
-	e.POST("/loans/:id/pay", func(c echo.Context) error { return payLoanHandler(c, repo) })
-	e.GET("/loans/:id/outstanding", func(c echo.Context) error { return getOutstandingHandler(c, repo) })
-	e.GET("/loans/:id/delinquent", func(c echo.Context) error { return getDelinquencyHandler(c, repo) })
+	registerRoutes(e, repo, defaultServiceConfig())
 	return e
 }
 
@@ -67,12 +76,12 @@ func TestCreateLoanAPI(t *testing.T) {
 			body:           `{"principal": -1000000, "annual_rate": 0.10, "start_date": "2025-08-15"}`,
 			expectedStatus: http.StatusBadRequest,
 			checkResponse: func(t *testing.T, body string) {
-				var resp map[string]string
+				var resp ErrorResponse
 				if err := json.Unmarshal([]byte(body), &resp); err != nil {
 					t.Fatalf("failed to unmarshal response: %v", err)
 				}
-				if resp["error"] != "invalid request" {
-					t.Errorf("expected error 'invalid request', got %q", resp["error"])
+				if resp.Error != "invalid request" {
+					t.Errorf("expected error 'invalid request', got %q", resp.Error)
 				}
 			},
 		},
@@ -95,12 +104,12 @@ func TestCreateLoanAPI(t *testing.T) {
 			body:           `{"principal": 5000000, "annual_rate": 0.10, "start_date": "invalid-date"}`,
 			expectedStatus: http.StatusBadRequest,
 			checkResponse: func(t *testing.T, body string) {
-				var resp map[string]string
+				var resp ErrorResponse
 				if err := json.Unmarshal([]byte(body), &resp); err != nil {
 					t.Fatalf("failed to unmarshal response: %v", err)
 				}
-				if resp["error"] != "invalid request" {
-					t.Errorf("expected error 'invalid request', got %q", resp["error"])
+				if resp.Error != "invalid request" {
+					t.Errorf("expected error 'invalid request', got %q", resp.Error)
 				}
 			},
 		},
@@ -171,12 +180,15 @@ func TestPaymentAPI(t *testing.T) {
 			body:           `{"amount": 100000}`,
 			expectedStatus: http.StatusBadRequest,
 			checkResponse: func(t *testing.T, body string) {
-				var resp map[string]string
+				var resp ErrorResponse
 				if err := json.Unmarshal([]byte(body), &resp); err != nil {
 					t.Fatalf("failed to unmarshal response: %v", err)
 				}
-				if resp["error"] != "amount must equal this week's payable" {
-					t.Errorf("expected error 'amount must equal this week's payable', got %q", resp["error"])
+				if resp.Error != "amount must equal this week's payable" {
+					t.Errorf("expected error 'amount must equal this week's payable', got %q", resp.Error)
+				}
+				if resp.Details["expected_amount"] != float64(110000) {
+					t.Errorf("expected expected_amount 110000 in details, got %v", resp.Details)
 				}
 			},
 		},
@@ -364,3 +376,1446 @@ func TestDelinquencyAPI(t *testing.T) {
 		})
 	}
 }
+
+func TestConcurrentPaymentsAPI(t *testing.T) {
+	requireSQLite(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	// A single connection keeps every request on the same in-memory database
+	db.SetMaxOpenConns(1)
+
+	if err := InitDatabase(db); err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+
+	repo := NewSQLiteLoanRepository(db)
+	e := newServer()
+	registerRoutes(e, repo, defaultServiceConfig())
+
+	createReq := httptest.NewRequest(http.MethodPost, "/loans",
+		strings.NewReader(`{"principal": 5000000, "annual_rate": 0.10, "start_date": "2025-08-15"}`))
+	createReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	createRec := httptest.NewRecorder()
+	e.ServeHTTP(createRec, createReq)
+
+	var loan Loan
+	if err := json.Unmarshal(createRec.Body.Bytes(), &loan); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+
+	const payments = 10
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		paidWeeks = map[int]bool{}
+		succeeded int
+	)
+	for i := 0; i < payments; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/loans/"+loan.ID+"/pay", strings.NewReader(`{"amount": 110000}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch rec.Code {
+			case http.StatusOK:
+				var resp PaymentResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Errorf("failed to unmarshal response: %v", err)
+					return
+				}
+				if paidWeeks[resp.PaidWeek] {
+					t.Errorf("week %d settled by more than one payment", resp.PaidWeek)
+				}
+				paidWeeks[resp.PaidWeek] = true
+				succeeded++
+			default:
+				t.Errorf("unexpected status %d: %s", rec.Code, rec.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	stored, err := repo.GetByID(context.Background(), loan.ID)
+	if err != nil {
+		t.Fatalf("failed to get loan: %v", err)
+	}
+	// Payments queue up behind each other, so none of them is lost
+	if succeeded != payments {
+		t.Errorf("expected all %d payments to succeed, got %d", payments, succeeded)
+	}
+	if stored.PaidCount != succeeded {
+		t.Errorf("expected paid count %d to match successful payments, got %d", succeeded, stored.PaidCount)
+	}
+	if stored.GetOutstanding() != 5_500_000-int64(succeeded)*110_000 {
+		t.Errorf("outstanding %d does not match %d successful payments", stored.GetOutstanding(), succeeded)
+	}
+	for week := 1; week <= succeeded; week++ {
+		if !paidWeeks[week] {
+			t.Errorf("expected week %d to be paid", week)
+		}
+	}
+}
+
+// TestConcurrentPaymentsStressAPI pays several loans at once against a
+// database file opened like the server opens it, with reads alongside, and
+// expects every payment to land without the database reporting it is locked
+func TestConcurrentPaymentsStressAPI(t *testing.T) {
+	requireSQLite(t)
+	dbCfg := databaseConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "pinjol.db"), QueryTimeout: 5 * time.Second}
+	repo, closeRepo, err := dbCfg.OpenRepository("", SystemClock)
+	if err != nil {
+		t.Fatalf("failed to open repository: %v", err)
+	}
+	defer closeRepo()
+
+	e := newServer()
+	registerRoutes(e, repo, defaultServiceConfig())
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	const loans, payers = 8, 12
+	ids := make([]string, loans)
+	for i := range ids {
+		rec := do(http.MethodPost, "/loans", `{"principal": 5000000, "annual_rate": 0.10, "start_date": "2025-08-15"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var loan Loan
+		if err := json.Unmarshal(rec.Body.Bytes(), &loan); err != nil {
+			t.Fatalf("failed to unmarshal loan: %v", err)
+		}
+		ids[i] = loan.ID
+	}
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		for i := 0; i < payers; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if rec := do(http.MethodPost, "/loans/"+id+"/pay", `{"amount": 110000}`); rec.Code != http.StatusOK {
+					t.Errorf("payment on %s: unexpected status %d: %s", id, rec.Code, rec.Body.String())
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				if rec := do(http.MethodGet, "/loans/"+id+"/outstanding", ""); rec.Code != http.StatusOK {
+					t.Errorf("read of %s: unexpected status %d: %s", id, rec.Code, rec.Body.String())
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		stored, err := repo.GetByID(context.Background(), id)
+		if err != nil {
+			t.Fatalf("failed to get loan: %v", err)
+		}
+		if stored.PaidCount != payers || stored.Version != payers {
+			t.Errorf("loan %s: expected %d payments at version %d, got %d at version %d", id, payers, payers, stored.PaidCount, stored.Version)
+		}
+		if stored.GetOutstanding() != 5_500_000-payers*110_000 {
+			t.Errorf("loan %s: outstanding %d does not match %d payments", id, stored.GetOutstanding(), payers)
+		}
+	}
+}
+
+func TestJournalAPI(t *testing.T) {
+	e := setupTestServer()
+
+	createReq := httptest.NewRequest(http.MethodPost, "/loans",
+		strings.NewReader(`{"principal": 5000000, "annual_rate": 0.10, "start_date": "2025-08-15"}`))
+	createReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	createRec := httptest.NewRecorder()
+	e.ServeHTTP(createRec, createReq)
+
+	var loan Loan
+	if err := json.Unmarshal(createRec.Body.Bytes(), &loan); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+
+	// Disbursement is booked on the start date
+	req := httptest.NewRequest(http.MethodGet, "/journal?from=2025-08-15&to=2025-08-15", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var entries []JournalEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("failed to unmarshal journal: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Event != JournalEventDisbursement || entries[0].LoanID != loan.ID {
+		t.Fatalf("expected one disbursement entry for %s, got %+v", loan.ID, entries)
+	}
+
+	// Payments are booked when they are received
+	payReq := httptest.NewRequest(http.MethodPost, "/loans/"+loan.ID+"/pay", strings.NewReader(`{"amount": 110000}`))
+	payReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	payRec := httptest.NewRecorder()
+	e.ServeHTTP(payRec, payReq)
+	if payRec.Code != http.StatusOK {
+		t.Fatalf("payment failed with status %d", payRec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/journal?from=2000-01-01&to=2999-12-31", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	entries = nil
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("failed to unmarshal journal: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 journal entries, got %d", len(entries))
+	}
+	balances := map[string]int64{}
+	for _, entry := range entries {
+		for _, line := range entry.Lines {
+			balances[line.Account] += line.Debit - line.Credit
+		}
+	}
+	chart := DefaultChartOfAccounts()
+	if balances[chart.LoanReceivable] != 4_900_000 {
+		t.Errorf("expected loan receivable balance 4900000, got %d", balances[chart.LoanReceivable])
+	}
+	if balances[chart.Cash] != -4_890_000 {
+		t.Errorf("expected cash balance -4890000, got %d", balances[chart.Cash])
+	}
+	if balances[chart.InterestReceivable] != -10_000 {
+		t.Errorf("expected interest receivable balance -10000, got %d", balances[chart.InterestReceivable])
+	}
+
+	// CSV export
+	req = httptest.NewRequest(http.MethodGet, "/journal?from=2025-08-15&to=2025-08-15&format=csv", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for csv, got %d", rec.Code)
+	}
+	if !strings.HasPrefix(rec.Body.String(), "entry_id,posted_at,loan_id,event,account,debit,credit\n") {
+		t.Errorf("unexpected csv output %q", rec.Body.String())
+	}
+
+	// Invalid ranges
+	for _, query := range []string{"", "?from=2025-08-15", "?from=2025-08-15&to=2025-08-01", "?from=2025-08-01&to=2025-08-15&format=xml"} {
+		req = httptest.NewRequest(http.MethodGet, "/journal"+query, nil)
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for %q, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestFeeAndReversalAPI(t *testing.T) {
+	e := setupTestServer()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/loans", `{"principal": 5000000, "annual_rate": 0.10, "start_date": "2025-08-15"}`)
+	var loan Loan
+	if err := json.Unmarshal(rec.Body.Bytes(), &loan); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+
+	// Fees are booked as fee income, once per reference
+	rec = do(http.MethodPost, "/loans/"+loan.ID+"/fees", `{"reference": "admin-1", "amount": 25000}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 for fee, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var fee JournalEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &fee); err != nil {
+		t.Fatalf("failed to unmarshal fee entry: %v", err)
+	}
+	chart := DefaultChartOfAccounts()
+	if fee.Event != JournalEventFee || fee.Lines[1].Account != chart.FeeIncome || fee.Lines[1].Credit != 25_000 {
+		t.Errorf("unexpected fee entry %+v", fee)
+	}
+	if rec = do(http.MethodPost, "/loans/"+loan.ID+"/fees", `{"reference": "admin-1", "amount": 25000}`); rec.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for a repeated fee, got %d", rec.Code)
+	}
+	if rec = do(http.MethodPost, "/loans/missing/fees", `{"reference": "admin-1", "amount": 25000}`); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a fee on a missing loan, got %d", rec.Code)
+	}
+	if rec = do(http.MethodPost, "/loans/"+loan.ID+"/fees", `{"amount": 25000}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a fee without reference, got %d", rec.Code)
+	}
+
+	// Reversing the fee cancels it in the ledger, once
+	rec = do(http.MethodPost, "/journal/"+fee.ID+"/reverse", "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 for reversal, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var reversal JournalEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &reversal); err != nil {
+		t.Fatalf("failed to unmarshal reversal entry: %v", err)
+	}
+	if reversal.ID != fee.ID+"_reversal" || reversal.Event != JournalEventReversal {
+		t.Errorf("unexpected reversal entry %+v", reversal)
+	}
+	if rec = do(http.MethodPost, "/journal/"+fee.ID+"/reverse", ""); rec.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for a second reversal, got %d", rec.Code)
+	}
+	if rec = do(http.MethodPost, "/journal/"+reversal.ID+"/reverse", ""); rec.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for reversing a reversal, got %d", rec.Code)
+	}
+	if rec = do(http.MethodPost, "/journal/je_missing/reverse", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a missing entry, got %d", rec.Code)
+	}
+
+	rec = do(http.MethodGet, "/journal?from=2000-01-01&to=2999-12-31", "")
+	var entries []JournalEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("failed to unmarshal journal: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected disbursement, fee and reversal entries, got %d", len(entries))
+	}
+	balances := map[string]int64{}
+	for _, entry := range entries {
+		for _, line := range entry.Lines {
+			balances[line.Account] += line.Debit - line.Credit
+		}
+	}
+	if balances[chart.FeeIncome] != 0 || balances[chart.Cash] != -5_000_000 {
+		t.Errorf("expected the fee to net out, got fee income %d and cash %d", balances[chart.FeeIncome], balances[chart.Cash])
+	}
+}
+
+func TestInterestAPI(t *testing.T) {
+	requireSQLite(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := InitDatabase(db); err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+
+	repo := NewSQLiteLoanRepository(db)
+	e := newServer()
+	registerRoutes(e, repo, defaultServiceConfig())
+
+	createReq := httptest.NewRequest(http.MethodPost, "/loans",
+		strings.NewReader(`{"principal": 5000000, "annual_rate": 0.10, "start_date": "2025-08-01"}`))
+	createReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	createRec := httptest.NewRecorder()
+	e.ServeHTTP(createRec, createReq)
+
+	var loan Loan
+	if err := json.Unmarshal(createRec.Body.Bytes(), &loan); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+
+	payReq := httptest.NewRequest(http.MethodPost, "/loans/"+loan.ID+"/pay", strings.NewReader(`{"amount": 110000}`))
+	payReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	e.ServeHTTP(httptest.NewRecorder(), payReq)
+
+	// Accrue the first two weeks
+	if _, err := RunInterestAccrual(context.Background(), repo, DefaultChartOfAccounts(), AccrualStraightLine, time.Date(2025, 8, 14, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("accrual failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/loans/"+loan.ID+"/interest", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var resp LoanInterestResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if resp.TotalInterest != 500_000 {
+		t.Errorf("expected total interest 500000, got %d", resp.TotalInterest)
+	}
+	if resp.AccruedInterest != 20_000 {
+		t.Errorf("expected accrued interest 20000 after 14 days, got %d", resp.AccruedInterest)
+	}
+	if resp.CollectedInterest != 10_000 {
+		t.Errorf("expected collected interest 10000, got %d", resp.CollectedInterest)
+	}
+	if resp.AccruedThrough == nil || !resp.AccruedThrough.Equal(time.Date(2025, 8, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected accrued through 2025-08-14, got %v", resp.AccruedThrough)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/portfolio/interest", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var portfolio PortfolioInterestResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &portfolio); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if portfolio.Loans != 1 || portfolio.AccruedInterest != 20_000 || portfolio.CollectedInterest != 10_000 {
+		t.Errorf("unexpected portfolio summary %+v", portfolio)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/loans/nonexistent/interest", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestWriteOffAndRecoveryAPI(t *testing.T) {
+	e := setupTestServer()
+
+	createReq := httptest.NewRequest(http.MethodPost, "/loans",
+		strings.NewReader(`{"principal": 5000000, "annual_rate": 0.10, "start_date": "2025-08-01"}`))
+	createReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	createRec := httptest.NewRecorder()
+	e.ServeHTTP(createRec, createReq)
+
+	var loan Loan
+	if err := json.Unmarshal(createRec.Body.Bytes(), &loan); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+
+	postRecovery := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/loans/"+loan.ID+"/recoveries", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := postRecovery(`{"amount": 100000}`); rec.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for recovery on active loan, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/loans/"+loan.ID+"/write-off", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var writtenOff Loan
+	if err := json.Unmarshal(rec.Body.Bytes(), &writtenOff); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+	if writtenOff.Status != LoanStatusWrittenOff || writtenOff.WrittenOffAmount != 5_500_000 {
+		t.Errorf("unexpected loan after write-off: status %s, written off %d", writtenOff.Status, writtenOff.WrittenOffAmount)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/loans/"+loan.ID+"/write-off", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for second write-off, got %d", rec.Code)
+	}
+
+	payReq := httptest.NewRequest(http.MethodPost, "/loans/"+loan.ID+"/pay", strings.NewReader(`{"amount": 110000}`))
+	payReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	payRec := httptest.NewRecorder()
+	e.ServeHTTP(payRec, payReq)
+	if payRec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for payment on written-off loan, got %d", payRec.Code)
+	}
+
+	rec = postRecovery(`{"amount": 250000}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp RecoveryResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if resp.Recovery.ID == 0 || resp.TotalRecovered != 250_000 || resp.RemainingWrittenOff != 5_250_000 {
+		t.Errorf("unexpected recovery response %+v", resp)
+	}
+
+	if rec := postRecovery(`{"amount": 6000000}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for recovery above written-off balance, got %d", rec.Code)
+	}
+	if rec := postRecovery(`{"amount": -1}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for negative recovery, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/journal?from=2025-01-01&to=2099-12-31", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var entries []JournalEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("failed to unmarshal journal: %v", err)
+	}
+	events := map[JournalEvent]int{}
+	for _, entry := range entries {
+		events[entry.Event]++
+	}
+	if events[JournalEventWriteOff] != 1 || events[JournalEventRecovery] != 1 {
+		t.Errorf("expected one write-off and one recovery entry, got %v", events)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/loans/nonexistent/write-off", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestRestructureAPI(t *testing.T) {
+	e := setupTestServer()
+
+	createReq := httptest.NewRequest(http.MethodPost, "/loans",
+		strings.NewReader(`{"principal": 5000000, "annual_rate": 0.10, "start_date": "2025-08-01"}`))
+	createReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	createRec := httptest.NewRecorder()
+	e.ServeHTTP(createRec, createReq)
+
+	var loan Loan
+	if err := json.Unmarshal(createRec.Body.Bytes(), &loan); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+
+	restructure := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/loans/"+id+"/restructure", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := restructure(loan.ID, `{"extend_weeks": 10, "holiday_weeks": 1, "reason": "job loss"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var restructured Loan
+	if err := json.Unmarshal(rec.Body.Bytes(), &restructured); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+	if len(restructured.Schedule) != 60 || restructured.WeeklyDue != 91_666 {
+		t.Errorf("expected 60 weeks of 91666, got %d weeks of %d", len(restructured.Schedule), restructured.WeeklyDue)
+	}
+	if restructured.Outstanding != 5_500_000 {
+		t.Errorf("expected outstanding 5500000, got %d", restructured.Outstanding)
+	}
+	if len(restructured.Restructures) != 1 || restructured.Restructures[0].Reason != "job loss" {
+		t.Errorf("unexpected restructures %+v", restructured.Restructures)
+	}
+
+	// The new installment is what the next payment must match
+	payReq := httptest.NewRequest(http.MethodPost, "/loans/"+loan.ID+"/pay", strings.NewReader(`{"amount": 91666}`))
+	payReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	payRec := httptest.NewRecorder()
+	e.ServeHTTP(payRec, payReq)
+	if payRec.Code != http.StatusOK {
+		t.Errorf("expected status 200 for payment, got %d: %s", payRec.Code, payRec.Body.String())
+	}
+
+	if rec := restructure(loan.ID, `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for empty restructure, got %d", rec.Code)
+	}
+	if rec := restructure(loan.ID, `{"extend_weeks": 4, "installment_amount": 100000}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for conflicting terms, got %d", rec.Code)
+	}
+	if rec := restructure("nonexistent", `{"extend_weeks": 4}`); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestDeferralAPI(t *testing.T) {
+	e := setupTestServer()
+
+	createReq := httptest.NewRequest(http.MethodPost, "/loans",
+		strings.NewReader(`{"principal": 5000000, "annual_rate": 0.10, "start_date": "2025-08-01"}`))
+	createReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	createRec := httptest.NewRecorder()
+	e.ServeHTTP(createRec, createReq)
+
+	var loan Loan
+	if err := json.Unmarshal(createRec.Body.Bytes(), &loan); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+
+	deferWeeks := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/loans/"+id+"/deferrals", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := deferWeeks(loan.ID, `{"weeks": [1, 2], "reason": "Idul Fitri"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The deferral is persisted with the loan
+	req := httptest.NewRequest(http.MethodGet, "/loans/"+loan.ID, nil)
+	getRec := httptest.NewRecorder()
+	e.ServeHTTP(getRec, req)
+
+	var deferred Loan
+	if err := json.Unmarshal(getRec.Body.Bytes(), &deferred); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+	if len(deferred.Deferrals) != 1 || deferred.Deferrals[0].Reason != "Idul Fitri" || deferred.Deferrals[0].ID == 0 {
+		t.Errorf("unexpected deferrals %+v", deferred.Deferrals)
+	}
+	if !deferred.Schedule[48].Deferred || !deferred.Schedule[49].Deferred || deferred.Schedule[0].Deferred {
+		t.Error("expected the deferred weeks at the end of the schedule")
+	}
+	if !deferred.Schedule[0].DueDate.Equal(time.Date(2025, 8, 22, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected week 3 to come first, got due date %v", deferred.Schedule[0].DueDate)
+	}
+
+	if rec := deferWeeks(loan.ID, `{"weeks": [3]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without a reason, got %d", rec.Code)
+	}
+	if rec := deferWeeks(loan.ID, `{"weeks": [49], "reason": "again"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an already deferred week, got %d", rec.Code)
+	}
+	if rec := deferWeeks("nonexistent", `{"weeks": [3], "reason": "flood"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestRefinanceAPI(t *testing.T) {
+	e := setupTestServer()
+
+	// Start today so the loan is in good standing
+	today := time.Now().UTC().Format("2006-01-02")
+	createReq := httptest.NewRequest(http.MethodPost, "/loans",
+		strings.NewReader(`{"principal": 5000000, "annual_rate": 0.10, "start_date": "`+today+`"}`))
+	createReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	createRec := httptest.NewRecorder()
+	e.ServeHTTP(createRec, createReq)
+
+	var old Loan
+	if err := json.Unmarshal(createRec.Body.Bytes(), &old); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+
+	refinance := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/loans/"+id+"/refinance", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := refinance(old.ID, `{"principal": 5000000}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for principal below payoff, got %d", rec.Code)
+	}
+
+	rec := refinance(old.ID, `{"principal": 8000000}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp RefinanceResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if resp.Refinancing.Payoff != 5_500_000 || resp.Refinancing.NetDisbursement != 2_500_000 {
+		t.Errorf("unexpected refinancing %+v", resp.Refinancing)
+	}
+	if resp.Loan.RefinancedFrom != old.ID || resp.Loan.Principal != 8_000_000 {
+		t.Errorf("unexpected new loan %+v", resp.Loan)
+	}
+
+	// Lineage is visible on both loans
+	req := httptest.NewRequest(http.MethodGet, "/loans/"+old.ID, nil)
+	getRec := httptest.NewRecorder()
+	e.ServeHTTP(getRec, req)
+	var settled Loan
+	if err := json.Unmarshal(getRec.Body.Bytes(), &settled); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+	if settled.Status != LoanStatusRefinanced || settled.RefinancedBy != resp.Loan.ID || settled.Outstanding != 0 {
+		t.Errorf("unexpected settled loan: status %s, refinanced by %q, outstanding %d", settled.Status, settled.RefinancedBy, settled.Outstanding)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/loans/"+resp.Loan.ID, nil)
+	getRec = httptest.NewRecorder()
+	e.ServeHTTP(getRec, req)
+	if getRec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for new loan, got %d", getRec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/journal?from="+today+"&to="+today, nil)
+	jrec := httptest.NewRecorder()
+	e.ServeHTTP(jrec, req)
+	var entries []JournalEntry
+	if err := json.Unmarshal(jrec.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("failed to unmarshal journal: %v", err)
+	}
+	events := map[JournalEvent]int{}
+	for _, entry := range entries {
+		events[entry.Event]++
+	}
+	if events[JournalEventDisbursement] != 2 || events[JournalEventSettlement] != 1 {
+		t.Errorf("expected two disbursements and one settlement, got %v", events)
+	}
+
+	if rec := refinance(old.ID, `{"principal": 8000000}`); rec.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for refinanced loan, got %d", rec.Code)
+	}
+	if rec := refinance("nonexistent", `{"principal": 8000000}`); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestLoanTimezoneAPI(t *testing.T) {
+	e := setupTestServer()
+
+	createReq := httptest.NewRequest(http.MethodPost, "/loans",
+		strings.NewReader(`{"principal": 5000000, "annual_rate": 0.10, "start_date": "2025-08-01", "timezone": "Asia/Jakarta"}`))
+	createReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	createRec := httptest.NewRecorder()
+	e.ServeHTTP(createRec, createReq)
+	if createRec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", createRec.Code, createRec.Body.String())
+	}
+
+	var created Loan
+	if err := json.Unmarshal(createRec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+
+	// The stored loan keeps its time zone and local midnight due dates
+	req := httptest.NewRequest(http.MethodGet, "/loans/"+created.ID, nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var loan Loan
+	if err := json.Unmarshal(rec.Body.Bytes(), &loan); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+	if loan.Timezone != "Asia/Jakarta" {
+		t.Errorf("expected time zone Asia/Jakarta, got %q", loan.Timezone)
+	}
+	if !strings.Contains(rec.Body.String(), `"start_date":"2025-08-01T00:00:00+07:00"`) {
+		t.Errorf("expected start date at local midnight, got %s", rec.Body.String()[:200])
+	}
+	if !strings.Contains(rec.Body.String(), `"due_date":"2025-08-08T00:00:00+07:00"`) {
+		t.Error("expected first due date at local midnight")
+	}
+
+	// A bare date override is local midnight: week 2 falls due at 2025-08-15 00:00 WIB
+	req = httptest.NewRequest(http.MethodGet, "/loans/"+created.ID+"/delinquent?now=2025-08-15", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var resp DelinquencyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if !resp.Delinquent || resp.ObservedWeek != 3 {
+		t.Errorf("expected delinquent in week 3, got %+v", resp)
+	}
+
+	createReq = httptest.NewRequest(http.MethodPost, "/loans",
+		strings.NewReader(`{"principal": 5000000, "start_date": "2025-08-01", "timezone": "Mars/Olympus_Mons"}`))
+	createReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	createRec = httptest.NewRecorder()
+	e.ServeHTTP(createRec, createReq)
+	if createRec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for unknown time zone, got %d", createRec.Code)
+	}
+}
+
+func TestSimulatedClockAPI(t *testing.T) {
+	requireSQLite(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := InitDatabase(db); err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+
+	clock := NewSimulatedClock(time.Date(2025, 8, 1, 9, 0, 0, 0, time.UTC))
+	cfg := defaultServiceConfig()
+	cfg.Clock = clock
+
+	e := newServer()
+	registerRoutes(e, NewSQLiteLoanRepository(db).WithClock(clock), cfg)
+	registerAdminRoutes(e, clock)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/loans", `{"principal": 5000000, "start_date": "2025-08-01"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var loan Loan
+	if err := json.Unmarshal(rec.Body.Bytes(), &loan); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+
+	// Jump past two missed installments; the delinquency check follows the clock
+	rec = do(http.MethodPost, "/admin/clock", `{"advance": "360h"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var clockResp ClockResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &clockResp); err != nil {
+		t.Fatalf("failed to unmarshal clock: %v", err)
+	}
+	if want := time.Date(2025, 8, 16, 9, 0, 0, 0, time.UTC); !clockResp.Now.Equal(want) || !clockResp.Simulated {
+		t.Errorf("expected simulated time %v, got %+v", want, clockResp)
+	}
+
+	rec = do(http.MethodGet, "/loans/"+loan.ID+"/delinquent", "")
+	var delinquency DelinquencyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &delinquency); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if !delinquency.Delinquent || delinquency.ObservedWeek != 3 {
+		t.Errorf("expected delinquent in week 3, got %+v", delinquency)
+	}
+
+	// Payments are stamped with the simulated time
+	rec = do(http.MethodPost, "/loans/"+loan.ID+"/pay", `{"amount": 110000}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = do(http.MethodGet, "/loans/"+loan.ID, "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &loan); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+	if paidAt := loan.Schedule[0].PaidAt; paidAt == nil || !paidAt.Equal(clock.Now()) {
+		t.Errorf("expected week 1 paid at %v, got %v", clock.Now(), paidAt)
+	}
+
+	rec = do(http.MethodPost, "/admin/clock", `{"now": "2025-08-01"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/admin/clock", `{"advance": "-1h"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for moving backwards, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/admin/clock", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without a time, got %d", rec.Code)
+	}
+
+	// The real clock cannot be moved
+	live := newServer()
+	registerAdminRoutes(live, SystemClock)
+	req := httptest.NewRequest(http.MethodPost, "/admin/clock", strings.NewReader(`{"advance": "1h"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	live.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for the system clock, got %d", rec.Code)
+	}
+}
+
+func TestBackdatedPaymentAPI(t *testing.T) {
+	requireSQLite(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := InitDatabase(db); err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+
+	clock := NewSimulatedClock(time.Date(2025, 8, 16, 9, 0, 0, 0, time.UTC))
+	cfg := defaultServiceConfig()
+	cfg.Clock = clock
+
+	e := newServer()
+	repo := NewSQLiteLoanRepository(db).WithClock(clock)
+	registerRoutes(e, repo, cfg)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/loans", `{"principal": 5000000, "start_date": "2025-08-01"}`)
+	var loan Loan
+	if err := json.Unmarshal(rec.Body.Bytes(), &loan); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+	pay := func(body string) *httptest.ResponseRecorder {
+		return do(http.MethodPost, "/loans/"+loan.ID+"/pay", body)
+	}
+
+	invalid := []string{
+		`{"amount": 110000, "paid_at": "2025-08-17"}`,           // in the future
+		`{"amount": 110000, "paid_at": "2025-08-08"}`,           // beyond the 7 day limit
+		`{"amount": 110000, "paid_at": "2025-07-31"}`,           // before the loan start
+		`{"amount": 110000, "paid_at": "the day before today"}`, // not a date
+	}
+	for _, body := range invalid {
+		if rec := pay(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for %s, got %d", body, rec.Code)
+		}
+	}
+
+	// Week 1 settled on 2025-08-14, two days before it was reported
+	if rec := pay(`{"amount": 110000, "paid_at": "2025-08-14"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := pay(`{"amount": 110000, "paid_at": "2025-08-13T10:00:00Z"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a value date before the previous payment, got %d", rec.Code)
+	}
+
+	stored, err := repo.GetByID(context.Background(), loan.ID)
+	if err != nil {
+		t.Fatalf("failed to get loan: %v", err)
+	}
+	want := time.Date(2025, 8, 14, 0, 0, 0, 0, time.UTC)
+	if paidAt := stored.Schedule[0].PaidAt; paidAt == nil || !paidAt.Equal(want) {
+		t.Errorf("expected week 1 paid at %v, got %v", want, paidAt)
+	}
+	if dpd := stored.DaysPastDue(time.Date(2025, 8, 14, 0, 0, 0, 0, time.UTC)); dpd != 0 {
+		t.Errorf("expected no days past due on 2025-08-14, got %d", dpd)
+	}
+
+	// The payment is booked on its value date
+	entries, err := repo.ListJournalEntries(context.Background(), want, want.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("failed to list journal entries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Event != JournalEventPayment {
+		t.Errorf("expected the payment booked on 2025-08-14, got %+v", entries)
+	}
+}
+
+func TestCreateLoanIDs(t *testing.T) {
+	e := setupTestServer()
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/loans", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := create(`{"id": "partner-0001", "principal": 5000000, "start_date": "2025-08-01"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := create(`{"id": "partner-0001", "principal": 5000000, "start_date": "2025-08-01"}`); rec.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for a duplicate ID, got %d", rec.Code)
+	}
+	if rec := create(`{"id": "../loans", "principal": 5000000, "start_date": "2025-08-01"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid ID, got %d", rec.Code)
+	}
+
+	// Loans created concurrently all get distinct IDs
+	const loans = 20
+	codes := make(chan int, loans)
+	var wg sync.WaitGroup
+	for i := 0; i < loans; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- create(`{"principal": 5000000, "start_date": "2025-08-01"}`).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusCreated {
+			t.Errorf("expected status 201, got %d", code)
+		}
+	}
+}
+
+func TestExternalIDAPI(t *testing.T) {
+	e := setupTestServer()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/loans", `{"principal": 5000000, "start_date": "2025-08-01", "external_id": "KTR-2025-0001"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created Loan
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+	if created.ExternalID != "KTR-2025-0001" {
+		t.Errorf("expected external_id KTR-2025-0001, got %q", created.ExternalID)
+	}
+
+	rec = do(http.MethodPost, "/loans", `{"principal": 5000000, "start_date": "2025-08-01", "external_id": "KTR-2025-0001"}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for a duplicate external_id, got %d", rec.Code)
+	}
+	rec = do(http.MethodPost, "/loans", `{"principal": 5000000, "start_date": "2025-08-01", "external_id": "`+strings.Repeat("x", 65)+`"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an overlong external_id, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/loans", `{"principal": 5000000, "start_date": "2025-08-01"}`); rec.Code != http.StatusCreated {
+		t.Errorf("expected status 201 without external_id, got %d", rec.Code)
+	}
+
+	rec = do(http.MethodGet, "/loans/by-ref/KTR-2025-0001", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var loan Loan
+	if err := json.Unmarshal(rec.Body.Bytes(), &loan); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+	if loan.ID != created.ID || len(loan.Schedule) != 50 {
+		t.Errorf("expected loan %s with its schedule, got %s", created.ID, loan.ID)
+	}
+	if rec := do(http.MethodGet, "/loans/by-ref/KTR-2025-9999", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown reference, got %d", rec.Code)
+	}
+
+	var loans []Loan
+	rec = do(http.MethodGet, "/loans?external_id=KTR-2025-0001", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &loans); err != nil {
+		t.Fatalf("failed to unmarshal loans: %v", err)
+	}
+	if len(loans) != 1 || loans[0].ID != created.ID {
+		t.Errorf("expected only loan %s, got %+v", created.ID, loans)
+	}
+
+	rec = do(http.MethodGet, "/loans?external_id=KTR-2025-9999", "")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("expected an empty list for an unknown reference, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = do(http.MethodGet, "/loans", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &loans); err != nil {
+		t.Fatalf("failed to unmarshal loans: %v", err)
+	}
+	if len(loans) != 2 {
+		t.Errorf("expected 2 loans, got %d", len(loans))
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	requireSQLite(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := InitDatabase(db); err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+
+	e := newServer()
+	e.Use(middleware.RequestID())
+	registerRoutes(e, NewSQLiteLoanRepository(db), defaultServiceConfig())
+
+	do := func(method, path, body string) (int, ErrorResponse) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		var resp ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to unmarshal error response: %v", err)
+		}
+		if resp.RequestID == "" || resp.RequestID != rec.Header().Get(echo.HeaderXRequestID) {
+			t.Errorf("expected the request ID in the response, got %q", resp.RequestID)
+		}
+		return rec.Code, resp
+	}
+
+	tests := []struct {
+		name           string
+		method, path   string
+		body           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"unknown loan", http.MethodGet, "/loans/missing", "", http.StatusNotFound, CodeLoanNotFound},
+		{"malformed body", http.MethodPost, "/loans", `{"principal": "lots"}`, http.StatusBadRequest, CodeInvalidRequest},
+		{"unsupported product", http.MethodPost, "/loans", `{"principal": 5000001, "start_date": "2025-08-01"}`, http.StatusBadRequest, CodeUnsupportedProduct},
+		{"recovery on unknown loan", http.MethodPost, "/loans/missing/recoveries", `{"amount": 1}`, http.StatusNotFound, CodeLoanNotFound},
+		{"unknown route", http.MethodGet, "/nowhere", "", http.StatusNotFound, CodeNotFound},
+		{"wrong method", http.MethodDelete, "/loans", "", http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := do(tt.method, tt.path, tt.body)
+			if status != tt.expectedStatus || resp.Code != tt.expectedCode {
+				t.Errorf("expected %d %s, got %d %s (%s)", tt.expectedStatus, tt.expectedCode, status, resp.Code, resp.Error)
+			}
+		})
+	}
+
+	// A paid-off loan refuses payments as a bad request and write-offs as a conflict
+	loan, err := NewLoan("paid-off", 5_000_000, 0.10, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+	for range loan.Schedule {
+		if err := loan.MakePayment(loan.WeeklyDue, loan.StartDate); err != nil {
+			t.Fatalf("failed to make payment: %v", err)
+		}
+	}
+	if err := NewSQLiteLoanRepository(db).Create(context.Background(), loan); err != nil {
+		t.Fatalf("failed to store loan: %v", err)
+	}
+	if status, resp := do(http.MethodPost, "/loans/paid-off/pay", `{"amount": 110000}`); status != http.StatusBadRequest || resp.Code != CodeAlreadyPaid {
+		t.Errorf("expected 400 %s, got %d %s", CodeAlreadyPaid, status, resp.Code)
+	}
+	if status, resp := do(http.MethodPost, "/loans/paid-off/write-off", ""); status != http.StatusConflict || resp.Code != CodeAlreadyPaid {
+		t.Errorf("expected 409 %s, got %d %s", CodeAlreadyPaid, status, resp.Code)
+	}
+
+	// Internal failures are reported without leaking their cause
+	db.Close()
+	status, resp := do(http.MethodGet, "/loans/paid-off", "")
+	if status != http.StatusInternalServerError || resp.Code != CodeInternal {
+		t.Errorf("expected 500 %s, got %d %s", CodeInternal, status, resp.Code)
+	}
+	if resp.Error != "Failed to retrieve loan" {
+		t.Errorf("expected a generic message, got %q", resp.Error)
+	}
+}
+
+func TestUpdatedSinceAPI(t *testing.T) {
+	requireSQLite(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := InitDatabase(db); err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+
+	clock := NewSimulatedClock(time.Date(2025, 8, 1, 9, 0, 0, 0, time.UTC))
+	cfg := defaultServiceConfig()
+	cfg.Clock = clock
+
+	e := newServer()
+	registerRoutes(e, NewSQLiteLoanRepository(db).WithClock(clock), cfg)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	create := func() Loan {
+		rec := do(http.MethodPost, "/loans", `{"principal": 5000000, "start_date": "2025-08-01"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var loan Loan
+		if err := json.Unmarshal(rec.Body.Bytes(), &loan); err != nil {
+			t.Fatalf("failed to unmarshal loan: %v", err)
+		}
+		return loan
+	}
+	list := func(query string) []Loan {
+		rec := do(http.MethodGet, "/loans?"+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var loans []Loan
+		if err := json.Unmarshal(rec.Body.Bytes(), &loans); err != nil {
+			t.Fatalf("failed to unmarshal loans: %v", err)
+		}
+		return loans
+	}
+
+	created := clock.Now()
+	paid := create()
+	if !paid.CreatedAt.Equal(created) || !paid.UpdatedAt.Equal(created) {
+		t.Errorf("expected created_at and updated_at %v, got %v and %v", created, paid.CreatedAt, paid.UpdatedAt)
+	}
+	clock.Advance(time.Hour)
+	create()
+
+	// Paying stamps the loan and the paid week, not the rest of the schedule
+	payment := clock.Advance(time.Hour)
+	if rec := do(http.MethodPost, "/loans/"+paid.ID+"/pay", `{"amount": 110000}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := do(http.MethodGet, "/loans/"+paid.ID, "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &paid); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+	if !paid.CreatedAt.Equal(created) || !paid.UpdatedAt.Equal(payment) {
+		t.Errorf("expected created_at %v and updated_at %v, got %v and %v", created, payment, paid.CreatedAt, paid.UpdatedAt)
+	}
+	if !paid.Schedule[0].UpdatedAt.Equal(payment) || !paid.Schedule[1].UpdatedAt.Equal(created) {
+		t.Errorf("expected weeks updated at %v and %v, got %v and %v", payment, created, paid.Schedule[0].UpdatedAt, paid.Schedule[1].UpdatedAt)
+	}
+
+	if loans := list("updated_since=2025-08-01T10:30:00Z"); len(loans) != 1 || loans[0].ID != paid.ID {
+		t.Errorf("expected only loan %s, got %+v", paid.ID, loans)
+	}
+	if loans := list("updated_since=2025-08-01T17:00:00%2B07:00"); len(loans) != 2 {
+		t.Errorf("expected 2 loans updated since 10:00 UTC, got %d", len(loans))
+	}
+	if loans := list("updated_since=2025-08-01T11:00:00.000000001Z"); len(loans) != 0 {
+		t.Errorf("expected no loans, got %d", len(loans))
+	}
+	if rec := do(http.MethodGet, "/loans?updated_since=yesterday", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid updated_since, got %d", rec.Code)
+	}
+}
+
+func TestDeleteAndRestoreAPI(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	e := newServer()
+	registerRoutes(e, NewSQLiteLoanRepository(db), defaultServiceConfig())
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	count := func(query string) int {
+		rec := do(http.MethodGet, "/loans"+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var loans []Loan
+		if err := json.Unmarshal(rec.Body.Bytes(), &loans); err != nil {
+			t.Fatalf("failed to unmarshal loans: %v", err)
+		}
+		return len(loans)
+	}
+
+	rec := do(http.MethodPost, "/loans", `{"id": "loan-delete", "principal": 5000000, "start_date": "2025-08-01"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := do(http.MethodDelete, "/loans/loan-delete", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/loans/loan-delete", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a deleted loan, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/loans/loan-delete/pay", `{"amount": 110000}`); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 paying a deleted loan, got %d", rec.Code)
+	}
+	if n := count(""); n != 0 {
+		t.Errorf("expected no loans listed, got %d", n)
+	}
+	if n := count("?include_deleted=true"); n != 1 {
+		t.Errorf("expected the deleted loan listed, got %d loans", n)
+	}
+	if rec := do(http.MethodGet, "/loans?include_deleted=maybe", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid include_deleted, got %d", rec.Code)
+	}
+
+	rec = do(http.MethodPost, "/loans/loan-delete/restore", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var loan Loan
+	if err := json.Unmarshal(rec.Body.Bytes(), &loan); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+	if loan.ID != "loan-delete" || loan.DeletedAt != nil || len(loan.Schedule) != 50 {
+		t.Errorf("unexpected restored loan %+v", loan)
+	}
+
+	rec = do(http.MethodPost, "/loans/loan-delete/restore", "")
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), CodeLoanNotDeleted) {
+		t.Errorf("expected status 409 %s, got %d: %s", CodeLoanNotDeleted, rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodDelete, "/loans/missing", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 deleting a missing loan, got %d", rec.Code)
+	}
+}
+
+// TestJournalFailureAPI checks that a write whose journal entry cannot be
+// posted leaves nothing behind
+func TestJournalFailureAPI(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	repo := NewSQLiteLoanRepository(db)
+	ctx := context.Background()
+
+	working, failing := newServer(), newServer()
+	registerRoutes(working, repo, defaultServiceConfig())
+	registerRoutes(failing, failingJournalRepository{repo}, defaultServiceConfig())
+
+	do := func(e *echo.Echo, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	mustDo := func(method, path, body string, want int) {
+		t.Helper()
+		if rec := do(working, method, path, body); rec.Code != want {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", method, path, want, rec.Code, rec.Body.String())
+		}
+	}
+	failDo := func(method, path, body string) {
+		t.Helper()
+		if rec := do(failing, method, path, body); rec.Code != http.StatusInternalServerError {
+			t.Errorf("%s %s: expected status 500, got %d: %s", method, path, rec.Code, rec.Body.String())
+		}
+	}
+	journal := func() int {
+		t.Helper()
+		entries, err := repo.ListJournalEntries(ctx, time.Time{}, time.Now().AddDate(10, 0, 0))
+		if err != nil {
+			t.Fatalf("failed to list journal entries: %v", err)
+		}
+		return len(entries)
+	}
+
+	// A loan whose disbursement cannot be booked is not created
+	failDo(http.MethodPost, "/loans", `{"id": "loan-journal-failure", "principal": 5000000, "start_date": "2025-08-01"}`)
+	if _, err := repo.GetByID(ctx, "loan-journal-failure"); err != ErrLoanNotFound {
+		t.Errorf("expected ErrLoanNotFound, got %v", err)
+	}
+	if n := journal(); n != 0 {
+		t.Errorf("expected no journal entries, got %d", n)
+	}
+
+	mustDo(http.MethodPost, "/loans", `{"id": "loan-journal-failure", "principal": 5000000, "start_date": "2025-08-01"}`, http.StatusCreated)
+	entries := journal()
+
+	// Writing off stores nothing when the loss cannot be booked
+	failDo(http.MethodPost, "/loans/loan-journal-failure/write-off", "")
+	stored, err := repo.GetByID(ctx, "loan-journal-failure")
+	if err != nil {
+		t.Fatalf("failed to get loan: %v", err)
+	}
+	if stored.Status != LoanStatusActive || stored.Version != 0 {
+		t.Errorf("expected the loan untouched, got %s at version %d", stored.Status, stored.Version)
+	}
+
+	// Nor does a recovery; the retry then records it once
+	mustDo(http.MethodPost, "/loans/loan-journal-failure/write-off", "", http.StatusOK)
+	entries++
+	failDo(http.MethodPost, "/loans/loan-journal-failure/recoveries", `{"amount": 250000}`)
+	mustDo(http.MethodPost, "/loans/loan-journal-failure/recoveries", `{"amount": 250000}`, http.StatusCreated)
+	entries++
+	if stored, err = repo.GetByID(ctx, "loan-journal-failure"); err != nil {
+		t.Fatalf("failed to get loan: %v", err)
+	}
+	if len(stored.Recoveries) != 1 {
+		t.Errorf("expected one recovery, got %d", len(stored.Recoveries))
+	}
+
+	if n := journal(); n != entries {
+		t.Errorf("expected %d journal entries, got %d", entries, n)
+	}
+}
+
+// conflictingRepository is a repository whose first updates lose the version
+// check, as if another writer got there first
+type conflictingRepository struct {
+	LoanRepository
+	conflicts *int
+}
+
+func (r conflictingRepository) Update(ctx context.Context, loan *Loan) error {
+	if *r.conflicts > 0 {
+		*r.conflicts--
+		return ErrVersionConflict
+	}
+	return r.LoanRepository.Update(ctx, loan)
+}
+
+func (r conflictingRepository) WithTx(ctx context.Context, fn func(tx LoanRepository) error) error {
+	return r.LoanRepository.WithTx(ctx, func(tx LoanRepository) error {
+		return fn(conflictingRepository{tx, r.conflicts})
+	})
+}
+
+func TestPaymentVersionConflictRetryAPI(t *testing.T) {
+	repo := NewMemoryLoanRepository()
+	loan, err := NewLoan("loan-conflict", 5_000_000, 0.10, time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+	if err := repo.Create(context.Background(), loan); err != nil {
+		t.Fatalf("failed to store loan: %v", err)
+	}
+
+	tests := []struct {
+		conflicts int
+		want      int
+	}{
+		{maxPaymentAttempts - 1, http.StatusOK},
+		{maxPaymentAttempts, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		conflicts := tt.conflicts
+		e := newServer()
+		registerRoutes(e, conflictingRepository{repo, &conflicts}, defaultServiceConfig())
+
+		req := httptest.NewRequest(http.MethodPost, "/loans/loan-conflict/pay", strings.NewReader(`{"amount": 110000}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%d conflicts: expected status %d, got %d: %s", tt.conflicts, tt.want, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Only the retried payment landed
+	stored, err := repo.GetByID(context.Background(), loan.ID)
+	if err != nil {
+		t.Fatalf("failed to get loan: %v", err)
+	}
+	if stored.PaidCount != 1 {
+		t.Errorf("expected 1 payment, got %d", stored.PaidCount)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+)
+
+// crockford is the Crockford base32 alphabet used by ULIDs; it sorts in the
+// same order as the values it encodes
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// loanIDPattern restricts client-supplied loan IDs to URL-safe characters
+var loanIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// IDGenerator issues loan IDs of the form loan_<ULID>: a 48-bit millisecond
+// timestamp from the clock followed by 80 random bits, 26 base32 characters in
+// all. IDs sort by creation time. Within one millisecond, or when a simulated
+// clock stands still or moves back, the random part of the previous ID is
+// incremented so IDs stay unique and ordered.
+type IDGenerator struct {
+	clock   Clock
+	entropy io.Reader
+
+	mu     sync.Mutex
+	issued bool
+	lastMs uint64
+	last   [10]byte
+}
+
+// NewIDGenerator creates an ID generator reading time from clock and random
+// bits from entropy; crypto/rand is used when entropy is nil
+func NewIDGenerator(clock Clock, entropy io.Reader) *IDGenerator {
+	if entropy == nil {
+		entropy = rand.Reader
+	}
+	return &IDGenerator{clock: clock, entropy: entropy}
+}
+
+// NewLoanID returns a new, unique loan ID
+func (g *IDGenerator) NewLoanID() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(g.clock.Now().UnixMilli())
+	if !g.issued || ms > g.lastMs {
+		if _, err := io.ReadFull(g.entropy, g.last[:]); err != nil {
+			return "", fmt.Errorf("failed to read entropy: %w", err)
+		}
+		g.issued = true
+		g.lastMs = ms
+	} else if !increment(g.last[:]) {
+		// The random part overflowed; move on to the next millisecond
+		g.lastMs++
+	}
+
+	var id [16]byte
+	for i := 0; i < 6; i++ {
+		id[i] = byte(g.lastMs >> (40 - 8*i))
+	}
+	copy(id[6:], g.last[:])
+	return "loan_" + encodeULID(id), nil
+}
+
+// increment adds one to a big-endian number, reporting false on overflow
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID encodes 128 bits as 26 Crockford base32 characters, most
+// significant bits first
+func encodeULID(id [16]byte) string {
+	out := make([]byte, 26)
+	// 26 characters hold 130 bits; the two leading bits are always zero
+	var acc uint32
+	bits := 2
+	n := 0
+	for _, b := range id {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[n] = crockford[(acc>>bits)&31]
+			n++
+		}
+	}
+	return string(out)
+}
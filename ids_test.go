@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIDGeneratorEncoding(t *testing.T) {
+	clock := NewSimulatedClock(time.UnixMilli(0))
+	ids := NewIDGenerator(clock, bytes.NewReader(make([]byte, 10)))
+
+	id, err := ids.NewLoanID()
+	if err != nil {
+		t.Fatalf("failed to generate ID: %v", err)
+	}
+	if id != "loan_00000000000000000000000000" {
+		t.Errorf("unexpected ID %s", id)
+	}
+
+	// The next ID in the same millisecond increments the random part
+	id, err = ids.NewLoanID()
+	if err != nil {
+		t.Fatalf("failed to generate ID: %v", err)
+	}
+	if id != "loan_00000000000000000000000001" {
+		t.Errorf("unexpected ID %s", id)
+	}
+
+	clock.Set(time.UnixMilli(1<<48 - 1))
+	ids = NewIDGenerator(clock, bytes.NewReader(bytes.Repeat([]byte{0xff}, 10)))
+	if id, _ = ids.NewLoanID(); id != "loan_7ZZZZZZZZZZZZZZZZZZZZZZZZZ" {
+		t.Errorf("unexpected ID %s", id)
+	}
+}
+
+func TestIDGeneratorMonotonic(t *testing.T) {
+	clock := NewSimulatedClock(time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+	ids := NewIDGenerator(clock, nil)
+
+	var generated []string
+	for i := 0; i < 1000; i++ {
+		id, err := ids.NewLoanID()
+		if err != nil {
+			t.Fatalf("failed to generate ID: %v", err)
+		}
+		generated = append(generated, id)
+
+		// Mix IDs within one millisecond, later ones and a clock moved back
+		switch i % 10 {
+		case 3:
+			clock.Advance(time.Millisecond)
+		case 7:
+			clock.Advance(-time.Second)
+		}
+	}
+
+	if !sort.StringsAreSorted(generated) {
+		t.Error("expected IDs in ascending order")
+	}
+	for i := 1; i < len(generated); i++ {
+		if generated[i] == generated[i-1] {
+			t.Fatalf("duplicate ID %s", generated[i])
+		}
+	}
+}
+
+func TestIDGeneratorConcurrent(t *testing.T) {
+	ids := NewIDGenerator(SystemClock, nil)
+
+	const workers, perWorker = 16, 500
+	results := make(chan string, workers*perWorker)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				id, err := ids.NewLoanID()
+				if err != nil {
+					t.Errorf("failed to generate ID: %v", err)
+					return
+				}
+				results <- id
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	seen := make(map[string]bool)
+	for id := range results {
+		if seen[id] {
+			t.Fatalf("duplicate ID %s", id)
+		}
+		if !strings.HasPrefix(id, "loan_") || len(id) != 31 {
+			t.Errorf("malformed ID %s", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != workers*perWorker {
+		t.Errorf("expected %d IDs, got %d", workers*perWorker, len(seen))
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// dailyJobConfig configures the background jobs run by the service
+type dailyJobConfig struct {
+	AccrualMethod AccrualMethod
+	WriteOffDPD   int // 0 disables automatic write-off
+	Interval      time.Duration
+	Clock         Clock
+}
+
+// runDailyJobs runs the accrual and write-off jobs once at startup and then on
+// every tick until ctx is cancelled. Interest is accrued through the previous
+// day before write-offs so that a loan's final accruals are booked first.
+func runDailyJobs(ctx context.Context, logger *slog.Logger, repo LoanRepository, chart ChartOfAccounts, cfg dailyJobConfig) {
+	run := func() {
+		now := cfg.Clock.Now()
+
+		asOf := dayStart(now).AddDate(0, 0, -1)
+		accrued, err := RunInterestAccrual(ctx, repo, chart, cfg.AccrualMethod, asOf)
+		if err != nil {
+			logger.Error("interest accrual failed", "err", err, "as_of", asOf.Format("2006-01-02"))
+		} else {
+			logger.Info("interest accrual completed",
+				"as_of", asOf.Format("2006-01-02"),
+				"loans_processed", accrued.LoansProcessed,
+				"loans_accrued", accrued.LoansAccrued,
+				"accrued", accrued.Accrued,
+			)
+		}
+
+		if cfg.WriteOffDPD <= 0 {
+			return
+		}
+		writtenOff, err := RunAutoWriteOff(ctx, repo, chart, cfg.WriteOffDPD, now)
+		if err != nil {
+			logger.Error("automatic write-off failed", "err", err)
+			return
+		}
+		logger.Info("automatic write-off completed",
+			"dpd_threshold", cfg.WriteOffDPD,
+			"loans_processed", writtenOff.LoansProcessed,
+			"loans_written_off", len(writtenOff.WrittenOff),
+			"written_off_total", writtenOff.WrittenOffTotal,
+		)
+	}
+
+	run()
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run()
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// JournalEvent identifies the business event that produced a journal entry
+type JournalEvent string
+
+const (
+	JournalEventDisbursement JournalEvent = "disbursement"
+	JournalEventPayment      JournalEvent = "payment"
+	JournalEventAccrual      JournalEvent = "accrual"
+	JournalEventWriteOff     JournalEvent = "write_off"
+	JournalEventRecovery     JournalEvent = "recovery"
+	JournalEventSettlement   JournalEvent = "settlement"
+	JournalEventFee          JournalEvent = "fee"
+	JournalEventReversal     JournalEvent = "reversal"
+)
+
+// ChartOfAccounts maps the accounts used by the billing engine to general ledger codes
+type ChartOfAccounts struct {
+	Cash               string `json:"cash"`
+	LoanReceivable     string `json:"loan_receivable"`
+	InterestReceivable string `json:"interest_receivable"`
+	InterestIncome     string `json:"interest_income"`
+	RecoveryIncome     string `json:"recovery_income"`
+	FeeIncome          string `json:"fee_income"`
+	WriteOffExpense    string `json:"write_off_expense"`
+}
+
+// DefaultChartOfAccounts returns the chart used when no override is configured
+func DefaultChartOfAccounts() ChartOfAccounts {
+	return ChartOfAccounts{
+		Cash:               "1100",
+		LoanReceivable:     "1300",
+		InterestReceivable: "1310",
+		InterestIncome:     "4100",
+		RecoveryIncome:     "4200",
+		FeeIncome:          "4300",
+		WriteOffExpense:    "5100",
+	}
+}
+
+// LoadChartOfAccounts reads a JSON chart of accounts from path.
+// Accounts missing from the file keep their default codes.
+func LoadChartOfAccounts(path string) (ChartOfAccounts, error) {
+	chart := DefaultChartOfAccounts()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return chart, fmt.Errorf("failed to read chart of accounts: %w", err)
+	}
+	if err := json.Unmarshal(data, &chart); err != nil {
+		return chart, fmt.Errorf("failed to parse chart of accounts: %w", err)
+	}
+	return chart, nil
+}
+
+// JournalLine is a single debit or credit against one account
+type JournalLine struct {
+	Account string `json:"account"`
+	Debit   int64  `json:"debit"`
+	Credit  int64  `json:"credit"`
+}
+
+// JournalEntry is a balanced set of journal lines for one money movement
+type JournalEntry struct {
+	ID       string        `json:"id"`
+	LoanID   string        `json:"loan_id"`
+	Event    JournalEvent  `json:"event"`
+	PostedAt time.Time     `json:"posted_at"`
+	Lines    []JournalLine `json:"lines"`
+}
+
+// Validate checks that the entry has lines and that debits equal credits
+func (e *JournalEntry) Validate() error {
+	if len(e.Lines) == 0 {
+		return ErrUnbalancedEntry
+	}
+
+	var debits, credits int64
+	for _, line := range e.Lines {
+		if line.Debit < 0 || line.Credit < 0 {
+			return ErrUnbalancedEntry
+		}
+		debits += line.Debit
+		credits += line.Credit
+	}
+	if debits != credits {
+		return ErrUnbalancedEntry
+	}
+	return nil
+}
+
+// DisbursementEntry books the principal paid out to the borrower
+func DisbursementEntry(loan *Loan, chart ChartOfAccounts) *JournalEntry {
+	return &JournalEntry{
+		ID:       fmt.Sprintf("je_%s_disbursement", loan.ID),
+		LoanID:   loan.ID,
+		Event:    JournalEventDisbursement,
+		PostedAt: loan.StartDate,
+		Lines: []JournalLine{
+			{Account: chart.LoanReceivable, Debit: loan.Principal},
+			{Account: chart.Cash, Credit: loan.Principal},
+		},
+	}
+}
+
+// PaymentEntry books the installment for the given 1-based week, splitting the
+// cash received into repaid principal and settled interest receivable. Interest
+// income itself is recognised by the accrual job, not when cash arrives.
+func PaymentEntry(loan *Loan, weekIndex int, paidAt time.Time, chart ChartOfAccounts) *JournalEntry {
+	amount := loan.Schedule[weekIndex-1].Amount
+	principal, interest := loan.InstallmentSplit(weekIndex)
+
+	lines := []JournalLine{
+		{Account: chart.Cash, Debit: amount},
+		{Account: chart.LoanReceivable, Credit: principal},
+	}
+	if interest > 0 {
+		lines = append(lines, JournalLine{Account: chart.InterestReceivable, Credit: interest})
+	}
+
+	return &JournalEntry{
+		ID:       fmt.Sprintf("je_%s_payment_%d", loan.ID, weekIndex),
+		LoanID:   loan.ID,
+		Event:    JournalEventPayment,
+		PostedAt: paidAt,
+		Lines:    lines,
+	}
+}
+
+// FeeEntry books a fee collected from the borrower as fee income. reference
+// is the caller's ID for the fee, so each fee is booked only once.
+func FeeEntry(loan *Loan, reference string, amount int64, chargedAt time.Time, chart ChartOfAccounts) *JournalEntry {
+	return &JournalEntry{
+		ID:       fmt.Sprintf("je_%s_fee_%s", loan.ID, reference),
+		LoanID:   loan.ID,
+		Event:    JournalEventFee,
+		PostedAt: chargedAt,
+		Lines: []JournalLine{
+			{Account: chart.Cash, Debit: amount},
+			{Account: chart.FeeIncome, Credit: amount},
+		},
+	}
+}
+
+// ReversalEntry cancels a posted entry by swapping its debits and credits.
+// Posted entries are never changed or deleted; a mistake is undone by posting
+// the reversal on reversedAt and, where needed, the corrected entry after it.
+// Its ID derives from the reversed entry's, so an entry is reversed only once.
+func ReversalEntry(entry *JournalEntry, reversedAt time.Time) *JournalEntry {
+	lines := make([]JournalLine, len(entry.Lines))
+	for i, line := range entry.Lines {
+		lines[i] = JournalLine{Account: line.Account, Debit: line.Credit, Credit: line.Debit}
+	}
+
+	return &JournalEntry{
+		ID:       entry.ID + "_reversal",
+		LoanID:   entry.LoanID,
+		Event:    JournalEventReversal,
+		PostedAt: reversedAt,
+		Lines:    lines,
+	}
+}
+
+// postNewJournalEntry posts entry, or returns ErrJournalEntryExists when an
+// entry with its ID is already posted. Run it inside a unit of work so the
+// check and the post cannot interleave with another writer.
+func postNewJournalEntry(ctx context.Context, repo LoanRepository, entry *JournalEntry) error {
+	if _, err := repo.GetJournalEntry(ctx, entry.ID); err == nil {
+		return ErrJournalEntryExists
+	} else if !errors.Is(err, ErrJournalEntryNotFound) {
+		return err
+	}
+	return repo.PostJournalEntry(ctx, entry)
+}
+
+// WriteJournalCSV writes one CSV row per journal line
+func WriteJournalCSV(w io.Writer, entries []*JournalEntry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"entry_id", "posted_at", "loan_id", "event", "account", "debit", "credit"}); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		for _, line := range entry.Lines {
+			record := []string{
+				entry.ID,
+				entry.PostedAt.UTC().Format(time.RFC3339),
+				entry.LoanID,
+				string(entry.Event),
+				line.Account,
+				strconv.FormatInt(line.Debit, 10),
+				strconv.FormatInt(line.Credit, 10),
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// parseJournalRange parses an inclusive YYYY-MM-DD date range into a
+// half-open [from, to) interval in UTC
+func parseJournalRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	from, err := time.Parse("2006-01-02", fromStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, ErrInvalidRequest
+	}
+	to, err := time.Parse("2006-01-02", toStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, ErrInvalidRequest
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, ErrInvalidRequest
+	}
+	return from, to.AddDate(0, 0, 1), nil
+}
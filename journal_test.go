@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInstallmentSplit(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal int64
+		apr       float64
+	}{
+		{name: "default product", principal: 5_000_000, apr: 0.10},
+		{name: "principal not divisible by 50", principal: 1_000_040, apr: 0.25},
+		{name: "zero interest", principal: 5_000_000, apr: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan, err := NewLoan("test", tt.principal, tt.apr, time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC))
+			if err != nil {
+				t.Fatalf("failed to create loan: %v", err)
+			}
+
+			var totalPrincipal, totalInterest int64
+			for i := range loan.Schedule {
+				principal, interest := loan.InstallmentSplit(i + 1)
+				if principal < 0 || interest < 0 {
+					t.Fatalf("week %d split into negative portions %d/%d", i+1, principal, interest)
+				}
+				if principal+interest != loan.Schedule[i].Amount {
+					t.Fatalf("week %d portions %d+%d do not add up to %d", i+1, principal, interest, loan.Schedule[i].Amount)
+				}
+				totalPrincipal += principal
+				totalInterest += interest
+			}
+
+			if totalPrincipal != loan.Principal {
+				t.Errorf("expected principal portions to sum to %d, got %d", loan.Principal, totalPrincipal)
+			}
+			if totalInterest != loan.Outstanding-loan.Principal {
+				t.Errorf("expected interest portions to sum to %d, got %d", loan.Outstanding-loan.Principal, totalInterest)
+			}
+		})
+	}
+
+	loan, _ := NewLoan("test", 5_000_000, 0.10, time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC))
+	principal, interest := loan.InstallmentSplit(1)
+	if principal != 100_000 || interest != 10_000 {
+		t.Errorf("expected default week split 100000/10000, got %d/%d", principal, interest)
+	}
+}
+
+func TestJournalEntryValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		lines       []JournalLine
+		expectError error
+	}{
+		{
+			name: "balanced",
+			lines: []JournalLine{
+				{Account: "1100", Debit: 110_000},
+				{Account: "1300", Credit: 100_000},
+				{Account: "4100", Credit: 10_000},
+			},
+		},
+		{
+			name: "unbalanced",
+			lines: []JournalLine{
+				{Account: "1100", Debit: 110_000},
+				{Account: "1300", Credit: 100_000},
+			},
+			expectError: ErrUnbalancedEntry,
+		},
+		{
+			name: "negative amounts",
+			lines: []JournalLine{
+				{Account: "1100", Debit: -10},
+				{Account: "1300", Credit: -10},
+			},
+			expectError: ErrUnbalancedEntry,
+		},
+		{
+			name:        "no lines",
+			expectError: ErrUnbalancedEntry,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := &JournalEntry{ID: "je", Lines: tt.lines}
+			if err := entry.Validate(); err != tt.expectError {
+				t.Errorf("expected %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestLoanJournalEntries(t *testing.T) {
+	chart := DefaultChartOfAccounts()
+	loan, err := NewLoan("loan-je", 5_000_000, 0.10, time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+
+	disbursement := DisbursementEntry(loan, chart)
+	if err := disbursement.Validate(); err != nil {
+		t.Fatalf("disbursement entry invalid: %v", err)
+	}
+	if disbursement.Lines[0].Account != chart.LoanReceivable || disbursement.Lines[0].Debit != 5_000_000 {
+		t.Errorf("expected loan receivable debit of 5000000, got %+v", disbursement.Lines[0])
+	}
+
+	paidAt := time.Date(2025, 8, 20, 9, 0, 0, 0, time.UTC)
+	payment := PaymentEntry(loan, 1, paidAt, chart)
+	if err := payment.Validate(); err != nil {
+		t.Fatalf("payment entry invalid: %v", err)
+	}
+	if payment.ID != "je_loan-je_payment_1" {
+		t.Errorf("unexpected payment entry id %q", payment.ID)
+	}
+	if !payment.PostedAt.Equal(paidAt) {
+		t.Errorf("expected payment posted at %v, got %v", paidAt, payment.PostedAt)
+	}
+
+	balances := map[string]int64{}
+	for _, line := range payment.Lines {
+		balances[line.Account] += line.Debit - line.Credit
+	}
+	if balances[chart.Cash] != 110_000 {
+		t.Errorf("expected cash debit 110000, got %d", balances[chart.Cash])
+	}
+	if balances[chart.LoanReceivable] != -100_000 {
+		t.Errorf("expected loan receivable credit 100000, got %d", -balances[chart.LoanReceivable])
+	}
+	if balances[chart.InterestReceivable] != -10_000 {
+		t.Errorf("expected interest receivable credit 10000, got %d", -balances[chart.InterestReceivable])
+	}
+	if balances[chart.InterestIncome] != 0 {
+		t.Errorf("expected no interest income on payment, got %d", -balances[chart.InterestIncome])
+	}
+}
+
+func TestFeeAndReversalEntries(t *testing.T) {
+	chart := DefaultChartOfAccounts()
+	loan, err := NewLoan("loan-fee", 5_000_000, 0.10, time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+
+	chargedAt := time.Date(2025, 8, 16, 9, 0, 0, 0, time.UTC)
+	fee := FeeEntry(loan, "admin-1", 25_000, chargedAt, chart)
+	if err := fee.Validate(); err != nil {
+		t.Fatalf("fee entry invalid: %v", err)
+	}
+	if fee.ID != "je_loan-fee_fee_admin-1" || fee.Event != JournalEventFee || !fee.PostedAt.Equal(chargedAt) {
+		t.Errorf("unexpected fee entry %+v", fee)
+	}
+	expected := []JournalLine{{Account: chart.Cash, Debit: 25_000}, {Account: chart.FeeIncome, Credit: 25_000}}
+	if !reflect.DeepEqual(fee.Lines, expected) {
+		t.Errorf("expected fee lines %+v, got %+v", expected, fee.Lines)
+	}
+
+	reversedAt := time.Date(2025, 8, 20, 9, 0, 0, 0, time.UTC)
+	payment := PaymentEntry(loan, 1, chargedAt, chart)
+	reversal := ReversalEntry(payment, reversedAt)
+	if err := reversal.Validate(); err != nil {
+		t.Fatalf("reversal entry invalid: %v", err)
+	}
+	if reversal.ID != "je_loan-fee_payment_1_reversal" || reversal.LoanID != loan.ID || reversal.Event != JournalEventReversal {
+		t.Errorf("unexpected reversal entry %+v", reversal)
+	}
+	if !reversal.PostedAt.Equal(reversedAt) {
+		t.Errorf("expected reversal posted at %v, got %v", reversedAt, reversal.PostedAt)
+	}
+
+	balances := map[string]int64{}
+	for _, entry := range []*JournalEntry{payment, reversal} {
+		for _, line := range entry.Lines {
+			balances[line.Account] += line.Debit - line.Credit
+		}
+	}
+	for account, balance := range balances {
+		if balance != 0 {
+			t.Errorf("expected account %s to net to zero after reversal, got %d", account, balance)
+		}
+	}
+}
+
+func TestLoadChartOfAccounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chart.json")
+	if err := os.WriteFile(path, []byte(`{"cash": "1010", "interest_income": "4010"}`), 0o600); err != nil {
+		t.Fatalf("failed to write chart: %v", err)
+	}
+
+	chart, err := LoadChartOfAccounts(path)
+	if err != nil {
+		t.Fatalf("failed to load chart: %v", err)
+	}
+	if chart.Cash != "1010" || chart.InterestIncome != "4010" {
+		t.Errorf("overrides not applied: %+v", chart)
+	}
+	if chart.LoanReceivable != DefaultChartOfAccounts().LoanReceivable {
+		t.Errorf("expected default loan receivable account, got %q", chart.LoanReceivable)
+	}
+
+	if _, err := LoadChartOfAccounts(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected error for missing chart file")
+	}
+}
+
+func TestWriteJournalCSV(t *testing.T) {
+	loan, err := NewLoan("loan-csv", 5_000_000, 0.10, time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJournalCSV(&buf, []*JournalEntry{DisbursementEntry(loan, DefaultChartOfAccounts())}); err != nil {
+		t.Fatalf("failed to write csv: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read csv: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected header and 2 lines, got %d records", len(records))
+	}
+	if records[1][0] != "je_loan-csv_disbursement" || records[1][1] != "2025-08-15T00:00:00Z" || records[1][5] != "5000000" {
+		t.Errorf("unexpected first line %v", records[1])
+	}
+}
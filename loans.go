@@ -2,30 +2,68 @@ package main
 
 import (
 	"math"
+	"math/bits"
 	"time"
 )
 
+// LoanStatus represents the lifecycle state of a loan
+type LoanStatus string
+
+const (
+	LoanStatusActive     LoanStatus = "active"
+	LoanStatusPaidOff    LoanStatus = "paid_off"
+	LoanStatusWrittenOff LoanStatus = "written_off"
+	LoanStatusRefinanced LoanStatus = "refinanced"
+)
+
 // Loan represents a billing loan with flat interest
 type Loan struct {
-	ID          string    `json:"id"`
-	Principal   int64     `json:"principal"`
-	APR         float64   `json:"annual_rate"`
-	StartDate   time.Time `json:"start_date"`
-	WeeklyDue   int64     `json:"weekly_due"`
-	Schedule    [50]Week  `json:"schedule"`
-	PaidCount   int       `json:"paid_count"`
-	Outstanding int64     `json:"outstanding"`
+	ID               string        `json:"id"`
+	ExternalID       string        `json:"external_id,omitempty"`
+	Principal        int64         `json:"principal"`
+	APR              float64       `json:"annual_rate"`
+	StartDate        time.Time     `json:"start_date"`
+	Timezone         string        `json:"timezone"`
+	WeeklyDue        int64         `json:"weekly_due"`
+	Schedule         []Week        `json:"schedule"`
+	PaidCount        int           `json:"paid_count"`
+	Outstanding      int64         `json:"outstanding"`
+	Version          int64         `json:"version"`
+	Status           LoanStatus    `json:"status"`
+	WrittenOffAt     *time.Time    `json:"written_off_at,omitempty"`
+	WrittenOffAmount int64         `json:"written_off_amount,omitempty"`
+	Recoveries       []Recovery    `json:"recoveries,omitempty"`
+	Restructures     []Restructure `json:"restructures,omitempty"`
+	Deferrals        []Deferral    `json:"deferrals,omitempty"`
+	RefinancedFrom   string        `json:"refinanced_from,omitempty"`
+	RefinancedBy     string        `json:"refinanced_by,omitempty"`
+	RefinancedAt     *time.Time    `json:"refinanced_at,omitempty"`
+	CreatedAt        time.Time     `json:"created_at,omitzero"`
+	UpdatedAt        time.Time     `json:"updated_at,omitzero"`
+	DeletedAt        *time.Time    `json:"deleted_at,omitempty"`
+
+	// persisted is the schedule as the repository last read or wrote it, so
+	// that only the weeks changed since then need to be written back
+	persisted []Week
 }
 
 // Week represents a single week in the payment schedule
+// ScheduledDate follows the loan's weekly cadence; DueDate is the date payment
+// is actually due, which may be rolled off weekends and holidays. UpdatedAt is
+// when the week was last written.
 type Week struct {
-	Index  int       `json:"index"`
-	Amount int64     `json:"amount"`
-	Paid   bool      `json:"paid"`
-	PaidAt *time.Time `json:"paid_at,omitempty"`
+	Index         int        `json:"index"`
+	Amount        int64      `json:"amount"`
+	ScheduledDate time.Time  `json:"scheduled_date"`
+	DueDate       time.Time  `json:"due_date"`
+	Paid          bool       `json:"paid"`
+	PaidAt        *time.Time `json:"paid_at,omitempty"`
+	Deferred      bool       `json:"deferred,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at,omitzero"`
 }
 
-// NewLoan creates a new loan with the specified parameters
+// NewLoan creates a new loan with the specified parameters.
+// The loan's time zone is the location of startDate.
 func NewLoan(id string, principal int64, apr float64, startDate time.Time) (*Loan, error) {
 	if principal <= 0 {
 		return nil, ErrInvalidRequest
@@ -49,23 +87,75 @@ func NewLoan(id string, principal int64, apr float64, startDate time.Time) (*Loa
 		Principal:   principal,
 		APR:         apr,
 		StartDate:   startDate,
+		Timezone:    startDate.Location().String(),
 		WeeklyDue:   weeklyDue,
 		PaidCount:   0,
 		Outstanding: totalDue,
+		Status:      LoanStatusActive,
 	}
 
-	// Initialize schedule
+	// Initialize schedule; week N falls due 7*N days after the start date
+	loan.Schedule = make([]Week, 50)
 	for i := 0; i < 50; i++ {
+		scheduled := startDate.AddDate(0, 0, 7*(i+1))
 		loan.Schedule[i] = Week{
-			Index:  i + 1,
-			Amount: weeklyDue,
-			Paid:   false,
+			Index:         i + 1,
+			Amount:        weeklyDue,
+			ScheduledDate: scheduled,
+			DueDate:       scheduled,
+			Paid:          false,
 		}
 	}
 
 	return loan, nil
 }
 
+// markPersisted records the current schedule as the one stored
+func (l *Loan) markPersisted() {
+	l.persisted = append(make([]Week, 0, len(l.Schedule)), l.Schedule...)
+}
+
+// scheduleChanges returns the weeks that changed since the schedule was last
+// persisted, and whether weeks may have been removed from its end. For a loan
+// the repository never saw, every week counts as changed.
+func (l *Loan) scheduleChanges() (changed []Week, trimmed bool) {
+	if l.persisted == nil {
+		return l.Schedule, true
+	}
+	for i, week := range l.Schedule {
+		if i >= len(l.persisted) || !week.equal(l.persisted[i]) {
+			changed = append(changed, week)
+		}
+	}
+	return changed, len(l.Schedule) < len(l.persisted)
+}
+
+// markUpdated stamps the loan, and the weeks changed since the schedule was
+// last persisted, as written at now
+func (l *Loan) markUpdated(now time.Time) {
+	l.UpdatedAt = now
+	for i := range l.Schedule {
+		if l.persisted == nil || i >= len(l.persisted) || !l.Schedule[i].equal(l.persisted[i]) {
+			l.Schedule[i].UpdatedAt = now
+		}
+	}
+}
+
+// Location returns the time zone in which the loan's calendar days are counted
+func (l *Loan) Location() *time.Location {
+	return l.StartDate.Location()
+}
+
+// daysBetween returns the number of calendar days from a to b, with both taken
+// as dates in a's location. Unlike Sub().Hours()/24 it is not skewed by
+// daylight saving transitions.
+func daysBetween(a, b time.Time) int {
+	b = b.In(a.Location())
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return int(time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC).Sub(time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+}
+
 // GetOutstanding recomputes and returns the outstanding amount
 func (l *Loan) GetOutstanding() int64 {
 	outstanding := int64(0)
@@ -78,8 +168,40 @@ func (l *Loan) GetOutstanding() int64 {
 	return outstanding
 }
 
+// InstallmentSplit returns the principal and interest portions of the week with
+// the given 1-based index. Principal is allocated pro rata to the scheduled
+// amounts, so the portions of all weeks add up exactly to Principal.
+func (l *Loan) InstallmentSplit(index int) (principal, interest int64) {
+	var total, before int64
+	for i, week := range l.Schedule {
+		total += week.Amount
+		if i < index-1 {
+			before += week.Amount
+		}
+	}
+	amount := l.Schedule[index-1].Amount
+	if total == 0 {
+		return 0, amount
+	}
+
+	principal = l.principalThrough(before+amount, total) - l.principalThrough(before, total)
+	return principal, amount - principal
+}
+
+// principalThrough returns the principal repaid once cumulative of total has been paid
+func (l *Loan) principalThrough(cumulative, total int64) int64 {
+	hi, lo := bits.Mul64(uint64(cumulative), uint64(l.Principal))
+	quo, _ := bits.Div64(hi, lo, uint64(total))
+	return int64(quo)
+}
+
 // MakePayment processes a payment for the oldest unpaid week
 func (l *Loan) MakePayment(amount int64, now time.Time) error {
+	// Written-off loans only accept recoveries
+	if l.Status == LoanStatusWrittenOff {
+		return ErrLoanWrittenOff
+	}
+
 	// Find the first unpaid week
 	firstUnpaidIndex := -1
 	for i, week := range l.Schedule {
@@ -104,53 +226,102 @@ func (l *Loan) MakePayment(amount int64, now time.Time) error {
 	l.Schedule[firstUnpaidIndex].PaidAt = &now
 	l.PaidCount++
 	l.Outstanding -= amount
+	if l.Outstanding == 0 {
+		l.Status = LoanStatusPaidOff
+	}
 
 	return nil
 }
 
-// WeekIndexAt returns the week index (1-50) for the given time
-func (l *Loan) WeekIndexAt(now time.Time) int {
-	if now.Before(l.StartDate) {
-		return 1
+// CheckValueDate validates the date a payment's money arrived. The value date
+// may not precede the loan start or the previous payment, may not be in the
+// future, and may be at most maxBackdateDays calendar days before now.
+func (l *Loan) CheckValueDate(paidAt, now time.Time, maxBackdateDays int) error {
+	if paidAt.Before(l.StartDate) || paidAt.After(now) {
+		return ErrInvalidValueDate
+	}
+	if daysBetween(paidAt.In(l.Location()), now.In(l.Location())) > maxBackdateDays {
+		return ErrInvalidValueDate
+	}
+	for _, week := range l.Schedule {
+		if week.PaidAt != nil && week.PaidAt.After(paidAt) {
+			return ErrInvalidValueDate
+		}
 	}
+	return nil
+}
 
-	daysSinceStart := int(now.Sub(l.StartDate).Hours() / 24)
-	weekIndex := (daysSinceStart / 7) + 1
+// paidBy reports whether the week's money had arrived by the given time.
+// Payments without a recorded date count as paid at any time.
+func (w Week) paidBy(now time.Time) bool {
+	return w.Paid && (w.PaidAt == nil || !w.PaidAt.After(now))
+}
 
-	if weekIndex > 50 {
-		return 50
+// equal reports whether two weeks hold the same installment
+func (w Week) equal(other Week) bool {
+	if (w.PaidAt == nil) != (other.PaidAt == nil) || w.PaidAt != nil && !w.PaidAt.Equal(*other.PaidAt) {
+		return false
+	}
+	return w.Index == other.Index && w.Amount == other.Amount && w.Paid == other.Paid && w.Deferred == other.Deferred &&
+		w.ScheduledDate.Equal(other.ScheduledDate) && w.DueDate.Equal(other.DueDate)
+}
+
+// WeekIndexAt returns the 1-based index of the week in progress at the given
+// time, i.e. the first week not yet due, capped at the last scheduled week
+func (l *Loan) WeekIndexAt(now time.Time) int {
+	weekIndex := l.weeksDueBy(now) + 1
+	if weekIndex > len(l.Schedule) {
+		return len(l.Schedule)
 	}
 	return weekIndex
 }
 
+// weeksDueBy returns how many scheduled weeks have fallen due by the given time
+func (l *Loan) weeksDueBy(now time.Time) int {
+	due := 0
+	for _, week := range l.Schedule {
+		if week.DueDate.After(now) {
+			break
+		}
+		due++
+	}
+	return due
+}
+
 // IsDelinquent checks if the loan is delinquent based on the latest two scheduled weeks.
 // 
 // Week indexing: idx = WeekIndexAt(now) where days 0-6→1, 7-13→2, 14-20→3, etc.
+// for an unrestructured schedule; restructured and deferred schedules count
+// weeks by their due dates, so payment holidays are respected.
 // We only evaluate the two most recent scheduled weeks: (idx-2, idx-1).
 // Returns false when idx < 3 because there aren't two completed weeks to judge.
 // 
+// Written-off loans are never delinquent. Deferred weeks count at their new
+// due dates at the end of the schedule; their original ones are a holiday.
+//
 // Returns: (isDelinquent, consecutiveUnpaidStreak, observedWeek)
 func (l *Loan) IsDelinquent(now time.Time) (bool, int, int) {
 	observedWeek := l.WeekIndexAt(now)
+
+	// Written-off loans are no longer tracked for delinquency
+	if l.Status == LoanStatusWrittenOff {
+		return false, 0, observedWeek
+	}
 	
 	// If we're in the first two weeks, cannot be delinquent
 	if observedWeek < 3 {
 		return false, 0, observedWeek
 	}
 
-	// Check if the latest two scheduled weeks are both unpaid
+	// Check if the latest two scheduled weeks are both unpaid, by the date the
+	// money actually arrived
 	// Latest two weeks relative to observed week are (observedWeek-2) and (observedWeek-1)
-	week1Index := observedWeek - 2 // 0-based index for array
-	week2Index := observedWeek - 1 // 0-based index for array
-
-	if week1Index >= 0 && week1Index < 50 && week2Index >= 0 && week2Index < 50 {
-		week1Unpaid := !l.Schedule[week1Index].Paid
-		week2Unpaid := !l.Schedule[week2Index].Paid
+	week1Unpaid := !l.Schedule[observedWeek-2].paidBy(now) // 0-based index for array
+	week2Unpaid := !l.Schedule[observedWeek-1].paidBy(now) // 0-based index for array
 
-		if week1Unpaid && week2Unpaid {
-			// Return streak of 2 for the latest two unpaid weeks
-			return true, 2, observedWeek
-		}
+	if week1Unpaid && week2Unpaid {
+		// Return streak of 2 for the latest two unpaid weeks
+		return true, 2, observedWeek
 	}
 
 	return false, 0, observedWeek
@@ -331,6 +331,14 @@ func TestLoanIsDelinquent(t *testing.T) {
 			expectedStreak:     0,
 			expectedObserved:   3,
 		},
+		{
+			name:               "week 3 - delinquent with week 1 paid (weeks 2,3 unpaid)",
+			now:                time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC),
+			paidWeeks:          []int{0},
+			expectedDelinquent: true,
+			expectedStreak:     2,
+			expectedObserved:   3,
+		},
 		{
 			name:               "future start date - not delinquent",
 			now:                time.Date(2025, 7, 31, 0, 0, 0, 0, time.UTC),
@@ -352,8 +360,8 @@ func TestLoanIsDelinquent(t *testing.T) {
 			// Mark specified weeks as paid
 			for _, weekIndex := range tt.paidWeeks {
 				loan.Schedule[weekIndex].Paid = true
-				now := time.Now()
-				loan.Schedule[weekIndex].PaidAt = &now
+				paidAt := tt.now
+				loan.Schedule[weekIndex].PaidAt = &paidAt
 			}
 
 			delinquent, streak, observed := loan.IsDelinquent(tt.now)
@@ -560,3 +568,163 @@ func TestConservationOfTotals(t *testing.T) {
 		})
 	}
 }
+
+func TestLoanTimezoneWeekBoundaries(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+
+	loan, err := NewLoan("test", 5_000_000, 0.10, time.Date(2025, 8, 1, 0, 0, 0, 0, jakarta))
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+	if loan.Timezone != "Asia/Jakarta" {
+		t.Errorf("expected time zone Asia/Jakarta, got %s", loan.Timezone)
+	}
+
+	// 00:30 WIB on 2025-08-08 is still 2025-08-07 in UTC, but week 1 is already due
+	justAfterMidnight := time.Date(2025, 8, 7, 17, 30, 0, 0, time.UTC)
+	if week := loan.WeekIndexAt(justAfterMidnight); week != 2 {
+		t.Errorf("expected week 2 just after local midnight, got %d", week)
+	}
+	if week := loan.WeekIndexAt(justAfterMidnight.Add(-time.Hour)); week != 1 {
+		t.Errorf("expected week 1 just before local midnight, got %d", week)
+	}
+	if dpd := loan.DaysPastDue(time.Date(2025, 8, 9, 17, 30, 0, 0, time.UTC)); dpd != 2 {
+		t.Errorf("expected 2 days past due, got %d", dpd)
+	}
+}
+
+func TestLoanDaylightSavingTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+
+	// Clocks spring forward on 2026-03-08, so the first week is only 167 hours long
+	loan, err := NewLoan("test", 5_000_000, 0.10, time.Date(2026, 3, 6, 0, 0, 0, 0, newYork))
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+
+	for _, week := range loan.Schedule {
+		if week.DueDate.Hour() != 0 || week.DueDate.Weekday() != time.Friday {
+			t.Fatalf("week %d due at %v, expected local midnight on a Friday", week.Index, week.DueDate)
+		}
+	}
+	if days := loan.termDays(); days != 350 {
+		t.Errorf("expected a 350 day term, got %d", days)
+	}
+	if dpd := loan.DaysPastDue(time.Date(2026, 3, 20, 0, 0, 0, 0, newYork)); dpd != 7 {
+		t.Errorf("expected 7 days past due, got %d", dpd)
+	}
+	if got := loan.RecognizedInterestThrough(time.Date(2026, 3, 12, 0, 0, 0, 0, newYork), AccrualStraightLine); got != 10_000 {
+		t.Errorf("expected 10000 recognised over the first week, got %d", got)
+	}
+}
+
+func TestLoanCheckValueDate(t *testing.T) {
+	loan, err := NewLoan("test", 5_000_000, 0.10, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+	now := time.Date(2025, 8, 16, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		paidAt  time.Time
+		wantErr bool
+	}{
+		{"now", now, false},
+		{"two days ago", time.Date(2025, 8, 14, 0, 0, 0, 0, time.UTC), false},
+		{"at the backdating limit", time.Date(2025, 8, 9, 23, 0, 0, 0, time.UTC), false},
+		{"beyond the backdating limit", time.Date(2025, 8, 8, 23, 0, 0, 0, time.UTC), true},
+		{"in the future", now.Add(time.Minute), true},
+		{"before the loan start", time.Date(2025, 7, 31, 0, 0, 0, 0, time.UTC), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loan.CheckValueDate(tt.paidAt, now, 7)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// A value date may not precede an earlier payment
+	if err := loan.MakePayment(110_000, time.Date(2025, 8, 14, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("failed to make payment: %v", err)
+	}
+	if err := loan.CheckValueDate(time.Date(2025, 8, 13, 0, 0, 0, 0, time.UTC), now, 7); err != ErrInvalidValueDate {
+		t.Errorf("expected ErrInvalidValueDate, got %v", err)
+	}
+}
+
+func TestLoanDelinquencyUsesValueDate(t *testing.T) {
+	loan, err := NewLoan("test", 5_000_000, 0.10, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+
+	// Weeks 1 and 2 were settled on their due dates but only recorded on 2025-08-16
+	for _, paidAt := range []time.Time{time.Date(2025, 8, 8, 0, 0, 0, 0, time.UTC), time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)} {
+		if err := loan.MakePayment(110_000, paidAt); err != nil {
+			t.Fatalf("failed to make payment: %v", err)
+		}
+	}
+	if delinquent, _, _ := loan.IsDelinquent(time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)); delinquent {
+		t.Error("expected not delinquent when week 2 money arrived on time")
+	}
+
+	// A payment arriving later does not cure delinquency before it arrived
+	late, err := NewLoan("late", 5_000_000, 0.10, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := late.MakePayment(110_000, time.Date(2025, 8, 16, 0, 0, 0, 0, time.UTC)); err != nil {
+			t.Fatalf("failed to make payment: %v", err)
+		}
+	}
+	if delinquent, _, _ := late.IsDelinquent(time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)); !delinquent {
+		t.Error("expected delinquent before the week 2 money arrived")
+	}
+	if dpd := late.DaysPastDue(time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)); dpd != 7 {
+		t.Errorf("expected 7 days past due before the payment arrived, got %d", dpd)
+	}
+}
+
+func TestLoanScheduleChanges(t *testing.T) {
+	loan, err := NewLoan("tracked", 5_000_000, 0.10, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+
+	// A loan that was never stored reports every week
+	if changed, trimmed := loan.scheduleChanges(); len(changed) != 50 || !trimmed {
+		t.Errorf("expected all 50 weeks changed and a trim, got %d weeks, trimmed=%v", len(changed), trimmed)
+	}
+
+	loan.markPersisted()
+	if changed, trimmed := loan.scheduleChanges(); len(changed) != 0 || trimmed {
+		t.Errorf("expected no changes after persisting, got %d weeks, trimmed=%v", len(changed), trimmed)
+	}
+
+	// A payment changes exactly one week
+	if err := loan.MakePayment(110_000, time.Date(2025, 8, 8, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("failed to make payment: %v", err)
+	}
+	changed, trimmed := loan.scheduleChanges()
+	if len(changed) != 1 || changed[0].Index != 1 || trimmed {
+		t.Errorf("expected only week 1 changed, got %+v, trimmed=%v", changed, trimmed)
+	}
+
+	// Shortening the schedule asks for a trim
+	loan.markPersisted()
+	loan.Schedule = loan.Schedule[:40]
+	if changed, trimmed := loan.scheduleChanges(); len(changed) != 0 || !trimmed {
+		t.Errorf("expected a trim without changed weeks, got %d weeks, trimmed=%v", len(changed), trimmed)
+	}
+}
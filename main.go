@@ -2,18 +2,23 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"log/slog"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
+
+	// Embed the IANA time zone database so loan time zones resolve in minimal images
+	_ "time/tzdata"
 )
 
 var (
@@ -30,15 +35,33 @@ func main() {
 		case "db-init":
 			runDBInit()
 			return
+		case "db-migrate":
+			runDBMigrate()
+			return
+		case "journal-export":
+			runJournalExport()
+			return
+		case "accrue":
+			runAccrue()
+			return
+		case "write-off":
+			runWriteOff()
+			return
+		case "archive":
+			runArchive()
+			return
 		}
 	}
 	mainServer()
 }
 
 func runDBInit() {
-	dbPath := getEnv("DATABASE_PATH", "./pinjol.db")
+	dbCfg, err := loadDatabaseConfig()
+	if err != nil {
+		log.Fatalf("invalid database configuration: %v", err)
+	}
 
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := dbCfg.Open("")
 	if err != nil {
 		log.Fatalf("failed to open database: %v", err)
 	}
@@ -48,13 +71,79 @@ func runDBInit() {
 		log.Fatalf("failed to initialize database: %v", err)
 	}
 
-	log.Printf("database initialized successfully at %s", dbPath)
+	log.Printf("%s database initialized successfully", dbCfg.Driver)
+}
+
+func runDBMigrate() {
+	if len(os.Args) < 3 {
+		log.Fatal("Please specify a command: up, down, or status")
+	}
+	command := os.Args[2]
+
+	dbCfg, err := loadDatabaseConfig()
+	if err != nil {
+		log.Fatalf("invalid database configuration: %v", err)
+	}
+
+	args := flag.NewFlagSet("db-migrate "+command, flag.ExitOnError)
+	var (
+		steps = args.Int("steps", 1, "Number of migrations to roll back (down only)")
+		dsn   = args.String("db", "", "Database path, or connection URL for PostgreSQL (defaults to the configured database)")
+	)
+	if err := args.Parse(os.Args[3:]); err != nil { // Skip "program", "db-migrate" and the command
+		log.Fatalf("failed to parse flags: %v", err)
+	}
+
+	db, err := dbCfg.Open(*dsn)
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	switch command {
+	case "up":
+		if err := CheckSchemaVersion(db); err != nil {
+			log.Fatalf("failed to migrate database: %v", err)
+		}
+		applied, err := MigrateUp(db)
+		for _, m := range applied {
+			log.Printf("applied %03d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("failed to migrate database: %v", err)
+		}
+		log.Printf("%s database is at version %d", dbCfg.Driver, LatestSchemaVersion(db))
+	case "down":
+		if *steps <= 0 {
+			log.Fatal("Please specify a positive --steps count")
+		}
+		rolledBack, err := MigrateDown(db, *steps)
+		for _, m := range rolledBack {
+			log.Printf("rolled back %03d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("failed to roll back database: %v", err)
+		}
+	case "status":
+		states, err := MigrationStatus(db)
+		if err != nil {
+			log.Fatalf("failed to read migration status: %v", err)
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = "applied " + state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%03d_%-28s %s\n", state.Version, state.Name, applied)
+		}
+	default:
+		log.Fatalf("Unknown db-migrate command %q: use up, down, or status", command)
+	}
 }
 
 func mainServer() {
 	port := getEnv("PORT", "8080")
 	env := getEnv("APP_ENV", "dev")
-	dbPath := getEnv("DATABASE_PATH", "./pinjol.db")
 
 	var logger *slog.Logger
 	if env == "prod" {
@@ -63,50 +152,58 @@ func mainServer() {
 		logger = slog.New(slog.NewTextHandler(os.Stdout, nil))
 	}
 
-	// Initialize database
-	db, err := sql.Open("sqlite3", dbPath)
+	cfg, err := loadServiceConfig()
 	if err != nil {
-		logger.Error("failed to open database", "err", err)
+		logger.Error("invalid service configuration", "err", err)
+		os.Exit(1)
+	}
+	if cfg.Clock, err = loadClock(env); err != nil {
+		logger.Error("invalid clock configuration", "err", err)
 		os.Exit(1)
 	}
-	defer db.Close()
-
-	// Configure database connection
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(25)
-	db.SetConnMaxLifetime(5 * time.Minute)
 
-	// Initialize schema
-	if err := InitDatabase(db); err != nil {
+	// Initialize database and repository
+	dbCfg, err := loadDatabaseConfig()
+	if err != nil {
+		logger.Error("invalid database configuration", "err", err)
+		os.Exit(1)
+	}
+	repo, closeRepo, err := dbCfg.OpenRepository("", cfg.Clock)
+	if err != nil {
 		logger.Error("failed to initialize database", "err", err)
 		os.Exit(1)
 	}
+	defer closeRepo()
 
-	// Create repository
-	repo := NewSQLiteLoanRepository(db)
-
-	// Test database connection
-	if err := db.Ping(); err != nil {
-		logger.Error("failed to ping database", "err", err)
+	accrualMethod, err := ParseAccrualMethod(getEnv("ACCRUAL_METHOD", string(AccrualStraightLine)))
+	if err != nil {
+		logger.Error("invalid accrual configuration", "err", err)
+		os.Exit(1)
+	}
+	accrualInterval, err := time.ParseDuration(getEnv("ACCRUAL_INTERVAL", "24h"))
+	if err != nil || accrualInterval <= 0 {
+		logger.Error("invalid accrual configuration", "err", "ACCRUAL_INTERVAL must be a positive duration")
+		os.Exit(1)
+	}
+	writeOffDPD, err := strconv.Atoi(getEnv("WRITE_OFF_DPD", "0"))
+	if err != nil || writeOffDPD < 0 {
+		logger.Error("invalid write-off configuration", "err", "WRITE_OFF_DPD must be a non-negative number of days")
 		os.Exit(1)
 	}
 
-	logger.Info("database initialized successfully", "path", dbPath)
+	logger.Info("database initialized successfully", "driver", dbCfg.Driver)
 
-	e := echo.New()
-	e.HideBanner = true
+	e := newServer()
 	e.Use(middleware.Recover(), middleware.RequestID())
 	e.Use(LogMiddleware(logger))
 
 	e.GET("/healthz", healthHandler)
 	e.GET("/version", versionHandler(version, buildTime))
 
-	// Loan endpoints with repository injection
-	e.POST("/loans", func(c echo.Context) error { return createLoanHandler(c, repo) })
-	e.GET("/loans/:id", func(c echo.Context) error { return getLoanHandler(c, repo) })
-	e.POST("/loans/:id/pay", func(c echo.Context) error { return payLoanHandler(c, repo) })
-	e.GET("/loans/:id/outstanding", func(c echo.Context) error { return getOutstandingHandler(c, repo) })
-	e.GET("/loans/:id/delinquent", func(c echo.Context) error { return getDelinquencyHandler(c, repo) })
+	registerRoutes(e, repo, cfg)
+	if env != "prod" {
+		registerAdminRoutes(e, cfg.Clock)
+	}
 
 	addr := fmt.Sprintf(":%s", port)
 	go func() {
@@ -114,10 +211,18 @@ func mainServer() {
 			logger.Error("server stopped", "err", err)
 		}
 	}()
-	logger.Info("pinjol service started", "env", env, "addr", addr, "db", dbPath)
+	logger.Info("pinjol service started", "env", env, "addr", addr, "db", dbCfg.Driver, "now", cfg.Clock.Now())
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
+
+	go runDailyJobs(ctx, logger, repo, cfg.Chart, dailyJobConfig{
+		AccrualMethod: accrualMethod,
+		WriteOffDPD:   writeOffDPD,
+		Interval:      accrualInterval,
+		Clock:         cfg.Clock,
+	})
+
 	<-ctx.Done()
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -126,3 +231,46 @@ func mainServer() {
 		logger.Error("shutdown failed", "err", err)
 	}
 }
+
+// newServer creates the server the API is served from, which reports the
+// errors handlers return as an ErrorResponse
+func newServer() *echo.Echo {
+	e := echo.New()
+	e.HideBanner = true
+	e.HTTPErrorHandler = HTTPErrorHandler
+	return e
+}
+
+// registerRoutes wires the loan and journal endpoints with repository injection
+func registerRoutes(e *echo.Echo, repo LoanRepository, cfg serviceConfig) {
+	chart, dueDates, clock := cfg.Chart, cfg.DueDates, cfg.Clock
+	ids := NewIDGenerator(clock, nil)
+
+	e.POST("/loans", func(c echo.Context) error { return createLoanHandler(c, repo, chart, dueDates, cfg.Location, ids) })
+	e.GET("/loans", func(c echo.Context) error { return listLoansHandler(c, repo) })
+	e.GET("/loans/by-ref/:ref", func(c echo.Context) error { return getLoanByRefHandler(c, repo) })
+	e.GET("/loans/:id", func(c echo.Context) error { return getLoanHandler(c, repo) })
+	e.DELETE("/loans/:id", func(c echo.Context) error { return deleteLoanHandler(c, repo) })
+	e.POST("/loans/:id/restore", func(c echo.Context) error { return restoreLoanHandler(c, repo) })
+	e.POST("/loans/:id/pay", func(c echo.Context) error { return payLoanHandler(c, repo, chart, clock, cfg.MaxBackdateDays) })
+	e.GET("/loans/:id/outstanding", func(c echo.Context) error { return getOutstandingHandler(c, repo) })
+	e.GET("/loans/:id/delinquent", func(c echo.Context) error { return getDelinquencyHandler(c, repo, clock) })
+	e.GET("/loans/:id/interest", func(c echo.Context) error { return getLoanInterestHandler(c, repo) })
+	e.POST("/loans/:id/write-off", func(c echo.Context) error { return writeOffLoanHandler(c, repo, chart, clock) })
+	e.POST("/loans/:id/recoveries", func(c echo.Context) error { return recoveryHandler(c, repo, chart, clock) })
+	e.POST("/loans/:id/fees", func(c echo.Context) error { return chargeFeeHandler(c, repo, chart, clock) })
+	e.POST("/loans/:id/restructure", func(c echo.Context) error { return restructureLoanHandler(c, repo, dueDates, clock) })
+	e.POST("/loans/:id/deferrals", func(c echo.Context) error { return deferWeeksHandler(c, repo, dueDates, clock) })
+	e.POST("/loans/:id/refinance", func(c echo.Context) error { return refinanceLoanHandler(c, repo, chart, dueDates, clock, ids) })
+
+	e.GET("/portfolio/interest", func(c echo.Context) error { return getPortfolioInterestHandler(c, repo) })
+	e.GET("/journal", func(c echo.Context) error { return getJournalHandler(c, repo) })
+	e.POST("/journal/:id/reverse", func(c echo.Context) error { return reverseJournalEntryHandler(c, repo, clock) })
+}
+
+// registerAdminRoutes wires the endpoints that control the service's clock.
+// They are only registered outside production.
+func registerAdminRoutes(e *echo.Echo, clock Clock) {
+	e.GET("/admin/clock", func(c echo.Context) error { return getClockHandler(c, clock) })
+	e.POST("/admin/clock", func(c echo.Context) error { return setClockHandler(c, clock) })
+}
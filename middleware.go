@@ -1,25 +1,93 @@
 package main
 
 import (
+	"errors"
+	"net/http"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"log/slog"
 )
 
+// ErrorResponse is the body of every error response. Error carries the
+// human-readable message; clients should branch on Code.
+type ErrorResponse struct {
+	Error     string         `json:"error"`
+	Code      string         `json:"code"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
 func LogMiddleware(log *slog.Logger) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			start := time.Now()
 			err := next(c)
-			log.Info("request",
+			// Write the error response now so the logged status is the one sent
+			if err != nil {
+				c.Error(err)
+			}
+			attrs := []any{
 				"method", c.Request().Method,
 				"path", c.Path(),
 				"status", c.Response().Status,
 				"latency_ms", time.Since(start).Milliseconds(),
 				"request_id", c.Response().Header().Get(echo.HeaderXRequestID),
-			)
-			return err
+			}
+			if err != nil {
+				attrs = append(attrs, "err", err)
+			}
+			log.Info("request", attrs...)
+			return nil
+		}
+	}
+}
+
+// HTTPErrorHandler writes errors returned by handlers as an ErrorResponse,
+// mapping domain errors to their codes and statuses
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	var apiErr *APIError
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) && !errors.As(err, &apiErr) {
+		// Errors raised by Echo itself, such as unknown routes
+		apiErr = &APIError{Status: httpErr.Code, Code: httpErrorCode(httpErr.Code), Message: http.StatusText(httpErr.Code), Err: err}
+		if message, ok := httpErr.Message.(string); ok {
+			apiErr.Message = message
 		}
+	} else {
+		apiErr = toAPIError(err)
+	}
+
+	requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+	if requestID == "" {
+		requestID = c.Request().Header.Get(echo.HeaderXRequestID)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		_ = c.NoContent(apiErr.Status)
+		return
+	}
+	_ = c.JSON(apiErr.Status, ErrorResponse{
+		Error:     apiErr.Message,
+		Code:      apiErr.Code,
+		Details:   apiErr.Details,
+		RequestID: requestID,
+	})
+}
+
+// httpErrorCode returns the code of an error raised by Echo
+func httpErrorCode(status int) string {
+	switch {
+	case status == http.StatusNotFound:
+		return CodeNotFound
+	case status == http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case status >= http.StatusInternalServerError:
+		return CodeInternal
 	}
+	return CodeInvalidRequest
 }
@@ -2,56 +2,685 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
+
+	"github.com/lib/pq"
 )
 
-// InitDatabase initializes the database schema
+// ErrSchemaTooNew is returned when the database was migrated by a newer
+// release than this binary
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Migration is one numbered, reversible schema change. Up and Down run inside
+// a transaction together with the schema_migrations bookkeeping.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+	Down    func(tx *sql.Tx) error
+}
+
+// sqliteMigrations lists every SQLite schema change in order. Never edit a
+// released migration; add a new one instead.
+//
+// Databases created before versioned migrations already have some or all of
+// the schema, so the first migrations create tables, columns and indexes only
+// when they are missing.
+var sqliteMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_loans",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS loans (
+					id TEXT PRIMARY KEY,
+					principal INTEGER NOT NULL,
+					apr REAL NOT NULL,
+					start_date TEXT NOT NULL,
+					weekly_due INTEGER NOT NULL,
+					paid_count INTEGER NOT NULL DEFAULT 0,
+					outstanding INTEGER NOT NULL,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`, `
+				CREATE TABLE IF NOT EXISTS loan_schedule (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					loan_id TEXT NOT NULL,
+					week_index INTEGER NOT NULL,
+					amount INTEGER NOT NULL,
+					paid BOOLEAN NOT NULL DEFAULT FALSE,
+					paid_at DATETIME,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					FOREIGN KEY (loan_id) REFERENCES loans(id) ON DELETE CASCADE,
+					UNIQUE(loan_id, week_index)
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_loan_schedule_loan_id ON loan_schedule(loan_id)`,
+				`CREATE INDEX IF NOT EXISTS idx_loans_start_date ON loans(start_date)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx, `DROP TABLE loan_schedule`, `DROP TABLE loans`)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add_loan_version",
+		Up: func(tx *sql.Tx) error {
+			return addColumnIfMissing(tx, "loans", "version", "INTEGER NOT NULL DEFAULT 0")
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx, `ALTER TABLE loans DROP COLUMN version`)
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_journal_entries",
+		Up: func(tx *sql.Tx) error {
+			// One row per journal line
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS journal_entries (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					entry_id TEXT NOT NULL,
+					line_no INTEGER NOT NULL,
+					loan_id TEXT NOT NULL,
+					event TEXT NOT NULL,
+					account TEXT NOT NULL,
+					debit INTEGER NOT NULL DEFAULT 0,
+					credit INTEGER NOT NULL DEFAULT 0,
+					posted_at DATETIME NOT NULL,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					UNIQUE(entry_id, line_no)
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_journal_entries_posted_at ON journal_entries(posted_at)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx, `DROP TABLE journal_entries`)
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_interest_accruals",
+		Up: func(tx *sql.Tx) error {
+			// One row per loan per accrual day
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS interest_accruals (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					loan_id TEXT NOT NULL,
+					accrual_date DATETIME NOT NULL,
+					amount INTEGER NOT NULL,
+					method TEXT NOT NULL,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					UNIQUE(loan_id, accrual_date)
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx, `DROP TABLE interest_accruals`)
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_write_offs",
+		Up: func(tx *sql.Tx) error {
+			if err := addColumnIfMissing(tx, "loans", "status", "TEXT NOT NULL DEFAULT 'active'"); err != nil {
+				return err
+			}
+			if err := addColumnIfMissing(tx, "loans", "written_off_at", "DATETIME"); err != nil {
+				return err
+			}
+			if err := addColumnIfMissing(tx, "loans", "written_off_amount", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+				return err
+			}
+			return execAll(tx,
+				`UPDATE loans SET status = 'paid_off' WHERE status = 'active' AND outstanding = 0`, `
+				CREATE TABLE IF NOT EXISTS loan_recoveries (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					loan_id TEXT NOT NULL,
+					amount INTEGER NOT NULL,
+					received_at DATETIME NOT NULL,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					FOREIGN KEY (loan_id) REFERENCES loans(id) ON DELETE CASCADE
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_loan_recoveries_loan_id ON loan_recoveries(loan_id)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE loan_recoveries`,
+				`ALTER TABLE loans DROP COLUMN written_off_amount`,
+				`ALTER TABLE loans DROP COLUMN written_off_at`,
+				`ALTER TABLE loans DROP COLUMN status`,
+			)
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add_restructures",
+		Up: func(tx *sql.Tx) error {
+			// Schedules created before restructuring support have no stored due dates
+			if err := addColumnIfMissing(tx, "loan_schedule", "due_date", "DATETIME"); err != nil {
+				return err
+			}
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS loan_restructures (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					loan_id TEXT NOT NULL,
+					reason TEXT NOT NULL DEFAULT '',
+					restructured_at DATETIME NOT NULL,
+					before_terms TEXT NOT NULL,
+					after_terms TEXT NOT NULL,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					FOREIGN KEY (loan_id) REFERENCES loans(id) ON DELETE CASCADE
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_loan_restructures_loan_id ON loan_restructures(loan_id)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx, `DROP TABLE loan_restructures`, `ALTER TABLE loan_schedule DROP COLUMN due_date`)
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add_deferrals",
+		Up: func(tx *sql.Tx) error {
+			if err := addColumnIfMissing(tx, "loan_schedule", "deferred", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+				return err
+			}
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS loan_deferrals (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					loan_id TEXT NOT NULL,
+					weeks TEXT NOT NULL,
+					reason TEXT NOT NULL,
+					deferred_at DATETIME NOT NULL,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					FOREIGN KEY (loan_id) REFERENCES loans(id) ON DELETE CASCADE
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_loan_deferrals_loan_id ON loan_deferrals(loan_id)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx, `DROP TABLE loan_deferrals`, `ALTER TABLE loan_schedule DROP COLUMN deferred`)
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add_refinancing_lineage",
+		Up: func(tx *sql.Tx) error {
+			if err := addColumnIfMissing(tx, "loans", "refinanced_from", "TEXT NOT NULL DEFAULT ''"); err != nil {
+				return err
+			}
+			if err := addColumnIfMissing(tx, "loans", "refinanced_by", "TEXT NOT NULL DEFAULT ''"); err != nil {
+				return err
+			}
+			return addColumnIfMissing(tx, "loans", "refinanced_at", "DATETIME")
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE loans DROP COLUMN refinanced_at`,
+				`ALTER TABLE loans DROP COLUMN refinanced_by`,
+				`ALTER TABLE loans DROP COLUMN refinanced_from`,
+			)
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add_scheduled_dates",
+		Up: func(tx *sql.Tx) error {
+			// Rows without a scheduled date were never rolled off holidays
+			return addColumnIfMissing(tx, "loan_schedule", "scheduled_date", "DATETIME")
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx, `ALTER TABLE loan_schedule DROP COLUMN scheduled_date`)
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add_loan_timezone",
+		Up: func(tx *sql.Tx) error {
+			// Loans created before per-loan time zones were all scheduled in UTC
+			return addColumnIfMissing(tx, "loans", "timezone", "TEXT NOT NULL DEFAULT 'UTC'")
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx, `ALTER TABLE loans DROP COLUMN timezone`)
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add_loan_external_id",
+		Up: func(tx *sql.Tx) error {
+			// Partner reference, unique when present
+			if err := addColumnIfMissing(tx, "loans", "external_id", "TEXT"); err != nil {
+				return err
+			}
+			return execAll(tx, `CREATE UNIQUE INDEX IF NOT EXISTS idx_loans_external_id ON loans(external_id)`)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx, `DROP INDEX idx_loans_external_id`, `ALTER TABLE loans DROP COLUMN external_id`)
+		},
+	},
+	{
+		Version: 12,
+		Name:    "canonical_timestamps",
+		Up: func(tx *sql.Tx) error {
+			// Timestamps were stored in whatever zone the value carried, with
+			// a variable fraction, or by CURRENT_TIMESTAMP without one
+			return rewriteTimestamps(tx, sqliteTime)
+		},
+		Down: func(tx *sql.Tx) error {
+			return rewriteTimestamps(tx, func(t time.Time) string {
+				return t.Format(sqliteLegacyTimeLayouts[0])
+			})
+		},
+	},
+	{
+		Version: 13,
+		Name:    "index_loans_updated_at",
+		Up: func(tx *sql.Tx) error {
+			// Incremental syncs list the loans updated since their last run
+			return execAll(tx, `CREATE INDEX IF NOT EXISTS idx_loans_updated_at ON loans(updated_at)`)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx, `DROP INDEX idx_loans_updated_at`)
+		},
+	},
+	{
+		Version: 14,
+		Name:    "add_soft_delete_and_archive",
+		Up: func(tx *sql.Tx) error {
+			if err := addColumnIfMissing(tx, "loans", "deleted_at", "DATETIME"); err != nil {
+				return err
+			}
+			// Archive tables mirror the live ones without their constraints
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS loans_archive (
+					id TEXT PRIMARY KEY,
+					external_id TEXT,
+					principal INTEGER NOT NULL,
+					apr REAL NOT NULL,
+					start_date TEXT NOT NULL,
+					timezone TEXT NOT NULL,
+					weekly_due INTEGER NOT NULL,
+					paid_count INTEGER NOT NULL,
+					outstanding INTEGER NOT NULL,
+					version INTEGER NOT NULL,
+					status TEXT NOT NULL,
+					written_off_at DATETIME,
+					written_off_amount INTEGER NOT NULL,
+					refinanced_from TEXT NOT NULL,
+					refinanced_by TEXT NOT NULL,
+					refinanced_at DATETIME,
+					created_at DATETIME,
+					updated_at DATETIME,
+					deleted_at DATETIME,
+					archived_at DATETIME
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_loans_archive_external_id ON loans_archive(external_id)`, `
+				CREATE TABLE IF NOT EXISTS loan_schedule_archive (
+					loan_id TEXT NOT NULL,
+					week_index INTEGER NOT NULL,
+					amount INTEGER NOT NULL,
+					scheduled_date DATETIME,
+					due_date DATETIME,
+					paid BOOLEAN NOT NULL,
+					paid_at DATETIME,
+					deferred BOOLEAN NOT NULL,
+					created_at DATETIME,
+					updated_at DATETIME,
+					PRIMARY KEY (loan_id, week_index)
+				)`, `
+				CREATE TABLE IF NOT EXISTS loan_recoveries_archive (
+					id INTEGER PRIMARY KEY,
+					loan_id TEXT NOT NULL,
+					amount INTEGER NOT NULL,
+					received_at DATETIME NOT NULL,
+					created_at DATETIME
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_loan_recoveries_archive_loan_id ON loan_recoveries_archive(loan_id)`, `
+				CREATE TABLE IF NOT EXISTS loan_restructures_archive (
+					id INTEGER PRIMARY KEY,
+					loan_id TEXT NOT NULL,
+					reason TEXT NOT NULL,
+					restructured_at DATETIME NOT NULL,
+					before_terms TEXT NOT NULL,
+					after_terms TEXT NOT NULL,
+					created_at DATETIME
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_loan_restructures_archive_loan_id ON loan_restructures_archive(loan_id)`, `
+				CREATE TABLE IF NOT EXISTS loan_deferrals_archive (
+					id INTEGER PRIMARY KEY,
+					loan_id TEXT NOT NULL,
+					weeks TEXT NOT NULL,
+					reason TEXT NOT NULL,
+					deferred_at DATETIME NOT NULL,
+					created_at DATETIME
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_loan_deferrals_archive_loan_id ON loan_deferrals_archive(loan_id)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE loan_deferrals_archive`,
+				`DROP TABLE loan_restructures_archive`,
+				`DROP TABLE loan_recoveries_archive`,
+				`DROP TABLE loan_schedule_archive`,
+				`DROP TABLE loans_archive`,
+				`ALTER TABLE loans DROP COLUMN deleted_at`,
+			)
+		},
+	},
+	{
+		Version: 15,
+		Name:    "add_deferral_moved_weeks",
+		Up: func(tx *sql.Tx) error {
+			// Week indexes change when the schedule is renumbered; the moved
+			// weeks' scheduled dates identify them for good
+			if err := addColumnIfMissing(tx, "loan_deferrals", "moved", "TEXT"); err != nil {
+				return err
+			}
+			return addColumnIfMissing(tx, "loan_deferrals_archive", "moved", "TEXT")
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx, `ALTER TABLE loan_deferrals_archive DROP COLUMN moved`, `ALTER TABLE loan_deferrals DROP COLUMN moved`)
+		},
+	},
+}
+
+// sqliteTimestampColumns lists every column holding a timestamp, per table
+var sqliteTimestampColumns = []struct {
+	table   string
+	columns []string
+}{
+	{"loans", []string{"start_date", "written_off_at", "refinanced_at", "created_at", "updated_at"}},
+	{"loan_schedule", []string{"scheduled_date", "due_date", "paid_at", "created_at", "updated_at"}},
+	{"journal_entries", []string{"posted_at", "created_at"}},
+	{"interest_accruals", []string{"accrual_date", "created_at"}},
+	{"loan_recoveries", []string{"received_at", "created_at"}},
+	{"loan_restructures", []string{"restructured_at", "created_at"}},
+	{"loan_deferrals", []string{"deferred_at", "created_at"}},
+	{"schema_migrations", []string{"applied_at"}},
+}
+
+// rewriteTimestamps reads every stored timestamp and writes it back formatted
+// by format
+func rewriteTimestamps(tx *sql.Tx, format func(t time.Time) string) error {
+	for _, table := range sqliteTimestampColumns {
+		for _, column := range table.columns {
+			rows, err := tx.Query(fmt.Sprintf(`SELECT rowid, %s FROM %s WHERE %s IS NOT NULL`, column, table.table, column))
+			if err != nil {
+				return fmt.Errorf("failed to read %s.%s: %w", table.table, column, err)
+			}
+			values := make(map[int64]string)
+			for rows.Next() {
+				var rowid int64
+				var value *time.Time
+				if err := rows.Scan(&rowid, scanSQLiteNullTime(&value)); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to read %s.%s: %w", table.table, column, err)
+				}
+				values[rowid] = format(*value)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("failed to read %s.%s: %w", table.table, column, err)
+			}
+
+			for rowid, value := range values {
+				if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE rowid = ?`, table.table, column), value, rowid); err != nil {
+					return fmt.Errorf("failed to rewrite %s.%s: %w", table.table, column, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// sqliteMigrationsTable tracks the migrations applied to a SQLite database
+const sqliteMigrationsTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	)`
+
+// schemaDialect holds the migrations of one database backend
+type schemaDialect struct {
+	migrations      []Migration
+	migrationsTable string
+	timestamp       func(t time.Time) any // stored form of applied_at
+}
+
+// dialectFor returns the migrations matching the driver db was opened with
+func dialectFor(db *sql.DB) schemaDialect {
+	if _, ok := db.Driver().(*pq.Driver); ok {
+		return schemaDialect{migrations: postgresMigrations, migrationsTable: postgresMigrationsTable, timestamp: postgresDialect.timestamp}
+	}
+	return schemaDialect{migrations: sqliteMigrations, migrationsTable: sqliteMigrationsTable, timestamp: sqliteDialect.timestamp}
+}
+
+// LatestSchemaVersion is the schema version this binary migrates db to
+func LatestSchemaVersion(db *sql.DB) int {
+	migrations := dialectFor(db).migrations
+	return migrations[len(migrations)-1].Version
+}
+
+// InitDatabase checks that the schema is not newer than this binary and then
+// applies all pending migrations
 func InitDatabase(db *sql.DB) error {
-	// Create loans table
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS loans (
-			id TEXT PRIMARY KEY,
-			principal INTEGER NOT NULL,
-			apr REAL NOT NULL,
-			start_date TEXT NOT NULL,
-			weekly_due INTEGER NOT NULL,
-			paid_count INTEGER NOT NULL DEFAULT 0,
-			outstanding INTEGER NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`)
+	if err := CheckSchemaVersion(db); err != nil {
+		return err
+	}
+	_, err := MigrateUp(db)
+	return err
+}
+
+// CheckSchemaVersion returns ErrSchemaTooNew when the database has migrations
+// applied that this binary does not know about
+func CheckSchemaVersion(db *sql.DB) error {
+	version, err := SchemaVersion(db)
 	if err != nil {
-		return fmt.Errorf("failed to create loans table: %w", err)
-	}
-
-	// Create loan_schedule table
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS loan_schedule (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			loan_id TEXT NOT NULL,
-			week_index INTEGER NOT NULL,
-			amount INTEGER NOT NULL,
-			paid BOOLEAN NOT NULL DEFAULT FALSE,
-			paid_at DATETIME,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (loan_id) REFERENCES loans(id) ON DELETE CASCADE,
-			UNIQUE(loan_id, week_index)
-		)`)
+		return err
+	}
+	if latest := LatestSchemaVersion(db); version > latest {
+		return fmt.Errorf("%w: database is at version %d, binary supports up to %d", ErrSchemaTooNew, version, latest)
+	}
+	return nil
+}
+
+// SchemaVersion returns the highest applied migration, 0 for a new database
+func SchemaVersion(db *sql.DB) (int, error) {
+	if _, err := db.Exec(dialectFor(db).migrationsTable); err != nil {
+		return 0, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// MigrateUp applies every pending migration in order and returns those applied
+func MigrateUp(db *sql.DB) ([]Migration, error) {
+	version, err := SchemaVersion(db)
 	if err != nil {
-		return fmt.Errorf("failed to create loan_schedule table: %w", err)
+		return nil, err
 	}
 
-	// Create indexes for better performance
-	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_loan_schedule_loan_id ON loan_schedule(loan_id)`)
+	dialect := dialectFor(db)
+	var applied []Migration
+	for _, m := range dialect.migrations {
+		if m.Version <= version {
+			continue
+		}
+		err := inTransaction(db, func(tx *sql.Tx) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+				m.Version, m.Name, dialect.timestamp(time.Now()))
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("failed to apply migration %d %s: %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// MigrateDown rolls back the latest steps migrations, newest first, and
+// returns those rolled back
+func MigrateDown(db *sql.DB, steps int) ([]Migration, error) {
+	if err := CheckSchemaVersion(db); err != nil {
+		return nil, err
+	}
+
+	migrations := dialectFor(db).migrations
+	var rolledBack []Migration
+	for i := 0; i < steps; i++ {
+		version, err := SchemaVersion(db)
+		if err != nil {
+			return rolledBack, err
+		}
+		if version == 0 {
+			break
+		}
+		m := migrations[version-1]
+		err = inTransaction(db, func(tx *sql.Tx) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			return err
+		})
+		if err != nil {
+			return rolledBack, fmt.Errorf("failed to roll back migration %d %s: %w", m.Version, m.Name, err)
+		}
+		rolledBack = append(rolledBack, m)
+	}
+	return rolledBack, nil
+}
+
+// MigrationState reports whether a migration has been applied
+type MigrationState struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// MigrationStatus lists every known migration with the time it was applied
+func MigrationStatus(db *sql.DB) ([]MigrationState, error) {
+	if err := CheckSchemaVersion(db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema migrations: %w", err)
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan schema migration: %w", err)
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema migrations: %w", err)
+	}
+
+	migrations := dialectFor(db).migrations
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i] = MigrationState{Version: m.Version, Name: m.Name}
+		if at, ok := appliedAt[m.Version]; ok {
+			states[i].AppliedAt = &at
+		}
+	}
+	return states, nil
+}
+
+// inTransaction runs fn in a transaction, committing only when it succeeds
+func inTransaction(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to create index on loan_schedule: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_loans_start_date ON loans(start_date)`)
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// execAll runs each statement in order, stopping at the first failure
+func execAll(tx *sql.Tx, statements ...string) error {
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumnIfMissing adds a column to an existing table when it is not yet present
+func addColumnIfMissing(db queryer, table, column, definition string) error {
+	exists, err := columnExists(db, table, column)
 	if err != nil {
-		return fmt.Errorf("failed to create index on loans start_date: %w", err)
+		return err
+	}
+	if exists {
+		return nil
 	}
 
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add %s.%s column: %w", table, column, err)
+	}
 	return nil
 }
+
+// columnExists reports whether the table already has the given column
+func columnExists(db queryer, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect %s table: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    bool
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, fmt.Errorf("failed to scan %s table info: %w", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to inspect %s table: %w", table, err)
+	}
+	return false, nil
+}
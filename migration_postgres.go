@@ -0,0 +1,236 @@
+package main
+
+import "database/sql"
+
+// postgresMigrationsTable tracks the migrations applied to a PostgreSQL database
+const postgresMigrationsTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	)`
+
+// postgresMigrations lists every PostgreSQL schema change in order. PostgreSQL
+// support started from the current SQLite schema, so its history is shorter;
+// the two lists are numbered independently. Never edit a released migration;
+// add a new one instead.
+var postgresMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_schema",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx, `
+				CREATE TABLE loans (
+					id TEXT PRIMARY KEY,
+					external_id TEXT,
+					principal BIGINT NOT NULL,
+					apr DOUBLE PRECISION NOT NULL,
+					start_date TIMESTAMPTZ NOT NULL,
+					timezone TEXT NOT NULL DEFAULT 'UTC',
+					weekly_due BIGINT NOT NULL,
+					paid_count INTEGER NOT NULL DEFAULT 0,
+					outstanding BIGINT NOT NULL,
+					version BIGINT NOT NULL DEFAULT 0,
+					status TEXT NOT NULL DEFAULT 'active',
+					written_off_at TIMESTAMPTZ,
+					written_off_amount BIGINT NOT NULL DEFAULT 0,
+					refinanced_from TEXT NOT NULL DEFAULT '',
+					refinanced_by TEXT NOT NULL DEFAULT '',
+					refinanced_at TIMESTAMPTZ,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+					updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+				)`, `
+				CREATE TABLE loan_schedule (
+					id BIGSERIAL PRIMARY KEY,
+					loan_id TEXT NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+					week_index INTEGER NOT NULL,
+					amount BIGINT NOT NULL,
+					scheduled_date TIMESTAMPTZ,
+					due_date TIMESTAMPTZ,
+					paid BOOLEAN NOT NULL DEFAULT FALSE,
+					paid_at TIMESTAMPTZ,
+					deferred BOOLEAN NOT NULL DEFAULT FALSE,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+					updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+					UNIQUE (loan_id, week_index)
+				)`, `
+				CREATE TABLE loan_recoveries (
+					id BIGSERIAL PRIMARY KEY,
+					loan_id TEXT NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+					amount BIGINT NOT NULL,
+					received_at TIMESTAMPTZ NOT NULL,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+				)`, `
+				CREATE TABLE loan_restructures (
+					id BIGSERIAL PRIMARY KEY,
+					loan_id TEXT NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+					reason TEXT NOT NULL DEFAULT '',
+					restructured_at TIMESTAMPTZ NOT NULL,
+					before_terms JSONB NOT NULL,
+					after_terms JSONB NOT NULL,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+				)`, `
+				CREATE TABLE loan_deferrals (
+					id BIGSERIAL PRIMARY KEY,
+					loan_id TEXT NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+					weeks JSONB NOT NULL,
+					reason TEXT NOT NULL,
+					deferred_at TIMESTAMPTZ NOT NULL,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+				)`, `
+				CREATE TABLE journal_entries (
+					id BIGSERIAL PRIMARY KEY,
+					entry_id TEXT NOT NULL,
+					line_no INTEGER NOT NULL,
+					loan_id TEXT NOT NULL,
+					event TEXT NOT NULL,
+					account TEXT NOT NULL,
+					debit BIGINT NOT NULL DEFAULT 0,
+					credit BIGINT NOT NULL DEFAULT 0,
+					posted_at TIMESTAMPTZ NOT NULL,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+					UNIQUE (entry_id, line_no)
+				)`, `
+				CREATE TABLE interest_accruals (
+					id BIGSERIAL PRIMARY KEY,
+					loan_id TEXT NOT NULL,
+					accrual_date TIMESTAMPTZ NOT NULL,
+					amount BIGINT NOT NULL,
+					method TEXT NOT NULL,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+					UNIQUE (loan_id, accrual_date)
+				)`,
+				`CREATE UNIQUE INDEX idx_loans_external_id ON loans(external_id)`,
+				`CREATE INDEX idx_loans_start_date ON loans(start_date)`,
+				`CREATE INDEX idx_loan_schedule_loan_id ON loan_schedule(loan_id)`,
+				`CREATE INDEX idx_loan_recoveries_loan_id ON loan_recoveries(loan_id)`,
+				`CREATE INDEX idx_loan_restructures_loan_id ON loan_restructures(loan_id)`,
+				`CREATE INDEX idx_loan_deferrals_loan_id ON loan_deferrals(loan_id)`,
+				`CREATE INDEX idx_journal_entries_posted_at ON journal_entries(posted_at)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE interest_accruals`,
+				`DROP TABLE journal_entries`,
+				`DROP TABLE loan_deferrals`,
+				`DROP TABLE loan_restructures`,
+				`DROP TABLE loan_recoveries`,
+				`DROP TABLE loan_schedule`,
+				`DROP TABLE loans`,
+			)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "index_loans_updated_at",
+		Up: func(tx *sql.Tx) error {
+			// Incremental syncs list the loans updated since their last run
+			return execAll(tx, `CREATE INDEX idx_loans_updated_at ON loans(updated_at)`)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx, `DROP INDEX idx_loans_updated_at`)
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add_soft_delete_and_archive",
+		Up: func(tx *sql.Tx) error {
+			// Archive tables mirror the live ones without their constraints
+			return execAll(tx,
+				`ALTER TABLE loans ADD COLUMN deleted_at TIMESTAMPTZ`, `
+				CREATE TABLE loans_archive (
+					id TEXT PRIMARY KEY,
+					external_id TEXT,
+					principal BIGINT NOT NULL,
+					apr DOUBLE PRECISION NOT NULL,
+					start_date TIMESTAMPTZ NOT NULL,
+					timezone TEXT NOT NULL,
+					weekly_due BIGINT NOT NULL,
+					paid_count INTEGER NOT NULL,
+					outstanding BIGINT NOT NULL,
+					version BIGINT NOT NULL,
+					status TEXT NOT NULL,
+					written_off_at TIMESTAMPTZ,
+					written_off_amount BIGINT NOT NULL,
+					refinanced_from TEXT NOT NULL,
+					refinanced_by TEXT NOT NULL,
+					refinanced_at TIMESTAMPTZ,
+					created_at TIMESTAMPTZ NOT NULL,
+					updated_at TIMESTAMPTZ NOT NULL,
+					deleted_at TIMESTAMPTZ,
+					archived_at TIMESTAMPTZ
+				)`,
+				`CREATE INDEX idx_loans_archive_external_id ON loans_archive(external_id)`, `
+				CREATE TABLE loan_schedule_archive (
+					loan_id TEXT NOT NULL,
+					week_index INTEGER NOT NULL,
+					amount BIGINT NOT NULL,
+					scheduled_date TIMESTAMPTZ,
+					due_date TIMESTAMPTZ,
+					paid BOOLEAN NOT NULL,
+					paid_at TIMESTAMPTZ,
+					deferred BOOLEAN NOT NULL,
+					created_at TIMESTAMPTZ NOT NULL,
+					updated_at TIMESTAMPTZ NOT NULL,
+					PRIMARY KEY (loan_id, week_index)
+				)`, `
+				CREATE TABLE loan_recoveries_archive (
+					id BIGINT PRIMARY KEY,
+					loan_id TEXT NOT NULL,
+					amount BIGINT NOT NULL,
+					received_at TIMESTAMPTZ NOT NULL,
+					created_at TIMESTAMPTZ NOT NULL
+				)`,
+				`CREATE INDEX idx_loan_recoveries_archive_loan_id ON loan_recoveries_archive(loan_id)`, `
+				CREATE TABLE loan_restructures_archive (
+					id BIGINT PRIMARY KEY,
+					loan_id TEXT NOT NULL,
+					reason TEXT NOT NULL,
+					restructured_at TIMESTAMPTZ NOT NULL,
+					before_terms JSONB NOT NULL,
+					after_terms JSONB NOT NULL,
+					created_at TIMESTAMPTZ NOT NULL
+				)`,
+				`CREATE INDEX idx_loan_restructures_archive_loan_id ON loan_restructures_archive(loan_id)`, `
+				CREATE TABLE loan_deferrals_archive (
+					id BIGINT PRIMARY KEY,
+					loan_id TEXT NOT NULL,
+					weeks JSONB NOT NULL,
+					reason TEXT NOT NULL,
+					deferred_at TIMESTAMPTZ NOT NULL,
+					created_at TIMESTAMPTZ NOT NULL
+				)`,
+				`CREATE INDEX idx_loan_deferrals_archive_loan_id ON loan_deferrals_archive(loan_id)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE loan_deferrals_archive`,
+				`DROP TABLE loan_restructures_archive`,
+				`DROP TABLE loan_recoveries_archive`,
+				`DROP TABLE loan_schedule_archive`,
+				`DROP TABLE loans_archive`,
+				`ALTER TABLE loans DROP COLUMN deleted_at`,
+			)
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add_deferral_moved_weeks",
+		Up: func(tx *sql.Tx) error {
+			// Week indexes change when the schedule is renumbered; the moved
+			// weeks' scheduled dates identify them for good
+			return execAll(tx,
+				`ALTER TABLE loan_deferrals ADD COLUMN moved JSONB`,
+				`ALTER TABLE loan_deferrals_archive ADD COLUMN moved JSONB`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE loan_deferrals_archive DROP COLUMN moved`,
+				`ALTER TABLE loan_deferrals DROP COLUMN moved`,
+			)
+		},
+	},
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"path/filepath"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func TestInitDatabase(t *testing.T) {
 	// Create in-memory database
+	requireSQLite(t)
 	db, err := sql.Open("sqlite3", ":memory:")
 	if err != nil {
 		t.Fatalf("Failed to open database: %v", err)
@@ -66,3 +71,261 @@ func TestInitDatabase(t *testing.T) {
 		t.Fatalf("Failed to insert into loan_schedule table: %v", err)
 	}
 }
+
+func TestInitDatabaseAddsVersionColumn(t *testing.T) {
+	requireSQLite(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Schema as created before optimistic locking was introduced
+	_, err = db.Exec(`
+		CREATE TABLE loans (
+			id TEXT PRIMARY KEY,
+			principal INTEGER NOT NULL,
+			apr REAL NOT NULL,
+			start_date TEXT NOT NULL,
+			weekly_due INTEGER NOT NULL,
+			paid_count INTEGER NOT NULL DEFAULT 0,
+			outstanding INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		t.Fatalf("Failed to create legacy loans table: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO loans (id, principal, apr, start_date, weekly_due, outstanding) VALUES (?, ?, ?, ?, ?, ?)`,
+		"legacy-loan", 1000000, 0.1, "2025-09-01", 25000, 1000000)
+	if err != nil {
+		t.Fatalf("Failed to insert legacy loan: %v", err)
+	}
+
+	if err := InitDatabase(db); err != nil {
+		t.Fatalf("InitDatabase failed on legacy schema: %v", err)
+	}
+
+	var version int64
+	err = db.QueryRow("SELECT version FROM loans WHERE id = ?", "legacy-loan").Scan(&version)
+	if err != nil {
+		t.Fatalf("Version column not added: %v", err)
+	}
+	if version != 0 {
+		t.Errorf("Expected legacy loan version 0, got %d", version)
+	}
+
+	// Running again must be a no-op
+	if err := InitDatabase(db); err != nil {
+		t.Fatalf("InitDatabase is not idempotent: %v", err)
+	}
+	if schemaVersion, _ := SchemaVersion(db); schemaVersion != LatestSchemaVersion(db) {
+		t.Errorf("Expected legacy database at schema version %d, got %d", LatestSchemaVersion(db), schemaVersion)
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	requireSQLite(t)
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	applied, err := MigrateUp(db)
+	if err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+	if len(applied) != len(sqliteMigrations) {
+		t.Errorf("Expected %d migrations applied, got %d", len(sqliteMigrations), len(applied))
+	}
+	if version, _ := SchemaVersion(db); version != LatestSchemaVersion(db) {
+		t.Errorf("Expected schema version %d, got %d", LatestSchemaVersion(db), version)
+	}
+
+	// Nothing is pending the second time
+	applied, err = MigrateUp(db)
+	if err != nil {
+		t.Fatalf("MigrateUp failed on migrated database: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("Expected no migrations applied, got %d", len(applied))
+	}
+
+	// Rolling back to version 10 removes the external_id column
+	steps := LatestSchemaVersion(db) - 10
+	rolledBack, err := MigrateDown(db, steps)
+	if err != nil {
+		t.Fatalf("MigrateDown failed: %v", err)
+	}
+	if len(rolledBack) != steps || rolledBack[0].Version != LatestSchemaVersion(db) || rolledBack[steps-1].Version != 11 {
+		t.Fatalf("Expected migrations %d down to 11 rolled back, got %+v", LatestSchemaVersion(db), rolledBack)
+	}
+	if exists, _ := columnExists(db, "loans", "external_id"); exists {
+		t.Error("Expected external_id column to be dropped")
+	}
+
+	// Every migration can be rolled back, more steps than applied stop at zero
+	if _, err := MigrateDown(db, len(sqliteMigrations)+5); err != nil {
+		t.Fatalf("MigrateDown to zero failed: %v", err)
+	}
+	if version, _ := SchemaVersion(db); version != 0 {
+		t.Errorf("Expected schema version 0, got %d", version)
+	}
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')`).Scan(&tables); err != nil {
+		t.Fatalf("Failed to count tables: %v", err)
+	}
+	if tables != 0 {
+		t.Errorf("Expected no tables left, got %d", tables)
+	}
+
+	// And applied again from scratch
+	if _, err := MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp after full rollback failed: %v", err)
+	}
+	if exists, _ := columnExists(db, "loans", "external_id"); !exists {
+		t.Error("Expected external_id column after migrating up again")
+	}
+}
+
+func TestMigrationStatus(t *testing.T) {
+	requireSQLite(t)
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "status.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := InitDatabase(db); err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+	if _, err := MigrateDown(db, 2); err != nil {
+		t.Fatalf("MigrateDown failed: %v", err)
+	}
+
+	states, err := MigrationStatus(db)
+	if err != nil {
+		t.Fatalf("MigrationStatus failed: %v", err)
+	}
+	if len(states) != len(sqliteMigrations) {
+		t.Fatalf("Expected %d states, got %d", len(sqliteMigrations), len(states))
+	}
+	for i, state := range states {
+		pending := i >= len(sqliteMigrations)-2
+		if (state.AppliedAt == nil) != pending {
+			t.Errorf("Migration %d %s: expected pending=%v, got applied_at %v", state.Version, state.Name, pending, state.AppliedAt)
+		}
+	}
+}
+
+func TestInitDatabaseRefusesNewerSchema(t *testing.T) {
+	requireSQLite(t)
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "newer.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := InitDatabase(db); err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+	// A later release applied a migration this binary does not know
+	_, err = db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		LatestSchemaVersion(db)+1, "from_the_future", time.Now().UTC())
+	if err != nil {
+		t.Fatalf("Failed to record future migration: %v", err)
+	}
+
+	if err := InitDatabase(db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Expected ErrSchemaTooNew from InitDatabase, got %v", err)
+	}
+	if _, err := MigrateDown(db, 1); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Expected ErrSchemaTooNew from MigrateDown, got %v", err)
+	}
+}
+
+func TestMigrateCanonicalTimestamps(t *testing.T) {
+	requireSQLite(t)
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "timestamps.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := InitDatabase(db); err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+	if _, err := MigrateDown(db, LatestSchemaVersion(db)-11); err != nil {
+		t.Fatalf("MigrateDown failed: %v", err)
+	}
+
+	// Rows as the driver and CURRENT_TIMESTAMP wrote them, in mixed zones
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	startDate := time.Date(2025, 9, 1, 0, 0, 0, 0, jakarta)
+	paidAt := time.Date(2025, 9, 8, 9, 15, 30, 250000000, jakarta)
+	_, err = db.Exec(`INSERT INTO loans (id, principal, apr, start_date, timezone, weekly_due, outstanding) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		"legacy-loan", 1000000, 0.1, startDate, "Asia/Jakarta", 22000, 1100000)
+	if err != nil {
+		t.Fatalf("Failed to insert legacy loan: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO loan_schedule (loan_id, week_index, amount, scheduled_date, due_date, paid, paid_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		"legacy-loan", 1, 22000, startDate.AddDate(0, 0, 7), startDate.AddDate(0, 0, 7), true, paidAt)
+	if err != nil {
+		t.Fatalf("Failed to insert legacy schedule: %v", err)
+	}
+
+	if _, err := MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+
+	for _, tt := range []struct {
+		query string
+		want  time.Time
+	}{
+		{`SELECT start_date FROM loans`, startDate},
+		{`SELECT paid_at FROM loan_schedule`, paidAt},
+		{`SELECT due_date FROM loan_schedule`, startDate.AddDate(0, 0, 7)},
+	} {
+		var stored string
+		if err := db.QueryRow(`SELECT CAST((` + tt.query + `) AS TEXT)`).Scan(&stored); err != nil {
+			t.Fatalf("Failed to read %q: %v", tt.query, err)
+		}
+		if stored != sqliteTime(tt.want) {
+			t.Errorf("%s: expected %s, got %s", tt.query, sqliteTime(tt.want), stored)
+		}
+	}
+
+	// Defaulted audit columns are rewritten too
+	var legacy int
+	err = db.QueryRow(`SELECT COUNT(*) FROM loans WHERE created_at NOT LIKE '____-__-__T__:__:__._________Z'`).Scan(&legacy)
+	if err != nil {
+		t.Fatalf("Failed to read created_at: %v", err)
+	}
+	if legacy != 0 {
+		t.Errorf("Expected created_at to be canonical, got %d legacy rows", legacy)
+	}
+
+	loan, err := NewSQLiteLoanRepository(db).GetByID(context.Background(), "legacy-loan")
+	if err != nil {
+		t.Fatalf("Failed to read migrated loan: %v", err)
+	}
+	if !loan.StartDate.Equal(startDate) || loan.StartDate.Location().String() != "Asia/Jakarta" {
+		t.Errorf("Expected start date %v, got %v", startDate, loan.StartDate)
+	}
+	if got := loan.Schedule[0].PaidAt; got == nil || !got.Equal(paidAt) {
+		t.Errorf("Expected paid_at %v, got %v", paidAt, got)
+	}
+
+	// Rolling back restores the driver's format
+	if _, err := MigrateDown(db, LatestSchemaVersion(db)-11); err != nil {
+		t.Fatalf("MigrateDown failed: %v", err)
+	}
+	var stored string
+	if err := db.QueryRow(`SELECT CAST(paid_at AS TEXT) FROM loan_schedule`).Scan(&stored); err != nil {
+		t.Fatalf("Failed to read paid_at: %v", err)
+	}
+	if stored != "2025-09-08 02:15:30.25+00:00" {
+		t.Errorf("Expected legacy paid_at, got %s", stored)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Refinancing describes how an old loan was settled from a new loan's disbursement
+type Refinancing struct {
+	OldLoanID        string    `json:"old_loan_id"`
+	NewLoanID        string    `json:"new_loan_id"`
+	Payoff           int64     `json:"payoff"`
+	SettledPrincipal int64     `json:"settled_principal"`
+	SettledInterest  int64     `json:"settled_interest"`
+	NetDisbursement  int64     `json:"net_disbursement"`
+	RefinancedAt     time.Time `json:"refinanced_at"`
+}
+
+// Payoff returns the amount needed to settle the loan in full today. Interest
+// is flat, so the payoff is the outstanding balance of the schedule.
+func (l *Loan) Payoff() int64 {
+	if l.Status != LoanStatusActive {
+		return 0
+	}
+	return l.GetOutstanding()
+}
+
+// Refinance creates a new loan with the given id and terms whose disbursement
+// settles the old loan. The old loan's unpaid weeks are marked paid as of now
+// and the two loans are linked through RefinancedBy and RefinancedFrom.
+// Only active loans that are not delinquent can be refinanced.
+func Refinance(old *Loan, newID string, principal int64, apr float64, startDate, now time.Time) (*Loan, *Refinancing, error) {
+	if old.Status != LoanStatusActive {
+		return nil, nil, ErrRefinanceNotAllowed
+	}
+	if delinquent, _, _ := old.IsDelinquent(now); delinquent {
+		return nil, nil, ErrRefinanceNotAllowed
+	}
+
+	payoff := old.Payoff()
+	if principal <= payoff {
+		return nil, nil, ErrRefinanceTooSmall
+	}
+
+	loan, err := NewLoan(newID, principal, apr, startDate)
+	if err != nil {
+		return nil, nil, err
+	}
+	loan.RefinancedFrom = old.ID
+
+	refinancing := &Refinancing{
+		OldLoanID:       old.ID,
+		NewLoanID:       loan.ID,
+		Payoff:          payoff,
+		NetDisbursement: principal - payoff,
+		RefinancedAt:    now,
+	}
+	refinancing.SettledPrincipal = old.UnpaidPrincipal()
+	refinancing.SettledInterest = payoff - refinancing.SettledPrincipal
+
+	// Settle the old loan from the new disbursement
+	for i := range old.Schedule {
+		if old.Schedule[i].Paid {
+			continue
+		}
+		old.Schedule[i].Paid = true
+		old.Schedule[i].PaidAt = &now
+		old.PaidCount++
+	}
+	old.GetOutstanding()
+	old.Status = LoanStatusRefinanced
+	old.RefinancedBy = loan.ID
+	old.RefinancedAt = &now
+
+	return loan, refinancing, nil
+}
+
+// SettlementEntry books the payoff of a refinanced loan out of the new loan's
+// disbursement, clearing its remaining principal and interest receivable
+func SettlementEntry(refinancing *Refinancing, chart ChartOfAccounts) *JournalEntry {
+	lines := []JournalLine{
+		{Account: chart.Cash, Debit: refinancing.Payoff},
+		{Account: chart.LoanReceivable, Credit: refinancing.SettledPrincipal},
+	}
+	if refinancing.SettledInterest > 0 {
+		lines = append(lines, JournalLine{Account: chart.InterestReceivable, Credit: refinancing.SettledInterest})
+	}
+
+	return &JournalEntry{
+		ID:       fmt.Sprintf("je_%s_settlement", refinancing.OldLoanID),
+		LoanID:   refinancing.OldLoanID,
+		Event:    JournalEventSettlement,
+		PostedAt: refinancing.RefinancedAt,
+		Lines:    lines,
+	}
+}
+
+// refinanceLoan refinances the loan, persists both loans and books the new
+// disbursement and the settlement of the old loan, all in one unit of work:
+// if the old loan changed in the meantime nothing is stored.
+func refinanceLoan(ctx context.Context, repo LoanRepository, chart ChartOfAccounts, dueDates DueDatePolicy, old *Loan, newID string, principal int64, apr float64, startDate, now time.Time) (*Loan, *Refinancing, error) {
+	loan, refinancing, err := Refinance(old, newID, principal, apr, startDate, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	loan.ApplyDueDatePolicy(dueDates)
+
+	err = repo.WithTx(ctx, func(tx LoanRepository) error {
+		if err := tx.Create(ctx, loan); err != nil {
+			return err
+		}
+		if err := tx.Update(ctx, old); err != nil {
+			return err
+		}
+		if err := tx.PostJournalEntry(ctx, DisbursementEntry(loan, chart)); err != nil {
+			return err
+		}
+		return tx.PostJournalEntry(ctx, SettlementEntry(refinancing, chart))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return loan, refinancing, nil
+}
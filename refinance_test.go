@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefinance(t *testing.T) {
+	old := newPaidLoan(t, 2)
+	now := time.Date(2025, 8, 20, 0, 0, 0, 0, time.UTC)
+
+	loan, refinancing, err := Refinance(old, "new-loan", 10_000_000, 0.10, now, now)
+	if err != nil {
+		t.Fatalf("refinance failed: %v", err)
+	}
+
+	if refinancing.Payoff != 5_280_000 || refinancing.NetDisbursement != 4_720_000 {
+		t.Errorf("unexpected payoff %d and net disbursement %d", refinancing.Payoff, refinancing.NetDisbursement)
+	}
+	if refinancing.SettledPrincipal != 4_800_000 || refinancing.SettledInterest != 480_000 {
+		t.Errorf("unexpected settlement split %d/%d", refinancing.SettledPrincipal, refinancing.SettledInterest)
+	}
+
+	if loan.Principal != 10_000_000 || loan.RefinancedFrom != old.ID || loan.Status != LoanStatusActive {
+		t.Errorf("unexpected new loan %+v", loan)
+	}
+	if old.Status != LoanStatusRefinanced || old.RefinancedBy != loan.ID || old.RefinancedAt == nil {
+		t.Errorf("unexpected old loan status %s, refinanced by %q", old.Status, old.RefinancedBy)
+	}
+	if old.GetOutstanding() != 0 || old.PaidCount != 50 {
+		t.Errorf("expected old loan settled, outstanding %d after %d weeks", old.GetOutstanding(), old.PaidCount)
+	}
+	if err := old.MakePayment(110_000, now); err != ErrAlreadyPaid {
+		t.Errorf("expected ErrAlreadyPaid on settled loan, got %v", err)
+	}
+
+	// All remaining interest of the old loan is recognised on the refinance date
+	if got := old.RecognizedInterestThrough(now.AddDate(0, 0, -1), AccrualStraightLine); got >= 500_000 {
+		t.Errorf("expected partial recognition before refinance, got %d", got)
+	}
+	if got := old.RecognizedInterestThrough(now, AccrualStraightLine); got != 500_000 {
+		t.Errorf("expected 500000 recognised on refinance date, got %d", got)
+	}
+
+	entry := SettlementEntry(refinancing, DefaultChartOfAccounts())
+	if err := entry.Validate(); err != nil {
+		t.Errorf("settlement entry is unbalanced: %v", err)
+	}
+}
+
+func TestRefinanceErrors(t *testing.T) {
+	now := time.Date(2025, 8, 20, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		setup     func(loan *Loan)
+		now       time.Time
+		principal int64
+		expected  error
+	}{
+		{name: "principal below payoff", now: now, principal: 5_000_000, expected: ErrRefinanceTooSmall},
+		{name: "unsupported product", now: now, principal: 10_000_010, expected: ErrUnsupportedProduct},
+		{name: "delinquent", now: time.Date(2025, 9, 4, 0, 0, 0, 0, time.UTC), principal: 10_000_000, expected: ErrRefinanceNotAllowed},
+		{
+			name:      "written off",
+			setup:     func(loan *Loan) { _ = loan.WriteOff(now) },
+			now:       now,
+			principal: 10_000_000,
+			expected:  ErrRefinanceNotAllowed,
+		},
+		{
+			name:      "already refinanced",
+			setup:     func(loan *Loan) { _, _, _ = Refinance(loan, "other", 10_000_000, 0.10, now, now) },
+			now:       now,
+			principal: 10_000_000,
+			expected:  ErrRefinanceNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := newPaidLoan(t, 2)
+			if tt.setup != nil {
+				tt.setup(old)
+			}
+			if _, _, err := Refinance(old, "new-loan", tt.principal, 0.10, tt.now, tt.now); err != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
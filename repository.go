@@ -1,77 +1,224 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
-// LoanRepository defines the interface for loan data persistence
+// LoanRepository defines the interface for loan data persistence. Every method
+// takes the caller's context and gives up once it is cancelled or expires.
 type LoanRepository interface {
-	Create(loan *Loan) error
-	GetByID(id string) (*Loan, error)
-	Update(loan *Loan) error
-	List() ([]*Loan, error)
-	Delete(id string) error
+	Create(ctx context.Context, loan *Loan) error
+	GetByID(ctx context.Context, id string) (*Loan, error)
+	GetByExternalID(ctx context.Context, externalID string) (*Loan, error)
+	Update(ctx context.Context, loan *Loan) error
+	List(ctx context.Context, filter LoanFilter) ([]*Loan, error)
+
+	// Retention: Delete is a soft delete, after which reads skip the loan
+	// until it is restored. Archive moves the paid-off loans last written
+	// before before into archive tables and returns their IDs. Restore
+	// brings back a deleted or archived loan.
+	Delete(ctx context.Context, id string) error
+	Archive(ctx context.Context, before time.Time) ([]string, error)
+	Restore(ctx context.Context, id string) error
+
+	// Journal
+	PostJournalEntry(ctx context.Context, entry *JournalEntry) error
+	GetJournalEntry(ctx context.Context, id string) (*JournalEntry, error)
+	ListJournalEntries(ctx context.Context, from, to time.Time) ([]*JournalEntry, error)
+
+	// Interest accruals
+	SaveAccruals(ctx context.Context, accruals []InterestAccrual) error
+	ListAccruals(ctx context.Context, loanID string) ([]InterestAccrual, error)
+
+	// WithTx runs fn as one unit of work: every call fn makes on tx happens
+	// atomically, committed when fn returns nil and rolled back when it
+	// returns an error, which WithTx then returns. Loans read through tx stay
+	// locked against other writers until the unit ends. fn must use tx, not
+	// the repository it was called on; WithTx on tx joins the running unit.
+	WithTx(ctx context.Context, fn func(tx LoanRepository) error) error
+}
+
+// LoanFilter narrows down the loans List returns. The zero value matches
+// every loan that is not deleted.
+type LoanFilter struct {
+	// UpdatedSince keeps the loans written at or after this instant, for
+	// incremental syncs
+	UpdatedSince time.Time
+
+	// IncludeDeleted also returns soft-deleted loans
+	IncludeDeleted bool
+}
+
+// matches reports whether loan passes the filter
+func (f LoanFilter) matches(loan *Loan) bool {
+	if loan.DeletedAt != nil && !f.IncludeDeleted {
+		return false
+	}
+	return f.UpdatedSince.IsZero() || !loan.UpdatedAt.Before(f.UpdatedSince)
+}
+
+// sqlConn is what the SQL repositories query through: the database, or the
+// transaction of the unit of work the repository is bound to
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// unitTx is the transaction of a single repository call. Inside a unit of
+// work the call joins the unit's transaction instead; Commit and Rollback
+// then do nothing, as the unit decides how it ends.
+type unitTx struct {
+	*sql.Tx
+	joined bool
+}
+
+// beginTx starts a transaction on db, or joins bound when the repository is
+// bound to a unit of work
+func beginTx(ctx context.Context, db *sql.DB, bound *sql.Tx) (unitTx, error) {
+	if bound != nil {
+		return unitTx{Tx: bound, joined: true}, nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	return unitTx{Tx: tx}, err
+}
+
+func (tx unitTx) Commit() error {
+	if tx.joined {
+		return nil
+	}
+	return tx.Tx.Commit()
+}
+
+func (tx unitTx) Rollback() error {
+	if tx.joined {
+		return nil
+	}
+	return tx.Tx.Rollback()
 }
 
 // SQLiteLoanRepository implements LoanRepository using SQLite
 type SQLiteLoanRepository struct {
-	db *sql.DB
+	db    *sql.DB
+	tx    *sql.Tx // set inside a unit of work
+	clock Clock
 }
 
-// NewSQLiteLoanRepository creates a new SQLite repository
+// NewSQLiteLoanRepository creates a new SQLite repository. Open db with
+// openSQLite, whose immediate transactions units of work rely on for locking.
 func NewSQLiteLoanRepository(db *sql.DB) *SQLiteLoanRepository {
-	return &SQLiteLoanRepository{db: db}
+	return &SQLiteLoanRepository{db: db, clock: SystemClock}
+}
+
+// WithClock sets the clock used to stamp when loans are created and updated
+func (r *SQLiteLoanRepository) WithClock(clock Clock) *SQLiteLoanRepository {
+	r.clock = clock
+	return r
+}
+
+// conn returns the transaction of the unit of work, or the database outside one
+func (r *SQLiteLoanRepository) conn() sqlConn {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// WithTx runs fn as one unit of work in a single transaction. SQLite has no
+// row locks; the transaction begins immediate, taking the database's write
+// lock, which other writers wait for until the unit ends.
+func (r *SQLiteLoanRepository) WithTx(ctx context.Context, fn func(tx LoanRepository) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&SQLiteLoanRepository{db: r.db, tx: tx, clock: r.clock}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
-// Create inserts a new loan into the database
-func (r *SQLiteLoanRepository) Create(loan *Loan) error {
-	tx, err := r.db.Begin()
+// Create inserts a new loan into the database. It returns ErrLoanExists when
+// the loan's ID is already taken and ErrExternalIDExists when its external ID is.
+func (r *SQLiteLoanRepository) Create(ctx context.Context, loan *Loan) error {
+	now := r.clock.Now()
+
+	tx, err := beginTx(ctx, r.db, r.tx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
+	if err := checkArchived(ctx, tx, loan, sqliteDialect); err != nil {
+		return err
+	}
+
 	// Insert loan
-	_, err = tx.Exec(`
-		INSERT INTO loans (id, principal, apr, start_date, weekly_due, paid_count, outstanding)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		loan.ID, loan.Principal, loan.APR, loan.StartDate, loan.WeeklyDue, loan.PaidCount, loan.Outstanding)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO loans (id, external_id, principal, apr, start_date, timezone, weekly_due, paid_count, outstanding, version,
+			status, written_off_at, written_off_amount, refinanced_from, refinanced_by, refinanced_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		loan.ID, sql.NullString{String: loan.ExternalID, Valid: loan.ExternalID != ""}, loan.Principal, loan.APR, sqliteTime(loan.StartDate), loan.Timezone, loan.WeeklyDue, loan.PaidCount, loan.Outstanding, loan.Version,
+		string(loan.Status), sqliteNullTime(loan.WrittenOffAt), loan.WrittenOffAmount, loan.RefinancedFrom, loan.RefinancedBy, sqliteNullTime(loan.RefinancedAt), sqliteTime(now), sqliteTime(now))
 	if err != nil {
+		if mapped := sqliteInsertError(err); mapped != nil {
+			return mapped
+		}
 		return fmt.Errorf("failed to insert loan: %w", err)
 	}
 
 	// Insert schedule
-	for _, week := range loan.Schedule {
-		var paidAt *time.Time
-		if week.PaidAt != nil {
-			paidAt = week.PaidAt
-		}
+	if err := insertSchedule(ctx, tx, loan, now, sqliteDialect); err != nil {
+		return err
+	}
 
-		_, err = tx.Exec(`
-			INSERT INTO loan_schedule (loan_id, week_index, amount, paid, paid_at)
-			VALUES (?, ?, ?, ?, ?)`,
-			loan.ID, week.Index, week.Amount, week.Paid, paidAt)
-		if err != nil {
-			return fmt.Errorf("failed to insert schedule for week %d: %w", week.Index, err)
-		}
+	if err := insertRecoveries(ctx, tx, loan, now); err != nil {
+		return err
+	}
+	if err := insertRestructures(ctx, tx, loan, now); err != nil {
+		return err
+	}
+	if err := insertDeferrals(ctx, tx, loan, now); err != nil {
+		return err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	loan.CreatedAt = now
+	loan.markUpdated(now)
+	loan.markPersisted()
+	return nil
 }
 
 // GetByID retrieves a loan by ID
-func (r *SQLiteLoanRepository) GetByID(id string) (*Loan, error) {
+func (r *SQLiteLoanRepository) GetByID(ctx context.Context, id string) (*Loan, error) {
 	// Get loan
 	var loan Loan
-	var startDateStr string
-	err := r.db.QueryRow(`
-		SELECT id, principal, apr, start_date, weekly_due, paid_count, outstanding
-		FROM loans WHERE id = ?`, id).Scan(
-		&loan.ID, &loan.Principal, &loan.APR, &startDateStr, &loan.WeeklyDue, &loan.PaidCount, &loan.Outstanding)
+	var externalID sql.NullString
+	var startDate time.Time
+	var status string
+	err := r.conn().QueryRowContext(ctx, `
+		SELECT id, external_id, principal, apr, start_date, timezone, weekly_due, paid_count, outstanding, version,
+			status, written_off_at, written_off_amount, refinanced_from, refinanced_by, refinanced_at, created_at, updated_at
+		FROM loans WHERE id = ? AND deleted_at IS NULL`, id).Scan(
+		&loan.ID, &externalID, &loan.Principal, &loan.APR, scanSQLiteTime(&startDate), &loan.Timezone, &loan.WeeklyDue, &loan.PaidCount, &loan.Outstanding, &loan.Version,
+		&status, scanSQLiteNullTime(&loan.WrittenOffAt), &loan.WrittenOffAmount, &loan.RefinancedFrom, &loan.RefinancedBy, scanSQLiteNullTime(&loan.RefinancedAt),
+		scanSQLiteTime(&loan.CreatedAt), scanSQLiteTime(&loan.UpdatedAt))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrLoanNotFound
@@ -79,79 +226,401 @@ func (r *SQLiteLoanRepository) GetByID(id string) (*Loan, error) {
 		return nil, fmt.Errorf("failed to get loan: %w", err)
 	}
 
+	loan.ExternalID = externalID.String
+	loan.Status = LoanStatus(status)
+
 	// Parse start date
-	loan.StartDate, err = time.Parse("2006-01-02 15:04:05Z07:00", startDateStr)
+	loan.StartDate, err = inTimezone(startDate, loan.Timezone)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse start date: %w", err)
+		return nil, err
 	}
+	loc := loan.Location()
 
 	// Get schedule
-	rows, err := r.db.Query(`
-		SELECT week_index, amount, paid, paid_at
+	rows, err := r.conn().QueryContext(ctx, `
+		SELECT week_index, amount, scheduled_date, due_date, paid, paid_at, deferred, updated_at
 		FROM loan_schedule WHERE loan_id = ? ORDER BY week_index`, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get schedule: %w", err)
 	}
 	defer rows.Close()
 
-	// Initialize schedule array
-	var schedule [50]Week
 	for rows.Next() {
 		var week Week
-		var paidAt *time.Time
-		err := rows.Scan(&week.Index, &week.Amount, &week.Paid, &paidAt)
+		var scheduledDate, dueDate, paidAt *time.Time
+		err := rows.Scan(&week.Index, &week.Amount, scanSQLiteNullTime(&scheduledDate), scanSQLiteNullTime(&dueDate), &week.Paid, scanSQLiteNullTime(&paidAt), &week.Deferred, scanSQLiteTime(&week.UpdatedAt))
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan schedule row: %w", err)
 		}
 		week.PaidAt = paidAt
-		if week.Index >= 1 && week.Index <= 50 {
-			schedule[week.Index-1] = week
+		if dueDate != nil {
+			week.DueDate = dueDate.In(loc)
+		} else {
+			// Rows written before due dates were stored follow the original weekly cadence
+			week.DueDate = loan.StartDate.AddDate(0, 0, 7*week.Index)
+		}
+		if scheduledDate != nil {
+			week.ScheduledDate = scheduledDate.In(loc)
+		} else {
+			// Rows written before holiday rolling were never rolled
+			week.ScheduledDate = week.DueDate
+		}
+		loan.Schedule = append(loan.Schedule, week)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get schedule: %w", err)
+	}
+
+	// Get recoveries
+	recoveryRows, err := r.conn().QueryContext(ctx, `
+		SELECT id, amount, received_at
+		FROM loan_recoveries WHERE loan_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recoveries: %w", err)
+	}
+	defer recoveryRows.Close()
+
+	for recoveryRows.Next() {
+		var recovery Recovery
+		if err := recoveryRows.Scan(&recovery.ID, &recovery.Amount, scanSQLiteTime(&recovery.ReceivedAt)); err != nil {
+			return nil, fmt.Errorf("failed to scan recovery row: %w", err)
+		}
+		loan.Recoveries = append(loan.Recoveries, recovery)
+	}
+	if err := recoveryRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get recoveries: %w", err)
+	}
+
+	// Get restructures
+	restructureRows, err := r.conn().QueryContext(ctx, `
+		SELECT id, reason, restructured_at, before_terms, after_terms
+		FROM loan_restructures WHERE loan_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get restructures: %w", err)
+	}
+	defer restructureRows.Close()
+
+	for restructureRows.Next() {
+		var restructure Restructure
+		var before, after string
+		if err := restructureRows.Scan(&restructure.ID, &restructure.Reason, scanSQLiteTime(&restructure.RestructuredAt), &before, &after); err != nil {
+			return nil, fmt.Errorf("failed to scan restructure row: %w", err)
+		}
+		if err := json.Unmarshal([]byte(before), &restructure.Before); err != nil {
+			return nil, fmt.Errorf("failed to parse restructure terms: %w", err)
 		}
+		if err := json.Unmarshal([]byte(after), &restructure.After); err != nil {
+			return nil, fmt.Errorf("failed to parse restructure terms: %w", err)
+		}
+		loan.Restructures = append(loan.Restructures, restructure)
+	}
+	if err := restructureRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get restructures: %w", err)
 	}
-	loan.Schedule = schedule
 
+	// Get deferrals
+	deferralRows, err := r.conn().QueryContext(ctx, `
+		SELECT id, weeks, moved, reason, deferred_at
+		FROM loan_deferrals WHERE loan_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deferrals: %w", err)
+	}
+	defer deferralRows.Close()
+
+	for deferralRows.Next() {
+		var deferral Deferral
+		var weeks string
+		var moved sql.NullString
+		if err := deferralRows.Scan(&deferral.ID, &weeks, &moved, &deferral.Reason, scanSQLiteTime(&deferral.DeferredAt)); err != nil {
+			return nil, fmt.Errorf("failed to scan deferral row: %w", err)
+		}
+		if err := json.Unmarshal([]byte(weeks), &deferral.Weeks); err != nil {
+			return nil, fmt.Errorf("failed to parse deferred weeks: %w", err)
+		}
+		// Deferrals stored before moved weeks were recorded have none
+		if moved.Valid {
+			if err := json.Unmarshal([]byte(moved.String), &deferral.Moved); err != nil {
+				return nil, fmt.Errorf("failed to parse moved weeks: %w", err)
+			}
+		}
+		loan.Deferrals = append(loan.Deferrals, deferral)
+	}
+	if err := deferralRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get deferrals: %w", err)
+	}
+
+	loan.markPersisted()
 	return &loan, nil
 }
 
-// Update updates an existing loan in the database
-func (r *SQLiteLoanRepository) Update(loan *Loan) error {
-	tx, err := r.db.Begin()
+// GetByExternalID retrieves a loan by the partner's reference
+func (r *SQLiteLoanRepository) GetByExternalID(ctx context.Context, externalID string) (*Loan, error) {
+	var id string
+	err := r.conn().QueryRowContext(ctx, "SELECT id FROM loans WHERE external_id = ? AND deleted_at IS NULL", externalID).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrLoanNotFound
+		}
+		return nil, fmt.Errorf("failed to get loan by external id: %w", err)
+	}
+	return r.GetByID(ctx, id)
+}
+
+// inTimezone moves a stored start date into the loan's time zone
+func inTimezone(startDate time.Time, timezone string) (time.Time, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to load time zone %q: %w", timezone, err)
+	}
+	return startDate.In(loc), nil
+}
+
+// Update updates an existing loan in the database.
+//
+// The write only succeeds when the stored version still matches loan.Version,
+// i.e. nobody else has updated the loan since it was read. Otherwise
+// ErrVersionConflict is returned and the caller should re-read and retry.
+// On success loan.Version is advanced to the newly stored version.
+func (r *SQLiteLoanRepository) Update(ctx context.Context, loan *Loan) error {
+	now := r.clock.Now()
+
+	tx, err := beginTx(ctx, r.db, r.tx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Update loan
-	_, err = tx.Exec(`
-		UPDATE loans SET paid_count = ?, outstanding = ? WHERE id = ?`,
-		loan.PaidCount, loan.Outstanding, loan.ID)
+	// Update loan (compare-and-swap on version)
+	result, err := tx.ExecContext(ctx, `
+		UPDATE loans SET weekly_due = ?, paid_count = ?, outstanding = ?, status = ?, written_off_at = ?, written_off_amount = ?,
+			refinanced_by = ?, refinanced_at = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND version = ? AND deleted_at IS NULL`,
+		loan.WeeklyDue, loan.PaidCount, loan.Outstanding, string(loan.Status), sqliteNullTime(loan.WrittenOffAt), loan.WrittenOffAmount,
+		loan.RefinancedBy, sqliteNullTime(loan.RefinancedAt), sqliteTime(now), loan.ID, loan.Version)
 	if err != nil {
 		return fmt.Errorf("failed to update loan: %w", err)
 	}
 
-	// Update schedule
-	for _, week := range loan.Schedule {
-		var paidAt *time.Time
-		if week.PaidAt != nil {
-			paidAt = week.PaidAt
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		var exists int
+		err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM loans WHERE id = ? AND deleted_at IS NULL", loan.ID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check loan existence: %w", err)
 		}
+		if exists == 0 {
+			return ErrLoanNotFound
+		}
+		return ErrVersionConflict
+	}
 
-		_, err = tx.Exec(`
-			UPDATE loan_schedule SET paid = ?, paid_at = ? WHERE loan_id = ? AND week_index = ?`,
-			week.Paid, paidAt, loan.ID, week.Index)
+	// Write only the weeks that changed since the loan was read; restructuring
+	// and deferrals may change amounts and due dates, reorder weeks and
+	// shorten or lengthen the schedule
+	changed, trimmed := loan.scheduleChanges()
+	for _, week := range changed {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO loan_schedule (loan_id, week_index, amount, scheduled_date, due_date, paid, paid_at, deferred, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (loan_id, week_index) DO UPDATE SET
+				amount = excluded.amount, scheduled_date = excluded.scheduled_date, due_date = excluded.due_date,
+				paid = excluded.paid, paid_at = excluded.paid_at, deferred = excluded.deferred, updated_at = excluded.updated_at`,
+			loan.ID, week.Index, week.Amount, sqliteTime(week.ScheduledDate), sqliteTime(week.DueDate), week.Paid, sqliteNullTime(week.PaidAt), week.Deferred,
+			sqliteTime(now), sqliteTime(now))
 		if err != nil {
 			return fmt.Errorf("failed to update schedule for week %d: %w", week.Index, err)
 		}
 	}
+	if trimmed {
+		_, err = tx.ExecContext(ctx, "DELETE FROM loan_schedule WHERE loan_id = ? AND week_index > ?", loan.ID, len(loan.Schedule))
+		if err != nil {
+			return fmt.Errorf("failed to trim schedule: %w", err)
+		}
+	}
 
-	return tx.Commit()
+	if err := insertRecoveries(ctx, tx, loan, now); err != nil {
+		return err
+	}
+	if err := insertRestructures(ctx, tx, loan, now); err != nil {
+		return err
+	}
+	if err := insertDeferrals(ctx, tx, loan, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	loan.Version++
+	loan.markUpdated(now)
+	loan.markPersisted()
+	return nil
+}
+
+// scheduleBatchSize is how many weeks one INSERT writes. At ten parameters
+// per week it stays below SQLite's default limit of 999 bound parameters.
+const scheduleBatchSize = 90
+
+// sqlDialect describes how statements shared between the SQL repositories
+// bind their parameters
+type sqlDialect struct {
+	placeholder func(n int) string    // the n-th (1-based) parameter marker
+	timestamp   func(t time.Time) any // the stored form of a timestamp
+}
+
+// sqliteDialect binds "?" markers and canonical timestamp text
+var sqliteDialect = sqlDialect{
+	placeholder: func(int) string { return "?" },
+	timestamp:   func(t time.Time) any { return sqliteTime(t) },
+}
+
+// nullTimestamp returns the stored form of t, or nil for NULL
+func (d sqlDialect) nullTimestamp(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return d.timestamp(*t)
+}
+
+// insertSchedule inserts the loan's schedule with one multi-row INSERT per
+// scheduleBatchSize weeks instead of one statement per week, stamping the rows
+// with now
+func insertSchedule(ctx context.Context, tx sqlConn, loan *Loan, now time.Time, dialect sqlDialect) error {
+	for start := 0; start < len(loan.Schedule); start += scheduleBatchSize {
+		weeks := loan.Schedule[start:min(start+scheduleBatchSize, len(loan.Schedule))]
+
+		rows := make([]string, 0, len(weeks))
+		args := make([]any, 0, 10*len(weeks))
+		for _, week := range weeks {
+			markers := make([]string, 10)
+			for i := range markers {
+				markers[i] = dialect.placeholder(len(args) + i + 1)
+			}
+			rows = append(rows, "("+strings.Join(markers, ", ")+")")
+			args = append(args, loan.ID, week.Index, week.Amount, dialect.timestamp(week.ScheduledDate), dialect.timestamp(week.DueDate),
+				week.Paid, dialect.nullTimestamp(week.PaidAt), week.Deferred, dialect.timestamp(now), dialect.timestamp(now))
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO loan_schedule (loan_id, week_index, amount, scheduled_date, due_date, paid, paid_at, deferred, created_at, updated_at)
+			VALUES `+strings.Join(rows, ", "), args...)
+		if err != nil {
+			return fmt.Errorf("failed to insert schedule for weeks %d-%d: %w", weeks[0].Index, weeks[len(weeks)-1].Index, err)
+		}
+	}
+	return nil
+}
+
+// insertRecoveries stores the recoveries of the loan that have not been persisted yet
+func insertRecoveries(ctx context.Context, tx sqlConn, loan *Loan, now time.Time) error {
+	for i := range loan.Recoveries {
+		recovery := &loan.Recoveries[i]
+		if recovery.ID != 0 {
+			continue
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO loan_recoveries (loan_id, amount, received_at, created_at)
+			VALUES (?, ?, ?, ?)`,
+			loan.ID, recovery.Amount, sqliteTime(recovery.ReceivedAt), sqliteTime(now))
+		if err != nil {
+			return fmt.Errorf("failed to insert recovery: %w", err)
+		}
+		recovery.ID, err = result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get recovery id: %w", err)
+		}
+	}
+	return nil
 }
 
-// List returns all loans (for admin purposes)
-func (r *SQLiteLoanRepository) List() ([]*Loan, error) {
-	rows, err := r.db.Query(`
-		SELECT id, principal, apr, start_date, weekly_due, paid_count, outstanding
-		FROM loans ORDER BY start_date DESC`)
+// insertRestructures stores the restructures of the loan that have not been persisted yet
+func insertRestructures(ctx context.Context, tx sqlConn, loan *Loan, now time.Time) error {
+	for i := range loan.Restructures {
+		restructure := &loan.Restructures[i]
+		if restructure.ID != 0 {
+			continue
+		}
+
+		before, err := json.Marshal(restructure.Before)
+		if err != nil {
+			return fmt.Errorf("failed to encode restructure terms: %w", err)
+		}
+		after, err := json.Marshal(restructure.After)
+		if err != nil {
+			return fmt.Errorf("failed to encode restructure terms: %w", err)
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO loan_restructures (loan_id, reason, restructured_at, before_terms, after_terms, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			loan.ID, restructure.Reason, sqliteTime(restructure.RestructuredAt), string(before), string(after), sqliteTime(now))
+		if err != nil {
+			return fmt.Errorf("failed to insert restructure: %w", err)
+		}
+		restructure.ID, err = result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get restructure id: %w", err)
+		}
+	}
+	return nil
+}
+
+// insertDeferrals stores the deferrals of the loan that have not been persisted yet
+func insertDeferrals(ctx context.Context, tx sqlConn, loan *Loan, now time.Time) error {
+	for i := range loan.Deferrals {
+		deferral := &loan.Deferrals[i]
+		if deferral.ID != 0 {
+			continue
+		}
+
+		weeks, err := json.Marshal(deferral.Weeks)
+		if err != nil {
+			return fmt.Errorf("failed to encode deferred weeks: %w", err)
+		}
+		moved, err := json.Marshal(deferral.Moved)
+		if err != nil {
+			return fmt.Errorf("failed to encode moved weeks: %w", err)
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO loan_deferrals (loan_id, weeks, moved, reason, deferred_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			loan.ID, string(weeks), string(moved), deferral.Reason, sqliteTime(deferral.DeferredAt), sqliteTime(now))
+		if err != nil {
+			return fmt.Errorf("failed to insert deferral: %w", err)
+		}
+		deferral.ID, err = result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get deferral id: %w", err)
+		}
+	}
+	return nil
+}
+
+// List returns the loans matching filter (for admin purposes)
+func (r *SQLiteLoanRepository) List(ctx context.Context, filter LoanFilter) ([]*Loan, error) {
+	var conditions []string
+	var args []any
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if !filter.UpdatedSince.IsZero() {
+		conditions = append(conditions, "updated_at >= ?")
+		args = append(args, sqliteTime(filter.UpdatedSince))
+	}
+	var where string
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := r.conn().QueryContext(ctx, `
+		SELECT id, external_id, principal, apr, start_date, timezone, weekly_due, paid_count, outstanding, version,
+			status, written_off_at, written_off_amount, refinanced_from, refinanced_by, refinanced_at, created_at, updated_at, deleted_at
+		FROM loans `+where+` ORDER BY start_date DESC`, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list loans: %w", err)
 	}
@@ -160,51 +629,285 @@ func (r *SQLiteLoanRepository) List() ([]*Loan, error) {
 	var loans []*Loan
 	for rows.Next() {
 		var loan Loan
-		var startDateStr string
-		err := rows.Scan(&loan.ID, &loan.Principal, &loan.APR, &startDateStr, &loan.WeeklyDue, &loan.PaidCount, &loan.Outstanding)
+		var externalID sql.NullString
+		var startDate time.Time
+		var status string
+		err := rows.Scan(&loan.ID, &externalID, &loan.Principal, &loan.APR, scanSQLiteTime(&startDate), &loan.Timezone, &loan.WeeklyDue, &loan.PaidCount, &loan.Outstanding, &loan.Version,
+			&status, scanSQLiteNullTime(&loan.WrittenOffAt), &loan.WrittenOffAmount, &loan.RefinancedFrom, &loan.RefinancedBy, scanSQLiteNullTime(&loan.RefinancedAt),
+			scanSQLiteTime(&loan.CreatedAt), scanSQLiteTime(&loan.UpdatedAt), scanSQLiteNullTime(&loan.DeletedAt))
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan loan row: %w", err)
 		}
+		loan.ExternalID = externalID.String
+		loan.Status = LoanStatus(status)
 
-		loan.StartDate, err = time.Parse("2006-01-02 15:04:05Z07:00", startDateStr)
+		loan.StartDate, err = inTimezone(startDate, loan.Timezone)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse start date: %w", err)
+			return nil, err
 		}
 
 		loans = append(loans, &loan)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list loans: %w", err)
+	}
 
 	return loans, nil
 }
 
-// Delete removes a loan from the database
-func (r *SQLiteLoanRepository) Delete(id string) error {
-	tx, err := r.db.Begin()
+// Delete soft-deletes a loan: its rows are kept and stamped with deleted_at,
+// and reads skip the loan until it is restored
+func (r *SQLiteLoanRepository) Delete(ctx context.Context, id string) error {
+	now := sqliteTime(r.clock.Now())
+	result, err := r.conn().ExecContext(ctx, `
+		UPDATE loans SET deleted_at = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND deleted_at IS NULL`, now, now, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete loan: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrLoanNotFound
+	}
+	return nil
+}
+
+// Archive moves the paid-off loans last written before before, with their
+// schedules and histories, into the archive tables and returns their IDs.
+// Journal entries and accruals stay where they are.
+func (r *SQLiteLoanRepository) Archive(ctx context.Context, before time.Time) ([]string, error) {
+	now := r.clock.Now()
+
+	tx, err := beginTx(ctx, r.db, r.tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM loans WHERE status = ? AND updated_at < ? ORDER BY id",
+		string(LoanStatusPaidOff), sqliteTime(before))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find loans to archive: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan loan id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find loans to archive: %w", err)
+	}
+
+	for _, id := range ids {
+		if err := archiveLoan(ctx, tx, id, now, sqliteDialect); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return ids, nil
+}
+
+// Restore brings back a deleted or archived loan. It returns ErrLoanNotFound
+// when there is no such loan and ErrLoanNotDeleted when it is neither.
+func (r *SQLiteLoanRepository) Restore(ctx context.Context, id string) error {
+	now := r.clock.Now()
+
+	tx, err := beginTx(ctx, r.db, r.tx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var archived int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM loans_archive WHERE id = ?", id).Scan(&archived); err != nil {
+		return fmt.Errorf("failed to check archived loans: %w", err)
+	}
+	if archived > 0 {
+		if err := unarchiveLoan(ctx, tx, id, sqliteDialect); err != nil {
+			return err
+		}
+	} else {
+		var deleted bool
+		err := tx.QueryRowContext(ctx, "SELECT deleted_at IS NOT NULL FROM loans WHERE id = ?", id).Scan(&deleted)
+		if err == sql.ErrNoRows {
+			return ErrLoanNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get loan: %w", err)
+		}
+		if !deleted {
+			return ErrLoanNotDeleted
+		}
+	}
+
+	// A restored loan counts as written now, so it is not archived again at once
+	_, err = tx.ExecContext(ctx, "UPDATE loans SET deleted_at = NULL, updated_at = ?, version = version + 1 WHERE id = ?", sqliteTime(now), id)
+	if err != nil {
+		return fmt.Errorf("failed to restore loan: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// PostJournalEntry stores a balanced journal entry, one row per line
+func (r *SQLiteLoanRepository) PostJournalEntry(ctx context.Context, entry *JournalEntry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	now := r.clock.Now()
+
+	tx, err := beginTx(ctx, r.db, r.tx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Delete schedule first (foreign key constraint)
-	_, err = tx.Exec("DELETE FROM loan_schedule WHERE loan_id = ?", id)
+	for i, line := range entry.Lines {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO journal_entries (entry_id, line_no, loan_id, event, account, debit, credit, posted_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			entry.ID, i+1, entry.LoanID, string(entry.Event), line.Account, line.Debit, line.Credit, sqliteTime(entry.PostedAt), sqliteTime(now))
+		if err != nil {
+			return fmt.Errorf("failed to insert journal line %d of %s: %w", i+1, entry.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetJournalEntry returns the journal entry with the given ID
+func (r *SQLiteLoanRepository) GetJournalEntry(ctx context.Context, id string) (*JournalEntry, error) {
+	rows, err := r.conn().QueryContext(ctx, `
+		SELECT entry_id, loan_id, event, account, debit, credit, posted_at
+		FROM journal_entries
+		WHERE entry_id = ?
+		ORDER BY line_no`, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete schedule: %w", err)
+		return nil, fmt.Errorf("failed to get journal entry: %w", err)
 	}
+	defer rows.Close()
 
-	// Delete loan
-	result, err := tx.Exec("DELETE FROM loans WHERE id = ?", id)
+	entries, err := scanSQLiteJournal(rows)
 	if err != nil {
-		return fmt.Errorf("failed to delete loan: %w", err)
+		return nil, fmt.Errorf("failed to get journal entry: %w", err)
 	}
+	if len(entries) == 0 {
+		return nil, ErrJournalEntryNotFound
+	}
+	return entries[0], nil
+}
 
-	rowsAffected, err := result.RowsAffected()
+// ListJournalEntries returns the journal entries posted in [from, to), oldest first
+func (r *SQLiteLoanRepository) ListJournalEntries(ctx context.Context, from, to time.Time) ([]*JournalEntry, error) {
+	rows, err := r.conn().QueryContext(ctx, `
+		SELECT entry_id, loan_id, event, account, debit, credit, posted_at
+		FROM journal_entries
+		WHERE posted_at >= ? AND posted_at < ?
+		ORDER BY posted_at, entry_id, line_no`, sqliteTime(from), sqliteTime(to))
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return nil, fmt.Errorf("failed to list journal entries: %w", err)
 	}
+	defer rows.Close()
 
-	if rowsAffected == 0 {
-		return ErrLoanNotFound
+	entries, err := scanSQLiteJournal(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list journal entries: %w", err)
+	}
+	return entries, nil
+}
+
+// scanSQLiteJournal groups journal rows, ordered by entry, into entries
+func scanSQLiteJournal(rows *sql.Rows) ([]*JournalEntry, error) {
+	var entries []*JournalEntry
+	byID := make(map[string]*JournalEntry)
+	for rows.Next() {
+		var (
+			entryID, loanID, event string
+			line                   JournalLine
+			postedAt               time.Time
+		)
+		if err := rows.Scan(&entryID, &loanID, &event, &line.Account, &line.Debit, &line.Credit, scanSQLiteTime(&postedAt)); err != nil {
+			return nil, fmt.Errorf("failed to scan journal row: %w", err)
+		}
+
+		entry, ok := byID[entryID]
+		if !ok {
+			entry = &JournalEntry{
+				ID:       entryID,
+				LoanID:   loanID,
+				Event:    JournalEvent(event),
+				PostedAt: postedAt,
+			}
+			byID[entryID] = entry
+			entries = append(entries, entry)
+		}
+		entry.Lines = append(entry.Lines, line)
+	}
+	return entries, rows.Err()
+}
+
+// SaveAccruals stores daily interest accrual records
+func (r *SQLiteLoanRepository) SaveAccruals(ctx context.Context, accruals []InterestAccrual) error {
+	now := r.clock.Now()
+
+	tx, err := beginTx(ctx, r.db, r.tx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, accrual := range accruals {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO interest_accruals (loan_id, accrual_date, amount, method, created_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			accrual.LoanID, sqliteTime(accrual.Date), accrual.Amount, string(accrual.Method), sqliteTime(now))
+		if err != nil {
+			return fmt.Errorf("failed to insert accrual for %s on %s: %w", accrual.LoanID, accrual.Date.Format("2006-01-02"), err)
+		}
 	}
 
 	return tx.Commit()
 }
+
+// ListAccruals returns the accrual records of a loan, oldest first
+func (r *SQLiteLoanRepository) ListAccruals(ctx context.Context, loanID string) ([]InterestAccrual, error) {
+	rows, err := r.conn().QueryContext(ctx, `
+		SELECT loan_id, accrual_date, amount, method
+		FROM interest_accruals WHERE loan_id = ? ORDER BY accrual_date`, loanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accruals: %w", err)
+	}
+	defer rows.Close()
+
+	var accruals []InterestAccrual
+	for rows.Next() {
+		var accrual InterestAccrual
+		var method string
+		if err := rows.Scan(&accrual.LoanID, scanSQLiteTime(&accrual.Date), &accrual.Amount, &method); err != nil {
+			return nil, fmt.Errorf("failed to scan accrual row: %w", err)
+		}
+		accrual.Method = AccrualMethod(method)
+		accruals = append(accruals, accrual)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list accruals: %w", err)
+	}
+
+	return accruals, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// archivedTables lists the tables whose rows archiving moves, loans first.
+// Each has an archive table of the same name with an "_archive" suffix and the
+// same columns; loans_archive also records when the loan was archived.
+var archivedTables = []struct {
+	table   string
+	key     string // column holding the loan ID
+	columns string
+}{
+	{"loans", "id", "id, external_id, principal, apr, start_date, timezone, weekly_due, paid_count, outstanding, version, " +
+		"status, written_off_at, written_off_amount, refinanced_from, refinanced_by, refinanced_at, created_at, updated_at, deleted_at"},
+	{"loan_schedule", "loan_id", "loan_id, week_index, amount, scheduled_date, due_date, paid, paid_at, deferred, created_at, updated_at"},
+	{"loan_recoveries", "loan_id", "id, loan_id, amount, received_at, created_at"},
+	{"loan_restructures", "loan_id", "id, loan_id, reason, restructured_at, before_terms, after_terms, created_at"},
+	{"loan_deferrals", "loan_id", "id, loan_id, weeks, moved, reason, deferred_at, created_at"},
+}
+
+// archiveLoan moves the rows of loan id into the archive tables, stamped as
+// archived at now
+func archiveLoan(ctx context.Context, tx sqlConn, id string, now time.Time, dialect sqlDialect) error {
+	if err := moveLoanRows(ctx, tx, id, "", "_archive", dialect); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE loans_archive SET archived_at = %s WHERE id = %s`,
+		dialect.placeholder(1), dialect.placeholder(2)), dialect.timestamp(now), id)
+	if err != nil {
+		return fmt.Errorf("failed to stamp archived loan %s: %w", id, err)
+	}
+	return nil
+}
+
+// unarchiveLoan moves the rows of loan id back out of the archive tables
+func unarchiveLoan(ctx context.Context, tx sqlConn, id string, dialect sqlDialect) error {
+	return moveLoanRows(ctx, tx, id, "_archive", "", dialect)
+}
+
+// moveLoanRows copies the rows of loan id from the tables with suffix from to
+// those with suffix to, then deletes the originals, children first
+func moveLoanRows(ctx context.Context, tx sqlConn, id, from, to string, dialect sqlDialect) error {
+	for _, t := range archivedTables {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM %s WHERE %s = %s`,
+			t.table+to, t.columns, t.columns, t.table+from, t.key, dialect.placeholder(1)), id)
+		if err != nil {
+			return fmt.Errorf("failed to copy %s of loan %s: %w", t.table, id, err)
+		}
+	}
+	for i := len(archivedTables) - 1; i >= 0; i-- {
+		t := archivedTables[i]
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE %s = %s`, t.table+from, t.key, dialect.placeholder(1)), id)
+		if err != nil {
+			return fmt.Errorf("failed to remove %s of loan %s: %w", t.table, id, err)
+		}
+	}
+	return nil
+}
+
+// checkArchived returns ErrLoanExists or ErrExternalIDExists when an archived
+// loan holds the ID or partner reference of loan, which a restore would need
+func checkArchived(ctx context.Context, tx sqlConn, loan *Loan, dialect sqlDialect) error {
+	var id string
+	err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT id FROM loans_archive WHERE id = %s OR external_id = %s`,
+		dialect.placeholder(1), dialect.placeholder(2)),
+		loan.ID, sql.NullString{String: loan.ExternalID, Valid: loan.ExternalID != ""}).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to check archived loans: %w", err)
+	case id == loan.ID:
+		return ErrLoanExists
+	default:
+		return ErrExternalIDExists
+	}
+}
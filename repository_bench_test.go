@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// newBenchDB opens a file-backed SQLite database, so that benchmarks pay for
+// real statements and commits
+func newBenchDB(b *testing.B) *sql.DB {
+	requireSQLite(b)
+	db, err := sql.Open("sqlite3", filepath.Join(b.TempDir(), "pinjol.db"))
+	if err != nil {
+		b.Fatalf("Failed to open database: %v", err)
+	}
+	b.Cleanup(func() { db.Close() })
+	if err := InitDatabase(db); err != nil {
+		b.Fatalf("Failed to initialize database: %v", err)
+	}
+	return db
+}
+
+// newBenchLoan stores a fresh 50-week loan
+func newBenchLoan(b *testing.B, repo LoanRepository, id string) *Loan {
+	loan, err := NewLoan(id, 5_000_000, 0.1, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		b.Fatalf("Failed to create loan: %v", err)
+	}
+	if err := repo.Create(context.Background(), loan); err != nil {
+		b.Fatalf("Failed to store loan: %v", err)
+	}
+	return loan
+}
+
+// BenchmarkScheduleInsert compares writing a 50-week schedule with batched
+// INSERTs against one INSERT per week
+func BenchmarkScheduleInsert(b *testing.B) {
+	ctx := context.Background()
+	loan, err := NewLoan("bench-loan", 5_000_000, 0.1, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		b.Fatalf("Failed to create loan: %v", err)
+	}
+
+	inserts := []struct {
+		name   string
+		insert func(tx *sql.Tx) error
+	}{
+		{"batched", func(tx *sql.Tx) error {
+			return insertSchedule(ctx, tx, loan, time.Now(), sqliteDialect)
+		}},
+		{"per-week", func(tx *sql.Tx) error {
+			for _, week := range loan.Schedule {
+				_, err := tx.ExecContext(ctx, `
+					INSERT INTO loan_schedule (loan_id, week_index, amount, scheduled_date, due_date, paid, paid_at, deferred)
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+					loan.ID, week.Index, week.Amount, week.ScheduledDate, week.DueDate, week.Paid, week.PaidAt, week.Deferred)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+	}
+
+	for _, tt := range inserts {
+		b.Run(tt.name, func(b *testing.B) {
+			db := newBenchDB(b)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tx, err := db.BeginTx(ctx, nil)
+				if err != nil {
+					b.Fatalf("Failed to begin transaction: %v", err)
+				}
+				if err := tt.insert(tx); err != nil {
+					b.Fatalf("Failed to insert schedule: %v", err)
+				}
+				tx.Rollback() // keep the table empty for the next iteration
+			}
+		})
+	}
+}
+
+// BenchmarkSQLiteLoanRepository_Create stores whole loans
+func BenchmarkSQLiteLoanRepository_Create(b *testing.B) {
+	repo := NewSQLiteLoanRepository(newBenchDB(b))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		newBenchLoan(b, repo, fmt.Sprintf("bench-%d", i))
+	}
+}
+
+// BenchmarkSQLiteLoanRepository_Update compares writing back only the weeks a
+// payment changed against rewriting the whole schedule, which is what Update
+// does for a loan whose stored schedule it does not know
+func BenchmarkSQLiteLoanRepository_Update(b *testing.B) {
+	for _, wholeSchedule := range []bool{false, true} {
+		name := "changed-weeks"
+		if wholeSchedule {
+			name = "whole-schedule"
+		}
+		b.Run(name, func(b *testing.B) {
+			ctx := context.Background()
+			repo := NewSQLiteLoanRepository(newBenchDB(b))
+			loan := newBenchLoan(b, repo, "bench-loan")
+			paidAt := time.Date(2025, 8, 8, 0, 0, 0, 0, time.UTC)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Toggle one installment between paid and unpaid
+				week := &loan.Schedule[0]
+				week.Paid = !week.Paid
+				week.PaidAt = nil
+				if week.Paid {
+					week.PaidAt = &paidAt
+				}
+				if wholeSchedule {
+					loan.persisted = nil
+				}
+				if err := repo.Update(ctx, loan); err != nil {
+					b.Fatalf("Failed to update loan: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkPayLoanAPI measures the whole pay path: request, unit of work,
+// schedule write and journal entry
+func BenchmarkPayLoanAPI(b *testing.B) {
+	repo := NewSQLiteLoanRepository(newBenchDB(b))
+	e := newServer()
+	registerRoutes(e, repo, defaultServiceConfig())
+
+	var loan *Loan
+	for i := 0; i < b.N; i++ {
+		// A loan takes 50 payments; start a new one when it is paid off
+		if i%50 == 0 {
+			b.StopTimer()
+			loan = newBenchLoan(b, repo, fmt.Sprintf("bench-%d", i/50))
+			b.StartTimer()
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/loans/"+loan.ID+"/pay", strings.NewReader(`{"amount": 110000}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			b.Fatalf("Payment failed with %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,724 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryLoanRepository implements LoanRepository in memory. It needs neither
+// cgo nor a database file, which makes it suitable for tests and demos; its
+// contents are lost when the process exits. Loans are copied on the way in and
+// out, so callers never share state with the repository or with each other.
+// Every method fails with the context's error once it is cancelled.
+type MemoryLoanRepository struct {
+	mu sync.RWMutex
+	memoryState
+}
+
+// memoryState is everything a MemoryLoanRepository stores. Its methods do the
+// work of the repository methods without locking.
+type memoryState struct {
+	loans       map[string]*Loan
+	archived    map[string]*Loan
+	externalIDs map[string]string // external ID -> loan ID, archived loans included
+	journal     []*JournalEntry
+	accruals    []InterestAccrual
+	clock       Clock
+	undo        *memoryUndo // set while a unit of work runs
+
+	lastRecoveryID    int64
+	lastRestructureID int64
+	lastDeferralID    int64
+}
+
+// NewMemoryLoanRepository creates an empty in-memory repository
+func NewMemoryLoanRepository() *MemoryLoanRepository {
+	return &MemoryLoanRepository{memoryState: memoryState{
+		loans:       make(map[string]*Loan),
+		archived:    make(map[string]*Loan),
+		externalIDs: make(map[string]string),
+		clock:       SystemClock,
+	}}
+}
+
+// WithClock sets the clock used to stamp when loans are created and updated
+func (r *MemoryLoanRepository) WithClock(clock Clock) *MemoryLoanRepository {
+	r.clock = clock
+	return r
+}
+
+// Create stores a new loan. It returns ErrLoanExists when the loan's ID is
+// already taken and ErrExternalIDExists when its external ID is.
+func (r *MemoryLoanRepository) Create(ctx context.Context, loan *Loan) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.create(loan)
+}
+
+func (s *memoryState) create(loan *Loan) error {
+	if _, ok := s.loans[loan.ID]; ok {
+		return ErrLoanExists
+	}
+	if _, ok := s.archived[loan.ID]; ok {
+		return ErrLoanExists
+	}
+	s.touch(loan.ID)
+	if loan.ExternalID != "" {
+		if _, ok := s.externalIDs[loan.ExternalID]; ok {
+			return ErrExternalIDExists
+		}
+		s.externalIDs[loan.ExternalID] = loan.ID
+		if s.undo != nil {
+			s.undo.externalIDs = append(s.undo.externalIDs, loan.ExternalID)
+		}
+	}
+
+	now := s.clock.Now()
+	loan.CreatedAt = now
+	loan.UpdatedAt = now
+	for i := range loan.Schedule {
+		loan.Schedule[i].UpdatedAt = now
+	}
+
+	s.assignIDs(loan)
+	s.loans[loan.ID] = copyLoan(loan)
+	return nil
+}
+
+// GetByID retrieves a loan by ID
+func (r *MemoryLoanRepository) GetByID(ctx context.Context, id string) (*Loan, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.getByID(id)
+}
+
+func (s *memoryState) getByID(id string) (*Loan, error) {
+	loan, ok := s.loans[id]
+	if !ok || loan.DeletedAt != nil {
+		return nil, ErrLoanNotFound
+	}
+	return copyLoan(loan), nil
+}
+
+// GetByExternalID retrieves a loan by the partner's reference
+func (r *MemoryLoanRepository) GetByExternalID(ctx context.Context, externalID string) (*Loan, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.getByExternalID(externalID)
+}
+
+func (s *memoryState) getByExternalID(externalID string) (*Loan, error) {
+	id, ok := s.externalIDs[externalID]
+	if !ok {
+		return nil, ErrLoanNotFound
+	}
+	return s.getByID(id)
+}
+
+// Update updates an existing loan.
+//
+// Like the SQL repositories it only changes what payments, write-offs,
+// restructures, deferrals and refinancing can change, stores recoveries,
+// restructures and deferrals that have no ID yet, and succeeds only when the
+// stored version still matches loan.Version; otherwise ErrVersionConflict is
+// returned. On success loan.Version is advanced to the newly stored version.
+func (r *MemoryLoanRepository) Update(ctx context.Context, loan *Loan) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.update(loan)
+}
+
+func (s *memoryState) update(loan *Loan) error {
+	stored, ok := s.loans[loan.ID]
+	if !ok || stored.DeletedAt != nil {
+		return ErrLoanNotFound
+	}
+	if stored.Version != loan.Version {
+		return ErrVersionConflict
+	}
+	s.touch(loan.ID)
+
+	// Weeks keep their stamp unless they changed
+	now := s.clock.Now()
+	loan.UpdatedAt = now
+	for i := range loan.Schedule {
+		if i < len(stored.Schedule) && loan.Schedule[i].equal(stored.Schedule[i]) {
+			loan.Schedule[i].UpdatedAt = stored.Schedule[i].UpdatedAt
+		} else {
+			loan.Schedule[i].UpdatedAt = now
+		}
+	}
+
+	s.assignIDs(loan)
+	updated := copyLoan(loan)
+
+	stored.WeeklyDue = updated.WeeklyDue
+	stored.PaidCount = updated.PaidCount
+	stored.Outstanding = updated.Outstanding
+	stored.Status = updated.Status
+	stored.WrittenOffAt = updated.WrittenOffAt
+	stored.WrittenOffAmount = updated.WrittenOffAmount
+	stored.RefinancedBy = updated.RefinancedBy
+	stored.RefinancedAt = updated.RefinancedAt
+	stored.Schedule = updated.Schedule
+	stored.UpdatedAt = updated.UpdatedAt
+	stored.Recoveries = appendNew(stored.Recoveries, updated.Recoveries, func(rec Recovery) int64 { return rec.ID })
+	stored.Restructures = appendNew(stored.Restructures, updated.Restructures, func(rs Restructure) int64 { return rs.ID })
+	stored.Deferrals = appendNew(stored.Deferrals, updated.Deferrals, func(d Deferral) int64 { return d.ID })
+	stored.Version++
+
+	loan.Version++
+	return nil
+}
+
+// assignIDs numbers the recoveries, restructures and deferrals of the loan
+// that have not been stored yet
+func (s *memoryState) assignIDs(loan *Loan) {
+	for i := range loan.Recoveries {
+		if loan.Recoveries[i].ID == 0 {
+			s.lastRecoveryID++
+			loan.Recoveries[i].ID = s.lastRecoveryID
+		}
+	}
+	for i := range loan.Restructures {
+		if loan.Restructures[i].ID == 0 {
+			s.lastRestructureID++
+			loan.Restructures[i].ID = s.lastRestructureID
+		}
+	}
+	for i := range loan.Deferrals {
+		if loan.Deferrals[i].ID == 0 {
+			s.lastDeferralID++
+			loan.Deferrals[i].ID = s.lastDeferralID
+		}
+	}
+}
+
+// appendNew appends the records of updated that stored does not hold yet
+func appendNew[T any](stored, updated []T, id func(T) int64) []T {
+	known := make(map[int64]bool, len(stored))
+	for _, record := range stored {
+		known[id(record)] = true
+	}
+	for _, record := range updated {
+		if !known[id(record)] {
+			stored = append(stored, record)
+		}
+	}
+	return stored
+}
+
+// List returns the loans matching filter without their schedules and
+// histories, latest start date first (for admin purposes)
+func (r *MemoryLoanRepository) List(ctx context.Context, filter LoanFilter) ([]*Loan, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.list(filter)
+}
+
+func (s *memoryState) list(filter LoanFilter) ([]*Loan, error) {
+	var loans []*Loan
+	for _, stored := range s.loans {
+		if !filter.matches(stored) {
+			continue
+		}
+		summary := *copyLoan(stored)
+		summary.Schedule = nil
+		summary.Recoveries = nil
+		summary.Restructures = nil
+		summary.Deferrals = nil
+		loans = append(loans, &summary)
+	}
+	sort.Slice(loans, func(i, j int) bool {
+		if !loans[i].StartDate.Equal(loans[j].StartDate) {
+			return loans[i].StartDate.After(loans[j].StartDate)
+		}
+		return loans[i].ID < loans[j].ID
+	})
+	return loans, nil
+}
+
+// Delete soft-deletes a loan: it is kept, stamped with DeletedAt, and reads
+// skip it until it is restored
+func (r *MemoryLoanRepository) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.delete(id)
+}
+
+func (s *memoryState) delete(id string) error {
+	loan, ok := s.loans[id]
+	if !ok || loan.DeletedAt != nil {
+		return ErrLoanNotFound
+	}
+	s.touch(id)
+	now := s.clock.Now()
+	loan.DeletedAt = &now
+	loan.UpdatedAt = now
+	loan.Version++
+	return nil
+}
+
+// Archive moves the paid-off loans last updated before before out of reach of
+// reads and returns their IDs
+func (r *MemoryLoanRepository) Archive(ctx context.Context, before time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.archive(before)
+}
+
+func (s *memoryState) archive(before time.Time) ([]string, error) {
+	var ids []string
+	for id, loan := range s.loans {
+		if loan.Status == LoanStatusPaidOff && loan.UpdatedAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		s.touch(id)
+		s.archived[id] = s.loans[id]
+		delete(s.loans, id)
+	}
+	return ids, nil
+}
+
+// Restore brings back a deleted or archived loan. It returns ErrLoanNotFound
+// when there is no such loan and ErrLoanNotDeleted when it is neither.
+func (r *MemoryLoanRepository) Restore(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.restore(id)
+}
+
+func (s *memoryState) restore(id string) error {
+	s.touch(id)
+	loan, archived := s.archived[id]
+	if archived {
+		delete(s.archived, id)
+		s.loans[id] = loan
+	} else {
+		var ok bool
+		if loan, ok = s.loans[id]; !ok {
+			return ErrLoanNotFound
+		}
+		if loan.DeletedAt == nil {
+			return ErrLoanNotDeleted
+		}
+	}
+
+	// A restored loan counts as written now, so it is not archived again at once
+	loan.DeletedAt = nil
+	loan.UpdatedAt = s.clock.Now()
+	loan.Version++
+	return nil
+}
+
+// PostJournalEntry stores a balanced journal entry. Posting an entry ID twice
+// is rejected.
+func (r *MemoryLoanRepository) PostJournalEntry(ctx context.Context, entry *JournalEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.postJournalEntry(entry)
+}
+
+func (s *memoryState) postJournalEntry(entry *JournalEntry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	for _, posted := range s.journal {
+		if posted.ID == entry.ID {
+			return fmt.Errorf("journal entry %s is already posted", entry.ID)
+		}
+	}
+
+	stored := *entry
+	stored.PostedAt = entry.PostedAt.UTC()
+	stored.Lines = append([]JournalLine(nil), entry.Lines...)
+	s.journal = append(s.journal, &stored)
+	return nil
+}
+
+// GetJournalEntry returns the journal entry with the given ID
+func (r *MemoryLoanRepository) GetJournalEntry(ctx context.Context, id string) (*JournalEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.getJournalEntry(id)
+}
+
+func (s *memoryState) getJournalEntry(id string) (*JournalEntry, error) {
+	for _, posted := range s.journal {
+		if posted.ID == id {
+			entry := *posted
+			entry.Lines = append([]JournalLine(nil), posted.Lines...)
+			return &entry, nil
+		}
+	}
+	return nil, ErrJournalEntryNotFound
+}
+
+// ListJournalEntries returns the journal entries posted in [from, to), oldest first
+func (r *MemoryLoanRepository) ListJournalEntries(ctx context.Context, from, to time.Time) ([]*JournalEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.listJournalEntries(from, to)
+}
+
+func (s *memoryState) listJournalEntries(from, to time.Time) ([]*JournalEntry, error) {
+	var entries []*JournalEntry
+	for _, posted := range s.journal {
+		if posted.PostedAt.Before(from) || !posted.PostedAt.Before(to) {
+			continue
+		}
+		entry := *posted
+		entry.Lines = append([]JournalLine(nil), posted.Lines...)
+		entries = append(entries, &entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].PostedAt.Equal(entries[j].PostedAt) {
+			return entries[i].PostedAt.Before(entries[j].PostedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
+
+// SaveAccruals stores daily interest accrual records. Nothing is stored when
+// a loan already has an accrual for one of the days.
+func (r *MemoryLoanRepository) SaveAccruals(ctx context.Context, accruals []InterestAccrual) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.saveAccruals(accruals)
+}
+
+func (s *memoryState) saveAccruals(accruals []InterestAccrual) error {
+	type accrualKey struct {
+		loanID string
+		date   time.Time
+	}
+	seen := make(map[accrualKey]bool, len(s.accruals)+len(accruals))
+	for _, accrual := range s.accruals {
+		seen[accrualKey{accrual.LoanID, accrual.Date}] = true
+	}
+	for _, accrual := range accruals {
+		key := accrualKey{accrual.LoanID, accrual.Date.UTC()}
+		if seen[key] {
+			return fmt.Errorf("failed to insert accrual for %s on %s: already accrued", accrual.LoanID, accrual.Date.Format("2006-01-02"))
+		}
+		seen[key] = true
+	}
+
+	for _, accrual := range accruals {
+		accrual.Date = accrual.Date.UTC()
+		s.accruals = append(s.accruals, accrual)
+	}
+	return nil
+}
+
+// ListAccruals returns the accrual records of a loan, oldest first
+func (r *MemoryLoanRepository) ListAccruals(ctx context.Context, loanID string) ([]InterestAccrual, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.listAccruals(loanID)
+}
+
+func (s *memoryState) listAccruals(loanID string) ([]InterestAccrual, error) {
+	var accruals []InterestAccrual
+	for _, accrual := range s.accruals {
+		if accrual.LoanID == loanID {
+			accruals = append(accruals, accrual)
+		}
+	}
+	sort.SliceStable(accruals, func(i, j int) bool {
+		return accruals[i].Date.Before(accruals[j].Date)
+	})
+	return accruals, nil
+}
+
+// WithTx runs fn as one unit of work. The repository stays locked until fn
+// returns, so nothing else reads or writes in between, and everything fn did
+// through tx is undone when it returns an error. Only the loans the unit
+// changes are copied to roll back to, so a unit costs what it touches.
+func (r *MemoryLoanRepository) WithTx(ctx context.Context, fn func(tx LoanRepository) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.begin()
+	defer func() { r.undo = nil }()
+	if err := fn(memoryTx{&r.memoryState}); err != nil {
+		r.rollback()
+		return err
+	}
+	return nil
+}
+
+// memoryUndo records what the running unit of work changed, so that it can
+// be rolled back without copying the loans it never touched
+type memoryUndo struct {
+	loans       map[string]*Loan // loan ID -> stored loan before the unit changed it, nil when there was none
+	archived    map[string]*Loan // the same for archived loans
+	externalIDs []string         // external IDs the unit took
+	journal     int              // entries posted before the unit
+	accruals    int              // accruals stored before the unit
+
+	lastRecoveryID    int64
+	lastRestructureID int64
+	lastDeferralID    int64
+}
+
+// begin starts recording changes for a unit of work
+func (s *memoryState) begin() {
+	s.undo = &memoryUndo{
+		loans:             make(map[string]*Loan),
+		archived:          make(map[string]*Loan),
+		journal:           len(s.journal),
+		accruals:          len(s.accruals),
+		lastRecoveryID:    s.lastRecoveryID,
+		lastRestructureID: s.lastRestructureID,
+		lastDeferralID:    s.lastDeferralID,
+	}
+}
+
+// touch saves the loan with the given ID, live or archived, as it was before
+// the running unit first changed it. Outside a unit it does nothing.
+func (s *memoryState) touch(id string) {
+	if s.undo == nil {
+		return
+	}
+	if _, ok := s.undo.loans[id]; ok {
+		return
+	}
+	s.undo.loans[id] = copyStoredLoan(s.loans[id])
+	s.undo.archived[id] = copyStoredLoan(s.archived[id])
+}
+
+// rollback undoes everything the running unit changed
+func (s *memoryState) rollback() {
+	u := s.undo
+	for id, loan := range u.loans {
+		restoreStoredLoan(s.loans, id, loan)
+		restoreStoredLoan(s.archived, id, u.archived[id])
+	}
+	for _, externalID := range u.externalIDs {
+		delete(s.externalIDs, externalID)
+	}
+	s.journal = s.journal[:u.journal]
+	s.accruals = s.accruals[:u.accruals]
+	s.lastRecoveryID = u.lastRecoveryID
+	s.lastRestructureID = u.lastRestructureID
+	s.lastDeferralID = u.lastDeferralID
+}
+
+// copyStoredLoan copies a stored loan, which may be nil
+func copyStoredLoan(loan *Loan) *Loan {
+	if loan == nil {
+		return nil
+	}
+	return copyLoan(loan)
+}
+
+// restoreStoredLoan puts loan back under id, or removes id when loan is nil
+func restoreStoredLoan(loans map[string]*Loan, id string, loan *Loan) {
+	if loan == nil {
+		delete(loans, id)
+	} else {
+		loans[id] = loan
+	}
+}
+
+// memoryTx is the repository handed to a unit of work. The unit already holds
+// the repository's lock, so its calls go straight to the state.
+type memoryTx struct {
+	s *memoryState
+}
+
+func (tx memoryTx) Create(ctx context.Context, loan *Loan) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return tx.s.create(loan)
+}
+
+func (tx memoryTx) GetByID(ctx context.Context, id string) (*Loan, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return tx.s.getByID(id)
+}
+
+func (tx memoryTx) GetByExternalID(ctx context.Context, externalID string) (*Loan, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return tx.s.getByExternalID(externalID)
+}
+
+func (tx memoryTx) Update(ctx context.Context, loan *Loan) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return tx.s.update(loan)
+}
+
+func (tx memoryTx) List(ctx context.Context, filter LoanFilter) ([]*Loan, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return tx.s.list(filter)
+}
+
+func (tx memoryTx) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return tx.s.delete(id)
+}
+
+func (tx memoryTx) Archive(ctx context.Context, before time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return tx.s.archive(before)
+}
+
+func (tx memoryTx) Restore(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return tx.s.restore(id)
+}
+
+func (tx memoryTx) PostJournalEntry(ctx context.Context, entry *JournalEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return tx.s.postJournalEntry(entry)
+}
+
+func (tx memoryTx) GetJournalEntry(ctx context.Context, id string) (*JournalEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return tx.s.getJournalEntry(id)
+}
+
+func (tx memoryTx) ListJournalEntries(ctx context.Context, from, to time.Time) ([]*JournalEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return tx.s.listJournalEntries(from, to)
+}
+
+func (tx memoryTx) SaveAccruals(ctx context.Context, accruals []InterestAccrual) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return tx.s.saveAccruals(accruals)
+}
+
+func (tx memoryTx) ListAccruals(ctx context.Context, loanID string) ([]InterestAccrual, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return tx.s.listAccruals(loanID)
+}
+
+// WithTx joins the unit of work tx belongs to
+func (tx memoryTx) WithTx(ctx context.Context, fn func(tx LoanRepository) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fn(tx)
+}
+
+// copyLoan returns a deep copy of loan that shares no slices or pointers with it
+func copyLoan(loan *Loan) *Loan {
+	c := *loan
+	c.WrittenOffAt = copyTime(loan.WrittenOffAt)
+	c.RefinancedAt = copyTime(loan.RefinancedAt)
+	c.DeletedAt = copyTime(loan.DeletedAt)
+
+	c.Schedule = nil
+	for _, week := range loan.Schedule {
+		week.PaidAt = copyTime(week.PaidAt)
+		c.Schedule = append(c.Schedule, week)
+	}
+	c.Recoveries = append([]Recovery(nil), loan.Recoveries...)
+	c.Restructures = append([]Restructure(nil), loan.Restructures...)
+	c.Deferrals = nil
+	for _, deferral := range loan.Deferrals {
+		deferral.Weeks = append([]int(nil), deferral.Weeks...)
+		deferral.Moved = append([]DeferredWeek(nil), deferral.Moved...)
+		c.Deferrals = append(c.Deferrals, deferral)
+	}
+	return &c
+}
+
+// copyTime returns a copy of t, or nil when t is nil
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestMemoryLoanRepository runs the repository conformance suite in memory
+func TestMemoryLoanRepository(t *testing.T) {
+	testLoanRepository(t, func(t *testing.T) LoanRepository {
+		return NewMemoryLoanRepository()
+	})
+}
+
+func TestMemoryLoanRepository_Copies(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryLoanRepository()
+
+	loan, err := NewLoan("copied-loan", 1_000_000, 0.1, time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	if err := repo.Create(ctx, loan); err != nil {
+		t.Fatalf("Failed to store loan: %v", err)
+	}
+
+	// Changing the created loan does not reach the stored one
+	loan.Schedule[0].Paid = true
+	loan.Outstanding = 0
+
+	first, err := repo.GetByID(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+	if first.Schedule[0].Paid || first.Outstanding == 0 {
+		t.Error("Expected stored loan to be unaffected by changes to the created loan")
+	}
+
+	// Nor does changing a loan that was read, down to nested pointers
+	paidAt := time.Date(2025, 9, 2, 0, 0, 0, 0, time.UTC)
+	first.Schedule[1].PaidAt = &paidAt
+	first.Deferrals = append(first.Deferrals, Deferral{Weeks: []int{3}})
+
+	second, err := repo.GetByID(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+	if second.Schedule[1].PaidAt != nil || len(second.Deferrals) != 0 {
+		t.Error("Expected stored loan to be unaffected by changes to a loan that was read")
+	}
+
+	// Updates are copied too
+	if err := second.MakePayment(second.WeeklyDue, paidAt); err != nil {
+		t.Fatalf("Failed to make payment: %v", err)
+	}
+	if err := repo.Update(ctx, second); err != nil {
+		t.Fatalf("Failed to update loan: %v", err)
+	}
+	*second.Schedule[0].PaidAt = time.Time{}
+
+	third, err := repo.GetByID(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+	if third.Schedule[0].PaidAt == nil || !third.Schedule[0].PaidAt.Equal(paidAt) {
+		t.Errorf("Expected stored paid_at %v, got %v", paidAt, third.Schedule[0].PaidAt)
+	}
+}
+
+// TestMemoryLoanRepository_WithTxRollback rolls back a unit of work that
+// created, paid, deleted and archived loans, and checks that only the loans it
+// touched were copied to restore them
+func TestMemoryLoanRepository_WithTxRollback(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryLoanRepository()
+
+	start := time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)
+	var loans []*Loan
+	for _, id := range []string{"paid-loan", "deleted-loan", "untouched-loan"} {
+		loan, err := NewLoan(id, 5_000_000, 0.1, start)
+		if err != nil {
+			t.Fatalf("Failed to create loan: %v", err)
+		}
+		if err := repo.Create(ctx, loan); err != nil {
+			t.Fatalf("Failed to store loan: %v", err)
+		}
+		loans = append(loans, loan)
+	}
+	untouched := repo.loans["untouched-loan"]
+
+	errAbort := errors.New("abort")
+	err := repo.WithTx(ctx, func(tx LoanRepository) error {
+		created, err := NewLoan("created-loan", 5_000_000, 0.1, start)
+		if err != nil {
+			return err
+		}
+		created.ExternalID = "partner-1"
+		if err := tx.Create(ctx, created); err != nil {
+			return err
+		}
+		paid, err := tx.GetByID(ctx, "paid-loan")
+		if err != nil {
+			return err
+		}
+		if err := paid.MakePayment(paid.WeeklyDue, start.AddDate(0, 0, 7)); err != nil {
+			return err
+		}
+		if err := tx.Update(ctx, paid); err != nil {
+			return err
+		}
+		if err := tx.PostJournalEntry(ctx, PaymentEntry(paid, 1, start.AddDate(0, 0, 7), DefaultChartOfAccounts())); err != nil {
+			return err
+		}
+		if err := tx.Delete(ctx, "deleted-loan"); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("Expected the unit's error, got %v", err)
+	}
+
+	if _, err := repo.GetByID(ctx, "created-loan"); err != ErrLoanNotFound {
+		t.Errorf("Expected the created loan to be rolled back, got %v", err)
+	}
+	if _, err := repo.GetByExternalID(ctx, "partner-1"); err != ErrLoanNotFound {
+		t.Errorf("Expected the external ID to be free again, got %v", err)
+	}
+	for _, loan := range loans[:2] {
+		stored, err := repo.GetByID(ctx, loan.ID)
+		if err != nil {
+			t.Fatalf("Expected %s to be restored: %v", loan.ID, err)
+		}
+		if stored.PaidCount != 0 || stored.Version != loan.Version {
+			t.Errorf("Expected %s unchanged, got %d payments at version %d", loan.ID, stored.PaidCount, stored.Version)
+		}
+	}
+	if entries, _ := repo.ListJournalEntries(ctx, start, start.AddDate(1, 0, 0)); len(entries) != 0 {
+		t.Errorf("Expected no journal entries after rollback, got %d", len(entries))
+	}
+	if repo.loans["untouched-loan"] != untouched {
+		t.Error("Expected the loan the unit never touched to be left in place")
+	}
+}
+
+func TestMemoryLoanRepository_ConcurrentPayments(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryLoanRepository()
+
+	loan, err := NewLoan("concurrent-loan", 5_000_000, 0.1, time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	if err := repo.Create(ctx, loan); err != nil {
+		t.Fatalf("Failed to store loan: %v", err)
+	}
+
+	// Every payer retries on a version conflict, so all payments land exactly once
+	const payers = 8
+	now := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	for i := 0; i < payers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				current, err := repo.GetByID(ctx, loan.ID)
+				if err != nil {
+					t.Errorf("Failed to get loan: %v", err)
+					return
+				}
+				if err := current.MakePayment(current.WeeklyDue, now); err != nil {
+					t.Errorf("Failed to make payment: %v", err)
+					return
+				}
+				if err := repo.Update(ctx, current); !errors.Is(err, ErrVersionConflict) {
+					if err != nil {
+						t.Errorf("Failed to update loan: %v", err)
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	retrieved, err := repo.GetByID(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+	if retrieved.PaidCount != payers || retrieved.Version != payers {
+		t.Errorf("Expected %d payments at version %d, got %d at version %d", payers, payers, retrieved.PaidCount, retrieved.Version)
+	}
+}
+
+func TestMemoryRepositoryAPI(t *testing.T) {
+	e := newServer()
+	registerRoutes(e, NewMemoryLoanRepository(), defaultServiceConfig())
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/loans", `{"id": "memory-loan", "principal": 5000000, "start_date": "2025-08-01"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/loans", `{"id": "memory-loan", "principal": 5000000, "start_date": "2025-08-01"}`); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a duplicate ID, got %d", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, "/loans/memory-loan/pay", `{"amount": 110000}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = do(http.MethodGet, "/loans/memory-loan", "")
+	var loan Loan
+	if err := json.Unmarshal(rec.Body.Bytes(), &loan); err != nil {
+		t.Fatalf("failed to unmarshal loan: %v", err)
+	}
+	if loan.PaidCount != 1 || loan.Outstanding != 5_390_000 {
+		t.Errorf("expected 1 payment and outstanding 5390000, got %d and %d", loan.PaidCount, loan.Outstanding)
+	}
+
+	if rec := do(http.MethodGet, "/loans/missing", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,730 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostgresLoanRepository implements LoanRepository using PostgreSQL, so that
+// several service instances can share one database
+type PostgresLoanRepository struct {
+	db    *sql.DB
+	tx    *sql.Tx // set inside a unit of work
+	clock Clock
+}
+
+// NewPostgresLoanRepository creates a new PostgreSQL repository
+func NewPostgresLoanRepository(db *sql.DB) *PostgresLoanRepository {
+	return &PostgresLoanRepository{db: db, clock: SystemClock}
+}
+
+// WithClock sets the clock used to stamp when loans are created and updated
+func (r *PostgresLoanRepository) WithClock(clock Clock) *PostgresLoanRepository {
+	r.clock = clock
+	return r
+}
+
+// conn returns the transaction of the unit of work, or the database outside one
+func (r *PostgresLoanRepository) conn() sqlConn {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// WithTx runs fn as one unit of work in a single transaction. Loans read
+// through tx are locked with SELECT ... FOR UPDATE until the unit ends.
+func (r *PostgresLoanRepository) WithTx(ctx context.Context, fn func(tx LoanRepository) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&PostgresLoanRepository{db: r.db, tx: tx, clock: r.clock}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Create inserts a new loan into the database. It returns ErrLoanExists when
+// the loan's ID is already taken and ErrExternalIDExists when its external ID is.
+func (r *PostgresLoanRepository) Create(ctx context.Context, loan *Loan) error {
+	now := r.clock.Now()
+
+	tx, err := beginTx(ctx, r.db, r.tx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkArchived(ctx, tx, loan, postgresDialect); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO loans (id, external_id, principal, apr, start_date, timezone, weekly_due, paid_count, outstanding, version,
+			status, written_off_at, written_off_amount, refinanced_from, refinanced_by, refinanced_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
+		loan.ID, sql.NullString{String: loan.ExternalID, Valid: loan.ExternalID != ""}, loan.Principal, loan.APR, loan.StartDate, loan.Timezone, loan.WeeklyDue, loan.PaidCount, loan.Outstanding, loan.Version,
+		string(loan.Status), loan.WrittenOffAt, loan.WrittenOffAmount, loan.RefinancedFrom, loan.RefinancedBy, loan.RefinancedAt, now, now)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+			if pqErr.Constraint == "idx_loans_external_id" {
+				return ErrExternalIDExists
+			}
+			return ErrLoanExists
+		}
+		return fmt.Errorf("failed to insert loan: %w", err)
+	}
+
+	if err := insertSchedule(ctx, tx, loan, now, postgresDialect); err != nil {
+		return err
+	}
+
+	if err := insertPostgresRecoveries(ctx, tx, loan); err != nil {
+		return err
+	}
+	if err := insertPostgresRestructures(ctx, tx, loan); err != nil {
+		return err
+	}
+	if err := insertPostgresDeferrals(ctx, tx, loan); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	loan.CreatedAt = now
+	loan.markUpdated(now)
+	loan.markPersisted()
+	return nil
+}
+
+// GetByID retrieves a loan by ID
+func (r *PostgresLoanRepository) GetByID(ctx context.Context, id string) (*Loan, error) {
+	query := `
+		SELECT id, external_id, principal, apr, start_date, timezone, weekly_due, paid_count, outstanding, version,
+			status, written_off_at, written_off_amount, refinanced_from, refinanced_by, refinanced_at, created_at, updated_at
+		FROM loans WHERE id = $1 AND deleted_at IS NULL`
+	if r.tx != nil {
+		query += " FOR UPDATE" // held until the unit of work ends
+	}
+
+	var loan Loan
+	var externalID sql.NullString
+	var status string
+	err := r.conn().QueryRowContext(ctx, query, id).Scan(
+		&loan.ID, &externalID, &loan.Principal, &loan.APR, &loan.StartDate, &loan.Timezone, &loan.WeeklyDue, &loan.PaidCount, &loan.Outstanding, &loan.Version,
+		&status, &loan.WrittenOffAt, &loan.WrittenOffAmount, &loan.RefinancedFrom, &loan.RefinancedBy, &loan.RefinancedAt, &loan.CreatedAt, &loan.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrLoanNotFound
+		}
+		return nil, fmt.Errorf("failed to get loan: %w", err)
+	}
+
+	loan.ExternalID = externalID.String
+	loan.Status = LoanStatus(status)
+	loc, err := time.LoadLocation(loan.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load time zone %q: %w", loan.Timezone, err)
+	}
+	loan.StartDate = loan.StartDate.In(loc)
+
+	rows, err := r.conn().QueryContext(ctx, `
+		SELECT week_index, amount, scheduled_date, due_date, paid, paid_at, deferred, updated_at
+		FROM loan_schedule WHERE loan_id = $1 ORDER BY week_index`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedule: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var week Week
+		if err := rows.Scan(&week.Index, &week.Amount, &week.ScheduledDate, &week.DueDate, &week.Paid, &week.PaidAt, &week.Deferred, &week.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schedule row: %w", err)
+		}
+		week.ScheduledDate = week.ScheduledDate.In(loc)
+		week.DueDate = week.DueDate.In(loc)
+		loan.Schedule = append(loan.Schedule, week)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get schedule: %w", err)
+	}
+
+	recoveryRows, err := r.conn().QueryContext(ctx, `
+		SELECT id, amount, received_at
+		FROM loan_recoveries WHERE loan_id = $1 ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recoveries: %w", err)
+	}
+	defer recoveryRows.Close()
+
+	for recoveryRows.Next() {
+		var recovery Recovery
+		if err := recoveryRows.Scan(&recovery.ID, &recovery.Amount, &recovery.ReceivedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan recovery row: %w", err)
+		}
+		loan.Recoveries = append(loan.Recoveries, recovery)
+	}
+	if err := recoveryRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get recoveries: %w", err)
+	}
+
+	restructureRows, err := r.conn().QueryContext(ctx, `
+		SELECT id, reason, restructured_at, before_terms, after_terms
+		FROM loan_restructures WHERE loan_id = $1 ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get restructures: %w", err)
+	}
+	defer restructureRows.Close()
+
+	for restructureRows.Next() {
+		var restructure Restructure
+		var before, after []byte
+		if err := restructureRows.Scan(&restructure.ID, &restructure.Reason, &restructure.RestructuredAt, &before, &after); err != nil {
+			return nil, fmt.Errorf("failed to scan restructure row: %w", err)
+		}
+		if err := json.Unmarshal(before, &restructure.Before); err != nil {
+			return nil, fmt.Errorf("failed to parse restructure terms: %w", err)
+		}
+		if err := json.Unmarshal(after, &restructure.After); err != nil {
+			return nil, fmt.Errorf("failed to parse restructure terms: %w", err)
+		}
+		loan.Restructures = append(loan.Restructures, restructure)
+	}
+	if err := restructureRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get restructures: %w", err)
+	}
+
+	deferralRows, err := r.conn().QueryContext(ctx, `
+		SELECT id, weeks, moved, reason, deferred_at
+		FROM loan_deferrals WHERE loan_id = $1 ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deferrals: %w", err)
+	}
+	defer deferralRows.Close()
+
+	for deferralRows.Next() {
+		var deferral Deferral
+		var weeks, moved []byte
+		if err := deferralRows.Scan(&deferral.ID, &weeks, &moved, &deferral.Reason, &deferral.DeferredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan deferral row: %w", err)
+		}
+		if err := json.Unmarshal(weeks, &deferral.Weeks); err != nil {
+			return nil, fmt.Errorf("failed to parse deferred weeks: %w", err)
+		}
+		// Deferrals stored before moved weeks were recorded have none
+		if moved != nil {
+			if err := json.Unmarshal(moved, &deferral.Moved); err != nil {
+				return nil, fmt.Errorf("failed to parse moved weeks: %w", err)
+			}
+		}
+		loan.Deferrals = append(loan.Deferrals, deferral)
+	}
+	if err := deferralRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get deferrals: %w", err)
+	}
+
+	loan.markPersisted()
+	return &loan, nil
+}
+
+// GetByExternalID retrieves a loan by the partner's reference
+func (r *PostgresLoanRepository) GetByExternalID(ctx context.Context, externalID string) (*Loan, error) {
+	var id string
+	err := r.conn().QueryRowContext(ctx, "SELECT id FROM loans WHERE external_id = $1 AND deleted_at IS NULL", externalID).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrLoanNotFound
+		}
+		return nil, fmt.Errorf("failed to get loan by external id: %w", err)
+	}
+	return r.GetByID(ctx, id)
+}
+
+// Update updates an existing loan in the database.
+//
+// The loan row is locked with SELECT ... FOR UPDATE before anything is
+// written, so concurrent payments on the same loan queue up behind each other
+// instead of interleaving their schedule writes. The write only succeeds when
+// the stored version still matches loan.Version; otherwise ErrVersionConflict
+// is returned and the caller should re-read and retry. On success loan.Version
+// is advanced to the newly stored version.
+func (r *PostgresLoanRepository) Update(ctx context.Context, loan *Loan) error {
+	now := r.clock.Now()
+
+	tx, err := beginTx(ctx, r.db, r.tx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var version int64
+	err = tx.QueryRowContext(ctx, "SELECT version FROM loans WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", loan.ID).Scan(&version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrLoanNotFound
+		}
+		return fmt.Errorf("failed to lock loan: %w", err)
+	}
+	if version != loan.Version {
+		return ErrVersionConflict
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE loans SET weekly_due = $1, paid_count = $2, outstanding = $3, status = $4, written_off_at = $5, written_off_amount = $6,
+			refinanced_by = $7, refinanced_at = $8, updated_at = $9, version = version + 1
+		WHERE id = $10`,
+		loan.WeeklyDue, loan.PaidCount, loan.Outstanding, string(loan.Status), loan.WrittenOffAt, loan.WrittenOffAmount,
+		loan.RefinancedBy, loan.RefinancedAt, now, loan.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update loan: %w", err)
+	}
+
+	// Write only the weeks that changed since the loan was read; restructuring
+	// and deferrals may change amounts and due dates, reorder weeks and
+	// shorten or lengthen the schedule
+	changed, trimmed := loan.scheduleChanges()
+	for _, week := range changed {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO loan_schedule (loan_id, week_index, amount, scheduled_date, due_date, paid, paid_at, deferred, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (loan_id, week_index) DO UPDATE SET
+				amount = excluded.amount, scheduled_date = excluded.scheduled_date, due_date = excluded.due_date,
+				paid = excluded.paid, paid_at = excluded.paid_at, deferred = excluded.deferred, updated_at = excluded.updated_at`,
+			loan.ID, week.Index, week.Amount, week.ScheduledDate, week.DueDate, week.Paid, week.PaidAt, week.Deferred, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to update schedule for week %d: %w", week.Index, err)
+		}
+	}
+	if trimmed {
+		_, err = tx.ExecContext(ctx, "DELETE FROM loan_schedule WHERE loan_id = $1 AND week_index > $2", loan.ID, len(loan.Schedule))
+		if err != nil {
+			return fmt.Errorf("failed to trim schedule: %w", err)
+		}
+	}
+
+	if err := insertPostgresRecoveries(ctx, tx, loan); err != nil {
+		return err
+	}
+	if err := insertPostgresRestructures(ctx, tx, loan); err != nil {
+		return err
+	}
+	if err := insertPostgresDeferrals(ctx, tx, loan); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	loan.Version++
+	loan.markUpdated(now)
+	loan.markPersisted()
+	return nil
+}
+
+// postgresDialect binds numbered "$n" markers and passes timestamps to the
+// driver, as TIMESTAMPTZ columns store them exactly
+var postgresDialect = sqlDialect{
+	placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	timestamp:   func(t time.Time) any { return t },
+}
+
+// insertPostgresRecoveries stores the recoveries of the loan that have not been persisted yet
+func insertPostgresRecoveries(ctx context.Context, tx sqlConn, loan *Loan) error {
+	for i := range loan.Recoveries {
+		recovery := &loan.Recoveries[i]
+		if recovery.ID != 0 {
+			continue
+		}
+
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO loan_recoveries (loan_id, amount, received_at)
+			VALUES ($1, $2, $3) RETURNING id`,
+			loan.ID, recovery.Amount, recovery.ReceivedAt).Scan(&recovery.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert recovery: %w", err)
+		}
+	}
+	return nil
+}
+
+// insertPostgresRestructures stores the restructures of the loan that have not been persisted yet
+func insertPostgresRestructures(ctx context.Context, tx sqlConn, loan *Loan) error {
+	for i := range loan.Restructures {
+		restructure := &loan.Restructures[i]
+		if restructure.ID != 0 {
+			continue
+		}
+
+		before, err := json.Marshal(restructure.Before)
+		if err != nil {
+			return fmt.Errorf("failed to encode restructure terms: %w", err)
+		}
+		after, err := json.Marshal(restructure.After)
+		if err != nil {
+			return fmt.Errorf("failed to encode restructure terms: %w", err)
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO loan_restructures (loan_id, reason, restructured_at, before_terms, after_terms)
+			VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+			loan.ID, restructure.Reason, restructure.RestructuredAt, string(before), string(after)).Scan(&restructure.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert restructure: %w", err)
+		}
+	}
+	return nil
+}
+
+// insertPostgresDeferrals stores the deferrals of the loan that have not been persisted yet
+func insertPostgresDeferrals(ctx context.Context, tx sqlConn, loan *Loan) error {
+	for i := range loan.Deferrals {
+		deferral := &loan.Deferrals[i]
+		if deferral.ID != 0 {
+			continue
+		}
+
+		weeks, err := json.Marshal(deferral.Weeks)
+		if err != nil {
+			return fmt.Errorf("failed to encode deferred weeks: %w", err)
+		}
+		moved, err := json.Marshal(deferral.Moved)
+		if err != nil {
+			return fmt.Errorf("failed to encode moved weeks: %w", err)
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO loan_deferrals (loan_id, weeks, moved, reason, deferred_at)
+			VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+			loan.ID, string(weeks), string(moved), deferral.Reason, deferral.DeferredAt).Scan(&deferral.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert deferral: %w", err)
+		}
+	}
+	return nil
+}
+
+// List returns the loans matching filter (for admin purposes)
+func (r *PostgresLoanRepository) List(ctx context.Context, filter LoanFilter) ([]*Loan, error) {
+	var conditions []string
+	var args []any
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if !filter.UpdatedSince.IsZero() {
+		args = append(args, filter.UpdatedSince)
+		conditions = append(conditions, "updated_at >= "+postgresDialect.placeholder(len(args)))
+	}
+	var where string
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := r.conn().QueryContext(ctx, `
+		SELECT id, external_id, principal, apr, start_date, timezone, weekly_due, paid_count, outstanding, version,
+			status, written_off_at, written_off_amount, refinanced_from, refinanced_by, refinanced_at, created_at, updated_at, deleted_at
+		FROM loans `+where+` ORDER BY start_date DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list loans: %w", err)
+	}
+	defer rows.Close()
+
+	var loans []*Loan
+	for rows.Next() {
+		var loan Loan
+		var externalID sql.NullString
+		var status string
+		err := rows.Scan(&loan.ID, &externalID, &loan.Principal, &loan.APR, &loan.StartDate, &loan.Timezone, &loan.WeeklyDue, &loan.PaidCount, &loan.Outstanding, &loan.Version,
+			&status, &loan.WrittenOffAt, &loan.WrittenOffAmount, &loan.RefinancedFrom, &loan.RefinancedBy, &loan.RefinancedAt, &loan.CreatedAt, &loan.UpdatedAt, &loan.DeletedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan loan row: %w", err)
+		}
+		loan.ExternalID = externalID.String
+		loan.Status = LoanStatus(status)
+
+		loc, err := time.LoadLocation(loan.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load time zone %q: %w", loan.Timezone, err)
+		}
+		loan.StartDate = loan.StartDate.In(loc)
+
+		loans = append(loans, &loan)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list loans: %w", err)
+	}
+
+	return loans, nil
+}
+
+// Delete soft-deletes a loan: its rows are kept and stamped with deleted_at,
+// and reads skip the loan until it is restored
+func (r *PostgresLoanRepository) Delete(ctx context.Context, id string) error {
+	result, err := r.conn().ExecContext(ctx, `
+		UPDATE loans SET deleted_at = $1, updated_at = $1, version = version + 1
+		WHERE id = $2 AND deleted_at IS NULL`, r.clock.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete loan: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrLoanNotFound
+	}
+	return nil
+}
+
+// Archive moves the paid-off loans last written before before, with their
+// schedules and histories, into the archive tables and returns their IDs.
+// Journal entries and accruals stay where they are.
+func (r *PostgresLoanRepository) Archive(ctx context.Context, before time.Time) ([]string, error) {
+	now := r.clock.Now()
+
+	tx, err := beginTx(ctx, r.db, r.tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM loans WHERE status = $1 AND updated_at < $2 ORDER BY id FOR UPDATE",
+		string(LoanStatusPaidOff), before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find loans to archive: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan loan id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find loans to archive: %w", err)
+	}
+
+	for _, id := range ids {
+		if err := archiveLoan(ctx, tx, id, now, postgresDialect); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return ids, nil
+}
+
+// Restore brings back a deleted or archived loan. It returns ErrLoanNotFound
+// when there is no such loan and ErrLoanNotDeleted when it is neither.
+func (r *PostgresLoanRepository) Restore(ctx context.Context, id string) error {
+	now := r.clock.Now()
+
+	tx, err := beginTx(ctx, r.db, r.tx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var archived int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM loans_archive WHERE id = $1", id).Scan(&archived); err != nil {
+		return fmt.Errorf("failed to check archived loans: %w", err)
+	}
+	if archived > 0 {
+		if err := unarchiveLoan(ctx, tx, id, postgresDialect); err != nil {
+			return err
+		}
+	} else {
+		var deleted bool
+		err := tx.QueryRowContext(ctx, "SELECT deleted_at IS NOT NULL FROM loans WHERE id = $1 FOR UPDATE", id).Scan(&deleted)
+		if err == sql.ErrNoRows {
+			return ErrLoanNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get loan: %w", err)
+		}
+		if !deleted {
+			return ErrLoanNotDeleted
+		}
+	}
+
+	// A restored loan counts as written now, so it is not archived again at once
+	_, err = tx.ExecContext(ctx, "UPDATE loans SET deleted_at = NULL, updated_at = $1, version = version + 1 WHERE id = $2", now, id)
+	if err != nil {
+		return fmt.Errorf("failed to restore loan: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// PostJournalEntry stores a balanced journal entry, one row per line
+func (r *PostgresLoanRepository) PostJournalEntry(ctx context.Context, entry *JournalEntry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	tx, err := beginTx(ctx, r.db, r.tx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i, line := range entry.Lines {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO journal_entries (entry_id, line_no, loan_id, event, account, debit, credit, posted_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			entry.ID, i+1, entry.LoanID, string(entry.Event), line.Account, line.Debit, line.Credit, entry.PostedAt.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to insert journal line %d of %s: %w", i+1, entry.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetJournalEntry returns the journal entry with the given ID
+func (r *PostgresLoanRepository) GetJournalEntry(ctx context.Context, id string) (*JournalEntry, error) {
+	rows, err := r.conn().QueryContext(ctx, `
+		SELECT entry_id, loan_id, event, account, debit, credit, posted_at
+		FROM journal_entries
+		WHERE entry_id = $1
+		ORDER BY line_no`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get journal entry: %w", err)
+	}
+	defer rows.Close()
+
+	entries, err := scanPostgresJournal(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get journal entry: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, ErrJournalEntryNotFound
+	}
+	return entries[0], nil
+}
+
+// ListJournalEntries returns the journal entries posted in [from, to), oldest first
+func (r *PostgresLoanRepository) ListJournalEntries(ctx context.Context, from, to time.Time) ([]*JournalEntry, error) {
+	rows, err := r.conn().QueryContext(ctx, `
+		SELECT entry_id, loan_id, event, account, debit, credit, posted_at
+		FROM journal_entries
+		WHERE posted_at >= $1 AND posted_at < $2
+		ORDER BY posted_at, entry_id, line_no`, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list journal entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries, err := scanPostgresJournal(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list journal entries: %w", err)
+	}
+	return entries, nil
+}
+
+// scanPostgresJournal groups journal rows, ordered by entry, into entries
+func scanPostgresJournal(rows *sql.Rows) ([]*JournalEntry, error) {
+	var entries []*JournalEntry
+	byID := make(map[string]*JournalEntry)
+	for rows.Next() {
+		var (
+			entryID, loanID, event string
+			line                   JournalLine
+			postedAt               time.Time
+		)
+		if err := rows.Scan(&entryID, &loanID, &event, &line.Account, &line.Debit, &line.Credit, &postedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan journal row: %w", err)
+		}
+
+		entry, ok := byID[entryID]
+		if !ok {
+			entry = &JournalEntry{
+				ID:       entryID,
+				LoanID:   loanID,
+				Event:    JournalEvent(event),
+				PostedAt: postedAt.UTC(),
+			}
+			byID[entryID] = entry
+			entries = append(entries, entry)
+		}
+		entry.Lines = append(entry.Lines, line)
+	}
+	return entries, rows.Err()
+}
+
+// SaveAccruals stores daily interest accrual records
+func (r *PostgresLoanRepository) SaveAccruals(ctx context.Context, accruals []InterestAccrual) error {
+	tx, err := beginTx(ctx, r.db, r.tx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, accrual := range accruals {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO interest_accruals (loan_id, accrual_date, amount, method)
+			VALUES ($1, $2, $3, $4)`,
+			accrual.LoanID, accrual.Date.UTC(), accrual.Amount, string(accrual.Method))
+		if err != nil {
+			return fmt.Errorf("failed to insert accrual for %s on %s: %w", accrual.LoanID, accrual.Date.Format("2006-01-02"), err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListAccruals returns the accrual records of a loan, oldest first
+func (r *PostgresLoanRepository) ListAccruals(ctx context.Context, loanID string) ([]InterestAccrual, error) {
+	rows, err := r.conn().QueryContext(ctx, `
+		SELECT loan_id, accrual_date, amount, method
+		FROM interest_accruals WHERE loan_id = $1 ORDER BY accrual_date`, loanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accruals: %w", err)
+	}
+	defer rows.Close()
+
+	var accruals []InterestAccrual
+	for rows.Next() {
+		var accrual InterestAccrual
+		var method string
+		if err := rows.Scan(&accrual.LoanID, &accrual.Date, &accrual.Amount, &method); err != nil {
+			return nil, fmt.Errorf("failed to scan accrual row: %w", err)
+		}
+		accrual.Date = accrual.Date.UTC()
+		accrual.Method = AccrualMethod(method)
+		accruals = append(accruals, accrual)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list accruals: %w", err)
+	}
+
+	return accruals, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// setupPostgresTestDB connects to the database at PINJOL_TEST_POSTGRES_URL,
+// skipping the test when it is unset, and rebuilds the schema from scratch.
+// The database is wiped, so never point it at one holding real data.
+func setupPostgresTestDB(t *testing.T) *sql.DB {
+	url := os.Getenv("PINJOL_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("PINJOL_TEST_POSTGRES_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := MigrateDown(db, len(postgresMigrations)); err != nil {
+		t.Fatalf("Failed to reset database: %v", err)
+	}
+	if err := InitDatabase(db); err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	return db
+}
+
+// TestPostgresLoanRepository runs the repository conformance suite against PostgreSQL
+func TestPostgresLoanRepository(t *testing.T) {
+	db := setupPostgresTestDB(t)
+
+	testLoanRepository(t, func(t *testing.T) LoanRepository {
+		_, err := db.Exec(`TRUNCATE loans, loan_schedule, loan_recoveries, loan_restructures, loan_deferrals,
+			journal_entries, interest_accruals, loans_archive, loan_schedule_archive, loan_recoveries_archive,
+			loan_restructures_archive, loan_deferrals_archive RESTART IDENTITY`)
+		if err != nil {
+			t.Fatalf("Failed to empty database: %v", err)
+		}
+		return NewPostgresLoanRepository(db)
+	})
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	db := setupPostgresTestDB(t)
+
+	if version, _ := SchemaVersion(db); version != LatestSchemaVersion(db) {
+		t.Errorf("Expected schema version %d, got %d", LatestSchemaVersion(db), version)
+	}
+
+	if _, err := MigrateDown(db, len(postgresMigrations)); err != nil {
+		t.Fatalf("MigrateDown failed: %v", err)
+	}
+	var tables int
+	err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name <> 'schema_migrations'`).Scan(&tables)
+	if err != nil {
+		t.Fatalf("Failed to count tables: %v", err)
+	}
+	if tables != 0 {
+		t.Errorf("Expected no tables left, got %d", tables)
+	}
+
+	if _, err := MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp after rollback failed: %v", err)
+	}
+}
+
+func TestPostgresLoanRepository_ConcurrentPayments(t *testing.T) {
+	ctx := context.Background()
+	db := setupPostgresTestDB(t)
+	repo := NewPostgresLoanRepository(db)
+
+	loan, err := NewLoan("concurrent-loan", 5_000_000, 0.1, time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	if err := repo.Create(ctx, loan); err != nil {
+		t.Fatalf("Failed to store loan: %v", err)
+	}
+
+	// Every payer retries on a version conflict, so all payments land exactly once
+	const payers = 8
+	now := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	errs := make(chan error, payers)
+	for i := 0; i < payers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				current, err := repo.GetByID(ctx, loan.ID)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if err := current.MakePayment(current.WeeklyDue, now); err != nil {
+					errs <- err
+					return
+				}
+				err = repo.Update(ctx, current)
+				if errors.Is(err, ErrVersionConflict) {
+					continue
+				}
+				if err != nil {
+					errs <- err
+				}
+				return
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Payment failed: %v", err)
+	}
+
+	retrieved, err := repo.GetByID(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+	if retrieved.PaidCount != payers || retrieved.Version != payers {
+		t.Errorf("Expected %d payments at version %d, got %d at version %d", payers, payers, retrieved.PaidCount, retrieved.Version)
+	}
+	for i, week := range retrieved.Schedule {
+		if week.Paid != (i < payers) {
+			t.Errorf("Week %d: expected paid=%v", i+1, i < payers)
+		}
+	}
+}
@@ -1,16 +1,31 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// requireSQLite skips tb in builds without cgo, where the SQLite driver is a
+// stub; such builds test the memory backend instead
+func requireSQLite(tb testing.TB) {
+	tb.Helper()
+	if !sqliteSupported {
+		tb.Skip("SQLite needs cgo")
+	}
+}
+
 func setupTestDB(t *testing.T) *sql.DB {
-	db, err := sql.Open("sqlite3", ":memory:")
+	requireSQLite(t)
+	db, err := openSQLite(":memory:")
 	if err != nil {
 		t.Fatalf("Failed to open database: %v", err)
 	}
@@ -22,25 +37,201 @@ func setupTestDB(t *testing.T) *sql.DB {
 	return db
 }
 
-func TestSQLiteLoanRepository_Create(t *testing.T) {
-	db := setupTestDB(t)
+// TestSQLiteLoanRepository runs the repository conformance suite against SQLite
+func TestSQLiteLoanRepository(t *testing.T) {
+	testLoanRepository(t, func(t *testing.T) LoanRepository {
+		db := setupTestDB(t)
+		t.Cleanup(func() { db.Close() })
+		return NewSQLiteLoanRepository(db)
+	})
+}
+
+// TestSQLiteLoanRepository_WithTxConcurrent pays one loan from several
+// connections at once; each unit of work locks the loan, so none of them
+// sees a stale version
+func TestSQLiteLoanRepository_WithTxConcurrent(t *testing.T) {
+	ctx := context.Background()
+	requireSQLite(t)
+	db, err := openSQLite(filepath.Join(t.TempDir(), "pinjol.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
 	defer db.Close()
+	if err := InitDatabase(db); err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	repo := NewSQLiteLoanRepository(db)
 
+	loan, err := NewLoan("unit-loan", 5_000_000, 0.1, time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	if err := repo.Create(ctx, loan); err != nil {
+		t.Fatalf("Failed to store loan: %v", err)
+	}
+
+	const payers = 8
+	now := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	for i := 0; i < payers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := repo.WithTx(ctx, func(tx LoanRepository) error {
+				current, err := tx.GetByID(ctx, loan.ID)
+				if err != nil {
+					return err
+				}
+				if err := current.MakePayment(current.WeeklyDue, now); err != nil {
+					return err
+				}
+				return tx.Update(ctx, current)
+			})
+			if err != nil {
+				t.Errorf("Payment failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	retrieved, err := repo.GetByID(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+	if retrieved.PaidCount != payers || retrieved.Version != payers {
+		t.Errorf("Expected %d payments at version %d, got %d at version %d", payers, payers, retrieved.PaidCount, retrieved.Version)
+	}
+}
+
+// TestSQLiteLoanRepository_Retention checks where the rows of a deleted and an
+// archived loan end up
+func TestSQLiteLoanRepository_Retention(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	defer db.Close()
 	repo := NewSQLiteLoanRepository(db)
 
+	count := func(query, id string) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow(query, id).Scan(&n); err != nil {
+			t.Fatalf("Failed to count rows: %v", err)
+		}
+		return n
+	}
+
+	for _, id := range []string{"deleted-loan", "archived-loan"} {
+		loan, err := NewLoan(id, 1_000_000, 0.1, time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatalf("Failed to create loan: %v", err)
+		}
+		if err := repo.Create(ctx, loan); err != nil {
+			t.Fatalf("Failed to store loan: %v", err)
+		}
+		if id == "archived-loan" {
+			for loan.Status != LoanStatusPaidOff {
+				if err := loan.MakePayment(loan.Schedule[loan.PaidCount].Amount, loan.StartDate); err != nil {
+					t.Fatalf("Failed to make payment: %v", err)
+				}
+			}
+			if err := repo.Update(ctx, loan); err != nil {
+				t.Fatalf("Failed to update loan: %v", err)
+			}
+		}
+	}
+
+	// Deleting keeps every row
+	if err := repo.Delete(ctx, "deleted-loan"); err != nil {
+		t.Fatalf("Failed to delete loan: %v", err)
+	}
+	if n := count("SELECT COUNT(*) FROM loans WHERE id = ? AND deleted_at IS NOT NULL", "deleted-loan"); n != 1 {
+		t.Errorf("Expected the deleted loan row kept and stamped, got %d rows", n)
+	}
+	if n := count("SELECT COUNT(*) FROM loan_schedule WHERE loan_id = ?", "deleted-loan"); n != 50 {
+		t.Errorf("Expected 50 schedule rows kept, got %d", n)
+	}
+
+	// Archiving moves them
+	if _, err := repo.Archive(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to archive loans: %v", err)
+	}
+	if n := count("SELECT COUNT(*) FROM loan_schedule WHERE loan_id = ?", "archived-loan"); n != 0 {
+		t.Errorf("Expected no live schedule rows, got %d", n)
+	}
+	if n := count("SELECT COUNT(*) FROM loan_schedule_archive WHERE loan_id = ?", "archived-loan"); n != 50 {
+		t.Errorf("Expected 50 archived schedule rows, got %d", n)
+	}
+	if n := count("SELECT COUNT(*) FROM loans_archive WHERE id = ? AND archived_at IS NOT NULL", "archived-loan"); n != 1 {
+		t.Errorf("Expected the archived loan row stamped, got %d rows", n)
+	}
+}
+
+// failingJournalRepository is a repository that cannot post journal entries,
+// inside units of work as well as outside them
+type failingJournalRepository struct {
+	LoanRepository
+}
+
+var errJournalUnavailable = errors.New("journal unavailable")
+
+func (r failingJournalRepository) PostJournalEntry(ctx context.Context, entry *JournalEntry) error {
+	return errJournalUnavailable
+}
+
+func (r failingJournalRepository) WithTx(ctx context.Context, fn func(tx LoanRepository) error) error {
+	return r.LoanRepository.WithTx(ctx, func(tx LoanRepository) error {
+		return fn(failingJournalRepository{tx})
+	})
+}
+
+// testLoanRepository checks that a LoanRepository implementation behaves like
+// every other one. newRepo must return an empty repository on each call.
+func testLoanRepository(t *testing.T, newRepo func(t *testing.T) LoanRepository) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo LoanRepository)
+	}{
+		{"Create", testRepositoryCreate},
+		{"GetByID", testRepositoryGetByID},
+		{"Update", testRepositoryUpdate},
+		{"UpdateVersionConflict", testRepositoryUpdateVersionConflict},
+		{"List", testRepositoryList},
+		{"Delete", testRepositoryDelete},
+		{"Journal", testRepositoryJournal},
+		{"Restructure", testRepositoryRestructure},
+		{"ExternalID", testRepositoryExternalID},
+		{"Lifecycle", testRepositoryLifecycle},
+		{"Accruals", testRepositoryAccruals},
+		{"Cancelled", testRepositoryCancelled},
+		{"WithTx", testRepositoryWithTx},
+		{"Timestamps", testRepositoryTimestamps},
+		{"UpdatedAt", testRepositoryUpdatedAt},
+		{"SoftDelete", testRepositorySoftDelete},
+		{"Archive", testRepositoryArchive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newRepo(t))
+		})
+	}
+}
+
+func testRepositoryCreate(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
 	startDate := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
 	loan, err := NewLoan("test-loan-1", 1000000, 0.1, startDate)
 	if err != nil {
 		t.Fatalf("Failed to create loan: %v", err)
 	}
 
-	err = repo.Create(loan)
+	err = repo.Create(ctx, loan)
 	if err != nil {
 		t.Fatalf("Failed to create loan in repository: %v", err)
 	}
 
 	// Verify loan was created
-	retrieved, err := repo.GetByID("test-loan-1")
+	retrieved, err := repo.GetByID(ctx, "test-loan-1")
 	if err != nil {
 		t.Fatalf("Failed to retrieve created loan: %v", err)
 	}
@@ -53,25 +244,21 @@ func TestSQLiteLoanRepository_Create(t *testing.T) {
 	}
 }
 
-func TestSQLiteLoanRepository_GetByID(t *testing.T) {
-	db := setupTestDB(t)
-	defer db.Close()
-
-	repo := NewSQLiteLoanRepository(db)
-
+func testRepositoryGetByID(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
 	startDate := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
 	loan, err := NewLoan("test-loan-2", 2000000, 0.15, startDate)
 	if err != nil {
 		t.Fatalf("Failed to create loan: %v", err)
 	}
 
-	err = repo.Create(loan)
+	err = repo.Create(ctx, loan)
 	if err != nil {
 		t.Fatalf("Failed to create loan: %v", err)
 	}
 
 	// Test successful retrieval
-	retrieved, err := repo.GetByID("test-loan-2")
+	retrieved, err := repo.GetByID(ctx, "test-loan-2")
 	if err != nil {
 		t.Fatalf("Failed to get loan: %v", err)
 	}
@@ -81,25 +268,21 @@ func TestSQLiteLoanRepository_GetByID(t *testing.T) {
 	}
 
 	// Test non-existent loan
-	_, err = repo.GetByID("non-existent")
+	_, err = repo.GetByID(ctx, "non-existent")
 	if err != ErrLoanNotFound {
 		t.Errorf("Expected ErrLoanNotFound, got %v", err)
 	}
 }
 
-func TestSQLiteLoanRepository_Update(t *testing.T) {
-	db := setupTestDB(t)
-	defer db.Close()
-
-	repo := NewSQLiteLoanRepository(db)
-
+func testRepositoryUpdate(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
 	startDate := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
 	loan, err := NewLoan("test-loan-3", 1500000, 0.12, startDate)
 	if err != nil {
 		t.Fatalf("Failed to create loan: %v", err)
 	}
 
-	err = repo.Create(loan)
+	err = repo.Create(ctx, loan)
 	if err != nil {
 		t.Fatalf("Failed to create loan: %v", err)
 	}
@@ -112,13 +295,13 @@ func TestSQLiteLoanRepository_Update(t *testing.T) {
 	}
 
 	// Update the loan
-	err = repo.Update(loan)
+	err = repo.Update(ctx, loan)
 	if err != nil {
 		t.Fatalf("Failed to update loan: %v", err)
 	}
 
 	// Verify update
-	retrieved, err := repo.GetByID("test-loan-3")
+	retrieved, err := repo.GetByID(ctx, "test-loan-3")
 	if err != nil {
 		t.Fatalf("Failed to retrieve updated loan: %v", err)
 	}
@@ -131,12 +314,69 @@ func TestSQLiteLoanRepository_Update(t *testing.T) {
 	}
 }
 
-func TestSQLiteLoanRepository_List(t *testing.T) {
-	db := setupTestDB(t)
-	defer db.Close()
+func testRepositoryUpdateVersionConflict(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
+	startDate := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	loan, err := NewLoan("test-loan-cas", 1000000, 0.1, startDate)
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	if err := repo.Create(ctx, loan); err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
 
-	repo := NewSQLiteLoanRepository(db)
+	// Two readers get the same version of the loan
+	first, err := repo.GetByID(ctx, "test-loan-cas")
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+	second, err := repo.GetByID(ctx, "test-loan-cas")
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+
+	now := time.Now()
+	if err := first.MakePayment(first.WeeklyDue, now); err != nil {
+		t.Fatalf("Failed to make payment: %v", err)
+	}
+	if err := repo.Update(ctx, first); err != nil {
+		t.Fatalf("First update failed: %v", err)
+	}
+	if first.Version != 1 {
+		t.Errorf("Expected version 1 after update, got %d", first.Version)
+	}
+
+	// The stale copy must not overwrite the first payment
+	if err := second.MakePayment(second.WeeklyDue, now); err != nil {
+		t.Fatalf("Failed to make payment: %v", err)
+	}
+	if err := repo.Update(ctx, second); err != ErrVersionConflict {
+		t.Fatalf("Expected ErrVersionConflict, got %v", err)
+	}
+
+	retrieved, err := repo.GetByID(ctx, "test-loan-cas")
+	if err != nil {
+		t.Fatalf("Failed to retrieve loan: %v", err)
+	}
+	if retrieved.PaidCount != 1 {
+		t.Errorf("Expected PaidCount 1, got %d", retrieved.PaidCount)
+	}
+	if retrieved.Version != 1 {
+		t.Errorf("Expected stored version 1, got %d", retrieved.Version)
+	}
+
+	// Updating a loan that does not exist is still reported as not found
+	missing, err := NewLoan("missing", 1000000, 0.1, startDate)
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	if err := repo.Update(ctx, missing); err != ErrLoanNotFound {
+		t.Errorf("Expected ErrLoanNotFound, got %v", err)
+	}
+}
 
+func testRepositoryList(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
 	startDate := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
 
 	// Create multiple loans
@@ -145,13 +385,13 @@ func TestSQLiteLoanRepository_List(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Failed to create loan %d: %v", i, err)
 		}
-		err = repo.Create(loan)
+		err = repo.Create(ctx, loan)
 		if err != nil {
 			t.Fatalf("Failed to create loan %d in repo: %v", i, err)
 		}
 	}
 
-	loans, err := repo.List()
+	loans, err := repo.List(ctx, LoanFilter{})
 	if err != nil {
 		t.Fatalf("Failed to list loans: %v", err)
 	}
@@ -161,38 +401,734 @@ func TestSQLiteLoanRepository_List(t *testing.T) {
 	}
 }
 
-func TestSQLiteLoanRepository_Delete(t *testing.T) {
-	db := setupTestDB(t)
-	defer db.Close()
-
-	repo := NewSQLiteLoanRepository(db)
-
+func testRepositoryDelete(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
 	startDate := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
 	loan, err := NewLoan("test-loan-delete", 1000000, 0.1, startDate)
 	if err != nil {
 		t.Fatalf("Failed to create loan: %v", err)
 	}
 
-	err = repo.Create(loan)
+	err = repo.Create(ctx, loan)
 	if err != nil {
 		t.Fatalf("Failed to create loan: %v", err)
 	}
 
 	// Delete the loan
-	err = repo.Delete("test-loan-delete")
+	err = repo.Delete(ctx, "test-loan-delete")
 	if err != nil {
 		t.Fatalf("Failed to delete loan: %v", err)
 	}
 
 	// Verify deletion
-	_, err = repo.GetByID("test-loan-delete")
+	_, err = repo.GetByID(ctx, "test-loan-delete")
 	if err != ErrLoanNotFound {
 		t.Errorf("Expected ErrLoanNotFound after deletion, got %v", err)
 	}
 
 	// Test deleting non-existent loan
-	err = repo.Delete("non-existent")
+	err = repo.Delete(ctx, "non-existent")
 	if err != ErrLoanNotFound {
 		t.Errorf("Expected ErrLoanNotFound for non-existent loan, got %v", err)
 	}
 }
+
+func testRepositoryJournal(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
+	chart := DefaultChartOfAccounts()
+
+	loan, err := NewLoan("test-loan-journal", 5000000, 0.1, time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+
+	entries := []*JournalEntry{
+		DisbursementEntry(loan, chart),
+		PaymentEntry(loan, 1, time.Date(2025, 8, 20, 10, 0, 0, 0, time.UTC), chart),
+		PaymentEntry(loan, 2, time.Date(2025, 9, 2, 10, 0, 0, 0, time.UTC), chart),
+	}
+	for _, entry := range entries {
+		if err := repo.PostJournalEntry(ctx, entry); err != nil {
+			t.Fatalf("Failed to post %s: %v", entry.ID, err)
+		}
+	}
+
+	// Posting the same entry twice is rejected
+	if err := repo.PostJournalEntry(ctx, entries[0]); err == nil {
+		t.Error("Expected duplicate journal entry to be rejected")
+	}
+
+	// Unbalanced entries are never stored
+	unbalanced := &JournalEntry{ID: "je_bad", LoanID: loan.ID, Event: JournalEventPayment, PostedAt: time.Now(),
+		Lines: []JournalLine{{Account: chart.Cash, Debit: 1}}}
+	if err := repo.PostJournalEntry(ctx, unbalanced); err != ErrUnbalancedEntry {
+		t.Errorf("Expected ErrUnbalancedEntry, got %v", err)
+	}
+
+	august, err := repo.ListJournalEntries(ctx, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to list journal: %v", err)
+	}
+	if len(august) != 2 {
+		t.Fatalf("Expected 2 entries in August, got %d", len(august))
+	}
+	if august[0].ID != entries[0].ID || august[1].ID != entries[1].ID {
+		t.Errorf("Unexpected entries or order: %s, %s", august[0].ID, august[1].ID)
+	}
+	if len(august[1].Lines) != 3 {
+		t.Errorf("Expected 3 lines on payment entry, got %d", len(august[1].Lines))
+	}
+	if err := august[1].Validate(); err != nil {
+		t.Errorf("Stored payment entry is not balanced: %v", err)
+	}
+	if !august[1].PostedAt.Equal(entries[1].PostedAt) {
+		t.Errorf("Expected posted_at %v, got %v", entries[1].PostedAt, august[1].PostedAt)
+	}
+
+	payment, err := repo.GetJournalEntry(ctx, entries[2].ID)
+	if err != nil {
+		t.Fatalf("Failed to get journal entry: %v", err)
+	}
+	if !reflect.DeepEqual(payment.Lines, entries[2].Lines) || payment.Event != JournalEventPayment || !payment.PostedAt.Equal(entries[2].PostedAt) {
+		t.Errorf("Expected %+v, got %+v", entries[2], payment)
+	}
+	if _, err := repo.GetJournalEntry(ctx, "je_missing"); err != ErrJournalEntryNotFound {
+		t.Errorf("Expected ErrJournalEntryNotFound, got %v", err)
+	}
+}
+
+func testRepositoryRestructure(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
+	loan, err := NewLoan("restructure-loan", 5_000_000, 0.10, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+	if err := loan.MakePayment(110_000, time.Date(2025, 8, 8, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("payment failed: %v", err)
+	}
+	if err := repo.Create(ctx, loan); err != nil {
+		t.Fatalf("failed to store loan: %v", err)
+	}
+
+	// Lengthen the schedule
+	now := time.Date(2025, 8, 10, 0, 0, 0, 0, time.UTC)
+	if _, err := loan.Restructure(RestructureOptions{ExtendWeeks: 4, Reason: "hardship"}, now); err != nil {
+		t.Fatalf("restructure failed: %v", err)
+	}
+	if err := repo.Update(ctx, loan); err != nil {
+		t.Fatalf("failed to update loan: %v", err)
+	}
+	if loan.Restructures[0].ID == 0 {
+		t.Error("expected restructure to be assigned an ID")
+	}
+
+	retrieved, err := repo.GetByID(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("failed to get loan: %v", err)
+	}
+	if len(retrieved.Schedule) != 54 {
+		t.Fatalf("expected 54 weeks, got %d", len(retrieved.Schedule))
+	}
+	for i := range loan.Schedule {
+		if retrieved.Schedule[i].Amount != loan.Schedule[i].Amount || !retrieved.Schedule[i].DueDate.Equal(loan.Schedule[i].DueDate) {
+			t.Errorf("week %d mismatch: expected %+v, got %+v", i+1, loan.Schedule[i], retrieved.Schedule[i])
+		}
+	}
+	if retrieved.WeeklyDue != loan.WeeklyDue {
+		t.Errorf("expected weekly due %d, got %d", loan.WeeklyDue, retrieved.WeeklyDue)
+	}
+	if len(retrieved.Restructures) != 1 {
+		t.Fatalf("expected 1 restructure, got %d", len(retrieved.Restructures))
+	}
+	if r := retrieved.Restructures[0]; r.Reason != "hardship" || r.Before.RemainingWeeks != 49 || r.After.RemainingWeeks != 53 {
+		t.Errorf("unexpected restructure %+v", r)
+	}
+
+	// Shorten it again; surplus rows must be removed
+	if _, err := retrieved.Restructure(RestructureOptions{InstallmentAmount: 1_000_000}, now); err != nil {
+		t.Fatalf("restructure failed: %v", err)
+	}
+	if err := repo.Update(ctx, retrieved); err != nil {
+		t.Fatalf("failed to update loan: %v", err)
+	}
+	retrieved, err = repo.GetByID(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("failed to get loan: %v", err)
+	}
+	if len(retrieved.Schedule) != 7 || len(retrieved.Restructures) != 2 {
+		t.Errorf("expected 7 weeks and 2 restructures, got %d and %d", len(retrieved.Schedule), len(retrieved.Restructures))
+	}
+	if retrieved.GetOutstanding() != 5_390_000 {
+		t.Errorf("expected outstanding 5390000, got %d", retrieved.GetOutstanding())
+	}
+}
+
+func testRepositoryExternalID(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
+	startDate := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	// Loans without a partner reference do not clash with each other
+	for i := 0; i < 2; i++ {
+		loan, err := NewLoan(fmt.Sprintf("no-ref-%d", i), 1000000, 0.1, startDate)
+		if err != nil {
+			t.Fatalf("Failed to create loan: %v", err)
+		}
+		if err := repo.Create(ctx, loan); err != nil {
+			t.Fatalf("Failed to create loan in repository: %v", err)
+		}
+	}
+
+	loan, err := NewLoan("with-ref", 1000000, 0.1, startDate)
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	loan.ExternalID = "KTR-2025-0001"
+	if err := repo.Create(ctx, loan); err != nil {
+		t.Fatalf("Failed to create loan in repository: %v", err)
+	}
+
+	retrieved, err := repo.GetByExternalID(ctx, "KTR-2025-0001")
+	if err != nil {
+		t.Fatalf("Failed to retrieve loan by external ID: %v", err)
+	}
+	if retrieved.ID != "with-ref" || retrieved.ExternalID != "KTR-2025-0001" {
+		t.Errorf("Expected loan with-ref, got %s (%s)", retrieved.ID, retrieved.ExternalID)
+	}
+
+	if _, err := repo.GetByExternalID(ctx, "KTR-2025-0002"); err != ErrLoanNotFound {
+		t.Errorf("Expected ErrLoanNotFound, got %v", err)
+	}
+
+	duplicate, err := NewLoan("duplicate-ref", 1000000, 0.1, startDate)
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	duplicate.ExternalID = "KTR-2025-0001"
+	if err := repo.Create(ctx, duplicate); err != ErrExternalIDExists {
+		t.Errorf("Expected ErrExternalIDExists, got %v", err)
+	}
+
+	loan.ID = "no-ref-0"
+	loan.ExternalID = ""
+	if err := repo.Create(ctx, loan); err != ErrLoanExists {
+		t.Errorf("Expected ErrLoanExists, got %v", err)
+	}
+}
+
+func testRepositoryLifecycle(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+	loan, err := NewLoan("lifecycle-loan", 1_000_000, 0.1, time.Date(2025, 8, 4, 0, 0, 0, 0, jakarta))
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	if err := repo.Create(ctx, loan); err != nil {
+		t.Fatalf("Failed to store loan: %v", err)
+	}
+
+	now := time.Date(2025, 8, 6, 9, 0, 0, 0, time.UTC)
+	if _, err := loan.DeferWeeks([]int{2, 3}, "harvest", DueDatePolicy{}, now); err != nil {
+		t.Fatalf("Deferral failed: %v", err)
+	}
+	if err := repo.Update(ctx, loan); err != nil {
+		t.Fatalf("Failed to update loan: %v", err)
+	}
+	if loan.Deferrals[0].ID == 0 {
+		t.Error("Expected deferral to be assigned an ID")
+	}
+
+	writeOffAt := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	if err := loan.WriteOff(writeOffAt); err != nil {
+		t.Fatalf("Write-off failed: %v", err)
+	}
+	if _, err := loan.RecordRecovery(250_000, writeOffAt.AddDate(0, 0, 3)); err != nil {
+		t.Fatalf("Recovery failed: %v", err)
+	}
+	if err := repo.Update(ctx, loan); err != nil {
+		t.Fatalf("Failed to update loan: %v", err)
+	}
+	if loan.Recoveries[0].ID == 0 {
+		t.Error("Expected recovery to be assigned an ID")
+	}
+
+	retrieved, err := repo.GetByID(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+	if retrieved.Timezone != "Asia/Jakarta" || retrieved.StartDate.Location().String() != "Asia/Jakarta" || !retrieved.StartDate.Equal(loan.StartDate) {
+		t.Errorf("Expected start date %v in Asia/Jakarta, got %v (%s)", loan.StartDate, retrieved.StartDate, retrieved.Timezone)
+	}
+	for i := range loan.Schedule {
+		want, got := loan.Schedule[i], retrieved.Schedule[i]
+		if got.Amount != want.Amount || got.Deferred != want.Deferred || !got.DueDate.Equal(want.DueDate) || !got.ScheduledDate.Equal(want.ScheduledDate) {
+			t.Errorf("Week %d mismatch: expected %+v, got %+v", i+1, want, got)
+		}
+	}
+	if len(retrieved.Deferrals) != 1 || retrieved.Deferrals[0].Reason != "harvest" || len(retrieved.Deferrals[0].Weeks) != 2 || retrieved.Deferrals[0].Weeks[1] != 3 {
+		t.Errorf("Unexpected deferrals %+v", retrieved.Deferrals)
+	} else {
+		want, got := loan.Deferrals[0].Moved, retrieved.Deferrals[0].Moved
+		if len(got) != 2 || !got[1].ScheduledDate.Equal(want[1].ScheduledDate) || !got[1].DeferredTo.Equal(want[1].DeferredTo) {
+			t.Errorf("Expected moved weeks %+v, got %+v", want, got)
+		}
+	}
+	if retrieved.Status != LoanStatusWrittenOff || retrieved.WrittenOffAt == nil || !retrieved.WrittenOffAt.Equal(writeOffAt) {
+		t.Errorf("Expected loan written off at %v, got %s at %v", writeOffAt, retrieved.Status, retrieved.WrittenOffAt)
+	}
+	if retrieved.WrittenOffAmount != loan.WrittenOffAmount || retrieved.RecoveredAmount() != 250_000 {
+		t.Errorf("Expected written off %d and recovered 250000, got %d and %d", loan.WrittenOffAmount, retrieved.WrittenOffAmount, retrieved.RecoveredAmount())
+	}
+	if retrieved.Version != 2 {
+		t.Errorf("Expected version 2, got %d", retrieved.Version)
+	}
+}
+
+func testRepositoryAccruals(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
+	accruals := []InterestAccrual{
+		{LoanID: "accrual-loan", Date: time.Date(2025, 8, 2, 0, 0, 0, 0, time.UTC), Amount: 1370, Method: AccrualStraightLine},
+		{LoanID: "accrual-loan", Date: time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), Amount: 1369, Method: AccrualStraightLine},
+		{LoanID: "other-loan", Date: time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), Amount: 500, Method: AccrualStraightLine},
+	}
+	if err := repo.SaveAccruals(ctx, accruals); err != nil {
+		t.Fatalf("Failed to save accruals: %v", err)
+	}
+
+	// The same loan cannot accrue twice for one day
+	if err := repo.SaveAccruals(ctx, accruals[:1]); err == nil {
+		t.Error("Expected duplicate accrual to be rejected")
+	}
+
+	stored, err := repo.ListAccruals(ctx, "accrual-loan")
+	if err != nil {
+		t.Fatalf("Failed to list accruals: %v", err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("Expected 2 accruals, got %d", len(stored))
+	}
+	if !stored[0].Date.Equal(accruals[1].Date) || stored[0].Amount != 1369 || stored[1].Amount != 1370 || stored[0].Method != AccrualStraightLine {
+		t.Errorf("Unexpected accruals %+v", stored)
+	}
+}
+
+func testRepositoryCancelled(t *testing.T, repo LoanRepository) {
+	loan, err := NewLoan("cancelled-loan", 1_000_000, 0.1, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	if err := repo.Create(context.Background(), loan); err != nil {
+		t.Fatalf("Failed to store loan: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := repo.GetByID(ctx, loan.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected GetByID to fail with context.Canceled, got %v", err)
+	}
+	if _, err := repo.List(ctx, LoanFilter{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected List to fail with context.Canceled, got %v", err)
+	}
+	if err := loan.MakePayment(loan.WeeklyDue, loan.StartDate); err != nil {
+		t.Fatalf("Failed to make payment: %v", err)
+	}
+	if err := repo.Update(ctx, loan); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Update to fail with context.Canceled, got %v", err)
+	}
+
+	// Nothing was written by the cancelled update
+	stored, err := repo.GetByID(context.Background(), loan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+	if stored.PaidCount != 0 || stored.Version != 0 {
+		t.Errorf("Expected the loan unchanged, got %d payments at version %d", stored.PaidCount, stored.Version)
+	}
+}
+
+func testRepositoryWithTx(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
+	loan, err := NewLoan("unit-loan", 1_000_000, 0.1, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	if err := repo.Create(ctx, loan); err != nil {
+		t.Fatalf("Failed to store loan: %v", err)
+	}
+	paidAt := time.Date(2025, 8, 8, 0, 0, 0, 0, time.UTC)
+
+	// A failing unit of work leaves nothing behind
+	failure := fmt.Errorf("ledger unavailable")
+	err = repo.WithTx(ctx, func(tx LoanRepository) error {
+		current, err := tx.GetByID(ctx, loan.ID)
+		if err != nil {
+			return err
+		}
+		if err := current.MakePayment(current.WeeklyDue, paidAt); err != nil {
+			return err
+		}
+		if err := tx.Update(ctx, current); err != nil {
+			return err
+		}
+		if err := tx.PostJournalEntry(ctx, PaymentEntry(current, 1, paidAt, DefaultChartOfAccounts())); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the unit's own error, got %v", err)
+	}
+
+	stored, err := repo.GetByID(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+	if stored.PaidCount != 0 || stored.Version != 0 {
+		t.Errorf("Expected the rolled back payment to be gone, got %d payments at version %d", stored.PaidCount, stored.Version)
+	}
+	entries, err := repo.ListJournalEntries(ctx, paidAt.AddDate(0, 0, -1), paidAt.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Failed to list journal entries: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected no journal entries after rollback, got %d", len(entries))
+	}
+
+	// A successful one stores everything, including work done by a nested unit
+	err = repo.WithTx(ctx, func(tx LoanRepository) error {
+		current, err := tx.GetByID(ctx, loan.ID)
+		if err != nil {
+			return err
+		}
+		if err := current.MakePayment(current.WeeklyDue, paidAt); err != nil {
+			return err
+		}
+		if err := tx.Update(ctx, current); err != nil {
+			return err
+		}
+		return tx.WithTx(ctx, func(tx LoanRepository) error {
+			return tx.PostJournalEntry(ctx, PaymentEntry(current, 1, paidAt, DefaultChartOfAccounts()))
+		})
+	})
+	if err != nil {
+		t.Fatalf("Unit of work failed: %v", err)
+	}
+
+	stored, err = repo.GetByID(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+	if stored.PaidCount != 1 || stored.Version != 1 {
+		t.Errorf("Expected 1 payment at version 1, got %d at version %d", stored.PaidCount, stored.Version)
+	}
+	entries, err = repo.ListJournalEntries(ctx, paidAt.AddDate(0, 0, -1), paidAt.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Failed to list journal entries: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected 1 journal entry, got %d", len(entries))
+	}
+}
+
+func testRepositoryTimestamps(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+
+	// Microseconds are the finest precision every backend keeps
+	loan, err := NewLoan("test-loan-timestamps", 1000000, 0.1, time.Date(2025, 9, 1, 8, 30, 15, 123456000, jakarta))
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	if err := repo.Create(ctx, loan); err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+
+	paidAt := time.Date(2025, 9, 7, 23, 45, 0, 654321000, newYork)
+	loan.Schedule[0].Paid = true
+	loan.Schedule[0].PaidAt = &paidAt
+	if err := repo.Update(ctx, loan); err != nil {
+		t.Fatalf("Failed to update loan: %v", err)
+	}
+
+	stored, err := repo.GetByID(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+	if !stored.StartDate.Equal(loan.StartDate) || stored.StartDate.Location().String() != "Asia/Jakarta" {
+		t.Errorf("Expected start date %v, got %v", loan.StartDate, stored.StartDate)
+	}
+	for i, week := range stored.Schedule {
+		if !week.DueDate.Equal(loan.Schedule[i].DueDate) || !week.ScheduledDate.Equal(loan.Schedule[i].ScheduledDate) {
+			t.Errorf("Week %d: expected due %v, got %v", week.Index, loan.Schedule[i].DueDate, week.DueDate)
+		}
+	}
+	if got := stored.Schedule[0].PaidAt; got == nil || !got.Equal(paidAt) {
+		t.Errorf("Expected paid_at %v, got %v", paidAt, got)
+	}
+
+	// Range queries compare instants, whatever zone the bounds are given in
+	entry := PaymentEntry(loan, 1, paidAt, DefaultChartOfAccounts())
+	if err := repo.PostJournalEntry(ctx, entry); err != nil {
+		t.Fatalf("Failed to post %s: %v", entry.ID, err)
+	}
+	for _, tt := range []struct {
+		from, to time.Time
+		want     int
+	}{
+		{time.Date(2025, 9, 8, 0, 0, 0, 0, jakarta), time.Date(2025, 9, 9, 0, 0, 0, 0, jakarta), 1},
+		{time.Date(2025, 9, 8, 0, 0, 0, 0, newYork), time.Date(2025, 9, 9, 0, 0, 0, 0, newYork), 0},
+		{paidAt, paidAt.Add(time.Microsecond), 1},
+		{paidAt.Add(-time.Microsecond), paidAt, 0},
+	} {
+		entries, err := repo.ListJournalEntries(ctx, tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("Failed to list journal: %v", err)
+		}
+		if len(entries) != tt.want {
+			t.Errorf("Expected %d entries in [%v, %v), got %d", tt.want, tt.from, tt.to, len(entries))
+			continue
+		}
+		if tt.want == 1 && !entries[0].PostedAt.Equal(paidAt) {
+			t.Errorf("Expected posted_at %v, got %v", paidAt, entries[0].PostedAt)
+		}
+	}
+}
+
+func testRepositoryUpdatedAt(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
+	// PostgreSQL keeps microseconds
+	sameInstant := func(a, b time.Time) bool {
+		return a.Sub(b).Abs() < time.Microsecond
+	}
+
+	untouched, err := NewLoan("test-loan-untouched", 1000000, 0.1, time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	loan, err := NewLoan("test-loan-updated", 1000000, 0.1, time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	for _, l := range []*Loan{untouched, loan} {
+		if err := repo.Create(ctx, l); err != nil {
+			t.Fatalf("Failed to create loan: %v", err)
+		}
+	}
+	created := loan.CreatedAt
+	if created.IsZero() || !loan.UpdatedAt.Equal(created) || !loan.Schedule[49].UpdatedAt.Equal(created) {
+		t.Fatalf("Expected Create to stamp the loan and its weeks, got %v, %v, %v", created, loan.UpdatedAt, loan.Schedule[49].UpdatedAt)
+	}
+
+	time.Sleep(time.Millisecond)
+	loan, err = repo.GetByID(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+	paidAt := time.Date(2025, 9, 8, 0, 0, 0, 0, time.UTC)
+	loan.Schedule[0].Paid = true
+	loan.Schedule[0].PaidAt = &paidAt
+	if err := repo.Update(ctx, loan); err != nil {
+		t.Fatalf("Failed to update loan: %v", err)
+	}
+	updated := loan.UpdatedAt
+	if !updated.After(created) {
+		t.Fatalf("Expected updated_at after %v, got %v", created, updated)
+	}
+
+	stored, err := repo.GetByID(ctx, loan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get loan: %v", err)
+	}
+	if !sameInstant(stored.CreatedAt, created) || !sameInstant(stored.UpdatedAt, updated) {
+		t.Errorf("Expected created_at %v and updated_at %v, got %v and %v", created, updated, stored.CreatedAt, stored.UpdatedAt)
+	}
+	if !sameInstant(stored.Schedule[0].UpdatedAt, updated) || !sameInstant(stored.Schedule[1].UpdatedAt, created) {
+		t.Errorf("Expected only the paid week restamped, got %v and %v", stored.Schedule[0].UpdatedAt, stored.Schedule[1].UpdatedAt)
+	}
+
+	for _, tt := range []struct {
+		filter LoanFilter
+		want   int
+	}{
+		{LoanFilter{}, 2},
+		{LoanFilter{UpdatedSince: created.Add(-time.Second)}, 2},
+		{LoanFilter{UpdatedSince: stored.UpdatedAt}, 1},
+		{LoanFilter{UpdatedSince: stored.UpdatedAt.Add(time.Millisecond)}, 0},
+	} {
+		loans, err := repo.List(ctx, tt.filter)
+		if err != nil {
+			t.Fatalf("Failed to list loans: %v", err)
+		}
+		if len(loans) != tt.want {
+			t.Errorf("Expected %d loans updated since %v, got %d", tt.want, tt.filter.UpdatedSince, len(loans))
+		}
+		if tt.want == 1 && (loans[0].ID != loan.ID || !sameInstant(loans[0].UpdatedAt, updated)) {
+			t.Errorf("Expected loan %s updated at %v, got %s at %v", loan.ID, updated, loans[0].ID, loans[0].UpdatedAt)
+		}
+	}
+}
+
+func testRepositorySoftDelete(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
+	loan, err := NewLoan("test-loan-soft-delete", 1000000, 0.1, time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	loan.ExternalID = "ref-soft-delete"
+	if err := repo.Create(ctx, loan); err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+
+	if err := repo.Restore(ctx, loan.ID); err != ErrLoanNotDeleted {
+		t.Errorf("Expected ErrLoanNotDeleted for a live loan, got %v", err)
+	}
+	if err := repo.Delete(ctx, loan.ID); err != nil {
+		t.Fatalf("Failed to delete loan: %v", err)
+	}
+	if err := repo.Delete(ctx, loan.ID); err != ErrLoanNotFound {
+		t.Errorf("Expected ErrLoanNotFound deleting twice, got %v", err)
+	}
+
+	// Reads skip the deleted loan, and so do writes
+	if _, err := repo.GetByExternalID(ctx, "ref-soft-delete"); err != ErrLoanNotFound {
+		t.Errorf("Expected ErrLoanNotFound by reference, got %v", err)
+	}
+	if err := repo.Update(ctx, loan); err != ErrLoanNotFound {
+		t.Errorf("Expected ErrLoanNotFound updating a deleted loan, got %v", err)
+	}
+	if loans, err := repo.List(ctx, LoanFilter{}); err != nil || len(loans) != 0 {
+		t.Errorf("Expected no loans listed, got %d (%v)", len(loans), err)
+	}
+	loans, err := repo.List(ctx, LoanFilter{IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("Failed to list loans: %v", err)
+	}
+	if len(loans) != 1 || loans[0].DeletedAt == nil {
+		t.Fatalf("Expected the deleted loan listed with deleted_at, got %+v", loans)
+	}
+
+	// The ID and reference stay taken while the loan is deleted
+	duplicate, err := NewLoan(loan.ID, 1000000, 0.1, time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	if err := repo.Create(ctx, duplicate); err != ErrLoanExists {
+		t.Errorf("Expected ErrLoanExists, got %v", err)
+	}
+
+	if err := repo.Restore(ctx, loan.ID); err != nil {
+		t.Fatalf("Failed to restore loan: %v", err)
+	}
+	restored, err := repo.GetByExternalID(ctx, "ref-soft-delete")
+	if err != nil {
+		t.Fatalf("Failed to get restored loan: %v", err)
+	}
+	if restored.DeletedAt != nil || len(restored.Schedule) != 50 || restored.Version != 2 {
+		t.Errorf("Expected the loan back with its schedule at version 2, got deleted_at %v, %d weeks, version %d",
+			restored.DeletedAt, len(restored.Schedule), restored.Version)
+	}
+	if err := repo.Restore(ctx, "non-existent"); err != ErrLoanNotFound {
+		t.Errorf("Expected ErrLoanNotFound restoring a missing loan, got %v", err)
+	}
+}
+
+func testRepositoryArchive(t *testing.T, repo LoanRepository) {
+	ctx := context.Background()
+	startDate := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	paid, err := NewLoan("test-loan-archive-paid", 1000000, 0.1, startDate)
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	paid.ExternalID = "ref-archive"
+	active, err := NewLoan("test-loan-archive-active", 1000000, 0.1, startDate)
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	for _, l := range []*Loan{paid, active} {
+		if err := repo.Create(ctx, l); err != nil {
+			t.Fatalf("Failed to create loan: %v", err)
+		}
+	}
+
+	now := startDate.AddDate(0, 0, 2)
+	if _, err := paid.DeferWeeks([]int{2}, "harvest", DueDatePolicy{}, now); err != nil {
+		t.Fatalf("Deferral failed: %v", err)
+	}
+	for paid.Status != LoanStatusPaidOff {
+		if err := paid.MakePayment(paid.Schedule[paid.PaidCount].Amount, now); err != nil {
+			t.Fatalf("Failed to make payment: %v", err)
+		}
+	}
+	if err := repo.Update(ctx, paid); err != nil {
+		t.Fatalf("Failed to update loan: %v", err)
+	}
+
+	if ids, err := repo.Archive(ctx, paid.CreatedAt); err != nil || len(ids) != 0 {
+		t.Errorf("Expected nothing archived before the payoff, got %v (%v)", ids, err)
+	}
+	ids, err := repo.Archive(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to archive loans: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != paid.ID {
+		t.Fatalf("Expected only the paid-off loan archived, got %v", ids)
+	}
+
+	if _, err := repo.GetByID(ctx, paid.ID); err != ErrLoanNotFound {
+		t.Errorf("Expected ErrLoanNotFound for an archived loan, got %v", err)
+	}
+	if _, err := repo.GetByExternalID(ctx, "ref-archive"); err != ErrLoanNotFound {
+		t.Errorf("Expected ErrLoanNotFound by reference, got %v", err)
+	}
+	loans, err := repo.List(ctx, LoanFilter{IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("Failed to list loans: %v", err)
+	}
+	if len(loans) != 1 || loans[0].ID != active.ID {
+		t.Errorf("Expected only the active loan listed, got %d loans", len(loans))
+	}
+	if err := repo.Delete(ctx, paid.ID); err != ErrLoanNotFound {
+		t.Errorf("Expected ErrLoanNotFound deleting an archived loan, got %v", err)
+	}
+
+	// An archived loan keeps its ID and reference so it can be restored
+	duplicate, err := NewLoan(paid.ID, 1000000, 0.1, startDate)
+	if err != nil {
+		t.Fatalf("Failed to create loan: %v", err)
+	}
+	if err := repo.Create(ctx, duplicate); err != ErrLoanExists {
+		t.Errorf("Expected ErrLoanExists, got %v", err)
+	}
+	duplicate.ID = "test-loan-archive-other"
+	duplicate.ExternalID = "ref-archive"
+	if err := repo.Create(ctx, duplicate); err != ErrExternalIDExists {
+		t.Errorf("Expected ErrExternalIDExists, got %v", err)
+	}
+
+	if err := repo.Restore(ctx, paid.ID); err != nil {
+		t.Fatalf("Failed to restore loan: %v", err)
+	}
+	restored, err := repo.GetByExternalID(ctx, "ref-archive")
+	if err != nil {
+		t.Fatalf("Failed to get restored loan: %v", err)
+	}
+	if restored.Status != LoanStatusPaidOff || restored.PaidCount != 50 || len(restored.Schedule) != 50 || !restored.Schedule[49].Paid {
+		t.Errorf("Expected the paid-off schedule back, got %s with %d of %d weeks paid", restored.Status, restored.PaidCount, len(restored.Schedule))
+	}
+	if len(restored.Deferrals) != 1 || restored.Deferrals[0].ID != paid.Deferrals[0].ID {
+		t.Errorf("Expected deferral %d back, got %+v", paid.Deferrals[0].ID, restored.Deferrals)
+	}
+	if restored.Version != paid.Version+1 {
+		t.Errorf("Expected version %d, got %d", paid.Version+1, restored.Version)
+	}
+}
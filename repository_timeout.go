@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// timeoutRepository bounds every call to the wrapped repository by a fixed
+// timeout. A call that runs out of time fails with ErrQueryTimeout; one whose
+// caller gave up first keeps the caller's context error.
+type timeoutRepository struct {
+	repo    LoanRepository
+	timeout time.Duration
+}
+
+// WithQueryTimeout returns repo with every call limited to timeout. A timeout
+// of zero or less returns repo unchanged.
+func WithQueryTimeout(repo LoanRepository, timeout time.Duration) LoanRepository {
+	if timeout <= 0 {
+		return repo
+	}
+	return &timeoutRepository{repo: repo, timeout: timeout}
+}
+
+// call runs fn with a context limited to the query timeout
+func (r *timeoutRepository) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	queryCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	err := fn(queryCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(queryCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s: %v", ErrQueryTimeout, r.timeout, err)
+	}
+	return err
+}
+
+func (r *timeoutRepository) Create(ctx context.Context, loan *Loan) error {
+	return r.call(ctx, func(ctx context.Context) error {
+		return r.repo.Create(ctx, loan)
+	})
+}
+
+func (r *timeoutRepository) GetByID(ctx context.Context, id string) (loan *Loan, err error) {
+	err = r.call(ctx, func(ctx context.Context) error {
+		loan, err = r.repo.GetByID(ctx, id)
+		return err
+	})
+	return loan, err
+}
+
+func (r *timeoutRepository) GetByExternalID(ctx context.Context, externalID string) (loan *Loan, err error) {
+	err = r.call(ctx, func(ctx context.Context) error {
+		loan, err = r.repo.GetByExternalID(ctx, externalID)
+		return err
+	})
+	return loan, err
+}
+
+func (r *timeoutRepository) Update(ctx context.Context, loan *Loan) error {
+	return r.call(ctx, func(ctx context.Context) error {
+		return r.repo.Update(ctx, loan)
+	})
+}
+
+func (r *timeoutRepository) List(ctx context.Context, filter LoanFilter) (loans []*Loan, err error) {
+	err = r.call(ctx, func(ctx context.Context) error {
+		loans, err = r.repo.List(ctx, filter)
+		return err
+	})
+	return loans, err
+}
+
+func (r *timeoutRepository) Delete(ctx context.Context, id string) error {
+	return r.call(ctx, func(ctx context.Context) error {
+		return r.repo.Delete(ctx, id)
+	})
+}
+
+func (r *timeoutRepository) Archive(ctx context.Context, before time.Time) (ids []string, err error) {
+	err = r.call(ctx, func(ctx context.Context) error {
+		ids, err = r.repo.Archive(ctx, before)
+		return err
+	})
+	return ids, err
+}
+
+func (r *timeoutRepository) Restore(ctx context.Context, id string) error {
+	return r.call(ctx, func(ctx context.Context) error {
+		return r.repo.Restore(ctx, id)
+	})
+}
+
+func (r *timeoutRepository) PostJournalEntry(ctx context.Context, entry *JournalEntry) error {
+	return r.call(ctx, func(ctx context.Context) error {
+		return r.repo.PostJournalEntry(ctx, entry)
+	})
+}
+
+func (r *timeoutRepository) GetJournalEntry(ctx context.Context, id string) (entry *JournalEntry, err error) {
+	err = r.call(ctx, func(ctx context.Context) error {
+		entry, err = r.repo.GetJournalEntry(ctx, id)
+		return err
+	})
+	return entry, err
+}
+
+func (r *timeoutRepository) ListJournalEntries(ctx context.Context, from, to time.Time) (entries []*JournalEntry, err error) {
+	err = r.call(ctx, func(ctx context.Context) error {
+		entries, err = r.repo.ListJournalEntries(ctx, from, to)
+		return err
+	})
+	return entries, err
+}
+
+func (r *timeoutRepository) SaveAccruals(ctx context.Context, accruals []InterestAccrual) error {
+	return r.call(ctx, func(ctx context.Context) error {
+		return r.repo.SaveAccruals(ctx, accruals)
+	})
+}
+
+func (r *timeoutRepository) ListAccruals(ctx context.Context, loanID string) (accruals []InterestAccrual, err error) {
+	err = r.call(ctx, func(ctx context.Context) error {
+		accruals, err = r.repo.ListAccruals(ctx, loanID)
+		return err
+	})
+	return accruals, err
+}
+
+// WithTx limits the unit of work as a whole to the query timeout
+func (r *timeoutRepository) WithTx(ctx context.Context, fn func(tx LoanRepository) error) error {
+	return r.call(ctx, func(ctx context.Context) error {
+		return r.repo.WithTx(ctx, fn)
+	})
+}
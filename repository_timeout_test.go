@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// slowRepository is a repository whose loan lookups block until the context ends
+type slowRepository struct {
+	LoanRepository
+}
+
+func (r slowRepository) GetByID(ctx context.Context, id string) (*Loan, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestWithQueryTimeout(t *testing.T) {
+	repo := WithQueryTimeout(slowRepository{NewMemoryLoanRepository()}, 10*time.Millisecond)
+
+	_, err := repo.GetByID(context.Background(), "slow-loan")
+	if !errors.Is(err, ErrQueryTimeout) {
+		t.Errorf("Expected ErrQueryTimeout, got %v", err)
+	}
+
+	// A caller that gives up first gets its own error back, not a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = repo.GetByID(ctx, "slow-loan")
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrQueryTimeout) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// Calls that finish in time are passed through
+	if _, err := repo.List(context.Background(), LoanFilter{}); err != nil {
+		t.Errorf("Expected List to succeed, got %v", err)
+	}
+	if _, err := repo.GetByExternalID(context.Background(), "missing"); !errors.Is(err, ErrLoanNotFound) {
+		t.Errorf("Expected ErrLoanNotFound, got %v", err)
+	}
+
+	memory := NewMemoryLoanRepository()
+	if WithQueryTimeout(memory, 0) != LoanRepository(memory) {
+		t.Error("Expected a zero timeout to leave the repository unwrapped")
+	}
+}
+
+func TestQueryTimeoutAPI(t *testing.T) {
+	e := newServer()
+	repo := WithQueryTimeout(slowRepository{NewMemoryLoanRepository()}, 10*time.Millisecond)
+	registerRoutes(e, repo, defaultServiceConfig())
+
+	req := httptest.NewRequest(http.MethodGet, "/loans/slow-loan", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal error: %v", err)
+	}
+	if resp.Code != CodeQueryTimeout {
+		t.Errorf("expected code %s, got %s", CodeQueryTimeout, resp.Code)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import "time"
+
+// maxScheduleWeeks bounds the length of a restructured schedule
+const maxScheduleWeeks = 260
+
+// RestructureTerms describes the unpaid part of a loan's schedule
+type RestructureTerms struct {
+	RemainingWeeks    int       `json:"remaining_weeks"`
+	InstallmentAmount int64     `json:"installment_amount"`
+	Outstanding       int64     `json:"outstanding"`
+	NextDueDate       time.Time `json:"next_due_date"`
+	MaturityDate      time.Time `json:"maturity_date"`
+}
+
+// Restructure records a change to a loan's repayment terms
+type Restructure struct {
+	ID             int64            `json:"id"`
+	Reason         string           `json:"reason,omitempty"`
+	RestructuredAt time.Time        `json:"restructured_at"`
+	Before         RestructureTerms `json:"before"`
+	After          RestructureTerms `json:"after"`
+}
+
+// RestructureOptions selects how the unpaid schedule is regenerated.
+// ExtendWeeks and InstallmentAmount are mutually exclusive; HolidayWeeks can
+// be combined with either or used on its own. DueDates rolls the new due dates.
+type RestructureOptions struct {
+	ExtendWeeks       int
+	InstallmentAmount int64
+	HolidayWeeks      int
+	Reason            string
+	DueDates          DueDatePolicy
+}
+
+// firstUnpaidIndex returns the 0-based index of the oldest unpaid week, or -1
+func (l *Loan) firstUnpaidIndex() int {
+	for i, week := range l.Schedule {
+		if !week.Paid {
+			return i
+		}
+	}
+	return -1
+}
+
+// remainingTerms summarises the unpaid weeks starting at the given index
+func (l *Loan) remainingTerms(from int) RestructureTerms {
+	terms := RestructureTerms{RemainingWeeks: len(l.Schedule) - from}
+	if from < 0 || from >= len(l.Schedule) {
+		terms.RemainingWeeks = 0
+		return terms
+	}
+	for _, week := range l.Schedule[from:] {
+		terms.Outstanding += week.Amount
+	}
+	terms.InstallmentAmount = l.Schedule[from].Amount
+	terms.NextDueDate = l.Schedule[from].DueDate
+	terms.MaturityDate = l.Schedule[len(l.Schedule)-1].DueDate
+	return terms
+}
+
+// Restructure regenerates the unpaid weeks of the schedule. Paid weeks are
+// kept as they are; the outstanding balance is spread over the new weeks, so
+// restructuring never changes the total amount repaid. Weeks already past due
+// are rolled into the new schedule, which continues the weekly cadence from
+// the first due date after now, pushed back by any payment holiday.
+func (l *Loan) Restructure(opts RestructureOptions, now time.Time) (*Restructure, error) {
+	if l.Status == LoanStatusWrittenOff {
+		return nil, ErrLoanWrittenOff
+	}
+	first := l.firstUnpaidIndex()
+	if first == -1 {
+		return nil, ErrAlreadyPaid
+	}
+
+	if opts.ExtendWeeks < 0 || opts.InstallmentAmount < 0 || opts.HolidayWeeks < 0 {
+		return nil, ErrInvalidRestructure
+	}
+	if opts.ExtendWeeks == 0 && opts.InstallmentAmount == 0 && opts.HolidayWeeks == 0 {
+		return nil, ErrInvalidRestructure
+	}
+	if opts.ExtendWeeks > 0 && opts.InstallmentAmount > 0 {
+		return nil, ErrInvalidRestructure
+	}
+
+	before := l.remainingTerms(first)
+	outstanding := before.Outstanding
+
+	// Work out the new installment amounts
+	var amounts []int64
+	if opts.InstallmentAmount > 0 {
+		weeks := (outstanding + opts.InstallmentAmount - 1) / opts.InstallmentAmount
+		if int64(first)+weeks > maxScheduleWeeks {
+			return nil, ErrInvalidRestructure
+		}
+		for remaining := outstanding; remaining > 0; remaining -= opts.InstallmentAmount {
+			amounts = append(amounts, min(remaining, opts.InstallmentAmount))
+		}
+	} else {
+		weeks := before.RemainingWeeks + opts.ExtendWeeks
+		if first+weeks > maxScheduleWeeks {
+			return nil, ErrInvalidRestructure
+		}
+		// Spread evenly, the last week takes the remainder
+		amounts = make([]int64, weeks)
+		for i := range amounts {
+			amounts[i] = outstanding / int64(weeks)
+		}
+		amounts[weeks-1] += outstanding % int64(weeks)
+	}
+
+	// Work out the first new scheduled date, keeping the weekly cadence
+	next := l.Schedule[first].ScheduledDate
+	for !next.After(now) {
+		next = next.AddDate(0, 0, 7)
+	}
+	next = next.AddDate(0, 0, 7*opts.HolidayWeeks)
+
+	schedule := append([]Week(nil), l.Schedule[:first]...)
+	for i, amount := range amounts {
+		scheduled := next.AddDate(0, 0, 7*i)
+		schedule = append(schedule, Week{
+			Index:         first + i + 1,
+			Amount:        amount,
+			ScheduledDate: scheduled,
+			DueDate:       opts.DueDates.Adjust(scheduled),
+		})
+	}
+	l.Schedule = schedule
+	l.WeeklyDue = amounts[0]
+	l.GetOutstanding()
+
+	l.Restructures = append(l.Restructures, Restructure{
+		Reason:         opts.Reason,
+		RestructuredAt: now,
+		Before:         before,
+		After:          l.remainingTerms(first),
+	})
+	return &l.Restructures[len(l.Restructures)-1], nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newPaidLoan returns a 5,000,000 loan starting 2025-08-01 with the first paid weeks settled
+func newPaidLoan(t *testing.T, paid int) *Loan {
+	t.Helper()
+	startDate := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	loan, err := NewLoan("test", 5_000_000, 0.10, startDate)
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+	for i := 0; i < paid; i++ {
+		if err := loan.MakePayment(loan.WeeklyDue, loan.Schedule[i].DueDate); err != nil {
+			t.Fatalf("payment %d failed: %v", i+1, err)
+		}
+	}
+	return loan
+}
+
+func TestLoanRestructure(t *testing.T) {
+	now := time.Date(2025, 8, 20, 0, 0, 0, 0, time.UTC)
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2025, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name            string
+		now             time.Time
+		opts            RestructureOptions
+		expectedWeeks   int
+		expectedFirst   int64
+		expectedLast    int64
+		expectedNextDue time.Time
+	}{
+		{
+			name:            "extend tenor",
+			now:             now,
+			opts:            RestructureOptions{ExtendWeeks: 12},
+			expectedWeeks:   60,
+			expectedFirst:   88_000,
+			expectedLast:    88_000,
+			expectedNextDue: date(time.August, 22),
+		},
+		{
+			name:            "change installment amount",
+			now:             now,
+			opts:            RestructureOptions{InstallmentAmount: 100_000},
+			expectedWeeks:   53,
+			expectedFirst:   100_000,
+			expectedLast:    80_000,
+			expectedNextDue: date(time.August, 22),
+		},
+		{
+			name:            "payment holiday",
+			now:             now,
+			opts:            RestructureOptions{HolidayWeeks: 2},
+			expectedWeeks:   48,
+			expectedFirst:   110_000,
+			expectedLast:    110_000,
+			expectedNextDue: date(time.September, 5),
+		},
+		{
+			name:            "arrears rolled forward",
+			now:             date(time.September, 1),
+			opts:            RestructureOptions{HolidayWeeks: 1},
+			expectedWeeks:   48,
+			expectedFirst:   110_000,
+			expectedLast:    110_000,
+			expectedNextDue: date(time.September, 12),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan := newPaidLoan(t, 2)
+			paidHistory := append([]Week(nil), loan.Schedule[:2]...)
+
+			restructure, err := loan.Restructure(tt.opts, tt.now)
+			if err != nil {
+				t.Fatalf("restructure failed: %v", err)
+			}
+
+			if len(loan.Schedule) != 2+tt.expectedWeeks {
+				t.Fatalf("expected %d weeks in schedule, got %d", 2+tt.expectedWeeks, len(loan.Schedule))
+			}
+			for i := range paidHistory {
+				if loan.Schedule[i] != paidHistory[i] {
+					t.Errorf("paid week %d changed: %+v", i+1, loan.Schedule[i])
+				}
+			}
+			for i, week := range loan.Schedule {
+				if week.Index != i+1 {
+					t.Errorf("expected week index %d, got %d", i+1, week.Index)
+				}
+			}
+
+			first, last := loan.Schedule[2], loan.Schedule[len(loan.Schedule)-1]
+			if first.Amount != tt.expectedFirst || last.Amount != tt.expectedLast {
+				t.Errorf("expected installments %d..%d, got %d..%d", tt.expectedFirst, tt.expectedLast, first.Amount, last.Amount)
+			}
+			if !first.DueDate.Equal(tt.expectedNextDue) {
+				t.Errorf("expected next due date %v, got %v", tt.expectedNextDue, first.DueDate)
+			}
+			if !last.DueDate.Equal(tt.expectedNextDue.AddDate(0, 0, 7*(tt.expectedWeeks-1))) {
+				t.Errorf("unexpected maturity date %v", last.DueDate)
+			}
+			if loan.WeeklyDue != tt.expectedFirst {
+				t.Errorf("expected weekly due %d, got %d", tt.expectedFirst, loan.WeeklyDue)
+			}
+
+			// Restructuring never changes the amount still to be repaid
+			if loan.Outstanding != 5_280_000 || restructure.After.Outstanding != 5_280_000 {
+				t.Errorf("expected outstanding 5280000, got %d", loan.Outstanding)
+			}
+			if restructure.Before.RemainingWeeks != 48 || restructure.Before.InstallmentAmount != 110_000 {
+				t.Errorf("unexpected before terms %+v", restructure.Before)
+			}
+			if restructure.After.RemainingWeeks != tt.expectedWeeks || !restructure.After.NextDueDate.Equal(tt.expectedNextDue) {
+				t.Errorf("unexpected after terms %+v", restructure.After)
+			}
+			if len(loan.Restructures) != 1 {
+				t.Errorf("expected 1 restructure record, got %d", len(loan.Restructures))
+			}
+		})
+	}
+}
+
+func TestLoanRestructureErrors(t *testing.T) {
+	now := time.Date(2025, 8, 20, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		setup    func(loan *Loan)
+		opts     RestructureOptions
+		expected error
+	}{
+		{name: "no changes", opts: RestructureOptions{}, expected: ErrInvalidRestructure},
+		{name: "negative holiday", opts: RestructureOptions{HolidayWeeks: -1}, expected: ErrInvalidRestructure},
+		{name: "extend and amount", opts: RestructureOptions{ExtendWeeks: 4, InstallmentAmount: 100_000}, expected: ErrInvalidRestructure},
+		{name: "schedule too long", opts: RestructureOptions{InstallmentAmount: 1_000}, expected: ErrInvalidRestructure},
+		{
+			name:     "written off",
+			setup:    func(loan *Loan) { _ = loan.WriteOff(now) },
+			opts:     RestructureOptions{ExtendWeeks: 4},
+			expected: ErrLoanWrittenOff,
+		},
+		{
+			name: "fully paid",
+			setup: func(loan *Loan) {
+				for i := range loan.Schedule {
+					loan.Schedule[i].Paid = true
+				}
+			},
+			opts:     RestructureOptions{ExtendWeeks: 4},
+			expected: ErrAlreadyPaid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan := newPaidLoan(t, 2)
+			if tt.setup != nil {
+				tt.setup(loan)
+			}
+			if _, err := loan.Restructure(tt.opts, now); err != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestRestructuredLoanDelinquency(t *testing.T) {
+	loan := newPaidLoan(t, 2)
+
+	// Weeks 3 and 4 fall due on 2025-08-22 and 2025-08-29
+	checkAt := time.Date(2025, 9, 4, 0, 0, 0, 0, time.UTC)
+	if delinquent, _, _ := loan.IsDelinquent(checkAt); !delinquent {
+		t.Fatal("expected loan to be delinquent before restructuring")
+	}
+
+	if _, err := loan.Restructure(RestructureOptions{HolidayWeeks: 2}, time.Date(2025, 8, 20, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("restructure failed: %v", err)
+	}
+	if delinquent, _, _ := loan.IsDelinquent(checkAt); delinquent {
+		t.Error("expected payment holiday to suspend delinquency")
+	}
+	if dpd := loan.DaysPastDue(checkAt); dpd != 0 {
+		t.Errorf("expected 0 days past due during holiday, got %d", dpd)
+	}
+
+	// Interest is still recognised in full by the new maturity date
+	maturity := loan.Schedule[len(loan.Schedule)-1].DueDate
+	for _, method := range []AccrualMethod{AccrualStraightLine, AccrualEffectiveInterest} {
+		if got := loan.RecognizedInterestThrough(maturity, method); got != 500_000 {
+			t.Errorf("%s: expected 500000 recognised by maturity, got %d", method, got)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// sqlitePragmas are the connection settings the driver applies to every
+// connection it opens:
+//   - WAL journaling lets readers carry on while a writer commits
+//   - busy_timeout makes a writer wait up to 5s for the lock instead of
+//     failing at once with "database is locked"
+//   - foreign_keys enforces the schema's REFERENCES clauses, which SQLite
+//     otherwise ignores
+//   - synchronous=FULL syncs the WAL on every commit, so an acknowledged
+//     payment survives a power cut
+//   - txlock=immediate takes the write lock when a transaction begins, so one
+//     that reads before it writes never fails to upgrade its lock halfway
+var sqlitePragmas = url.Values{
+	"_journal_mode": {"WAL"},
+	"_busy_timeout": {"5000"},
+	"_foreign_keys": {"on"},
+	"_synchronous":  {"FULL"},
+	"_txlock":       {"immediate"},
+}
+
+// sqliteMaxOpenConns bounds the SQLite pool. Only one connection writes at a
+// time; a few more keep reads going alongside it, and further writers wait in
+// the pool rather than polling the database lock.
+const sqliteMaxOpenConns = 4
+
+// openSQLite opens the SQLite database at dsn, a file path or "file:" URI,
+// with sqlitePragmas. Settings already given in dsn take precedence. An
+// in-memory database belongs to the connection that created it, so its pool
+// is limited to that one connection.
+func openSQLite(dsn string) (*sql.DB, error) {
+	path, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SQLite DSN %q: %w", dsn, err)
+	}
+	for key, value := range sqlitePragmas {
+		if _, ok := params[key]; !ok {
+			params[key] = value
+		}
+	}
+
+	db, err := sql.Open("sqlite3", path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if path == "" || strings.Contains(path, ":memory:") || params.Get("mode") == "memory" {
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxOpenConns(sqliteMaxOpenConns)
+	}
+	db.SetMaxIdleConns(sqliteMaxOpenConns)
+	return db, nil
+}
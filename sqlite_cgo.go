@@ -0,0 +1,28 @@
+//go:build cgo
+
+package main
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteSupported reports whether this build can open SQLite databases; the
+// driver needs cgo
+const sqliteSupported = true
+
+// sqliteInsertError maps a constraint violation on inserting a loan to the
+// repository error for it, or returns nil for any other error
+func sqliteInsertError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintPrimaryKey:
+			return ErrLoanExists
+		case sqlite3.ErrConstraintUnique:
+			return ErrExternalIDExists
+		}
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !cgo
+
+package main
+
+// sqliteSupported reports whether this build can open SQLite databases; the
+// driver needs cgo, so without it only the postgres and memory backends work
+const sqliteSupported = false
+
+// sqliteInsertError never matches, as no SQLite error can occur without cgo
+func sqliteInsertError(err error) error {
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pinjol.db")
+	tests := []struct {
+		name        string
+		dsn         string
+		journalMode string
+		synchronous int // 1 is NORMAL, 2 is FULL
+		maxConns    int
+	}{
+		{"file", path, "wal", 2, sqliteMaxOpenConns},
+		{"file URI overriding a setting", "file:" + path + "?_synchronous=NORMAL", "wal", 1, sqliteMaxOpenConns},
+		{"in memory", ":memory:", "memory", 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireSQLite(t)
+			db, err := openSQLite(tt.dsn)
+			if err != nil {
+				t.Fatalf("Failed to open database: %v", err)
+			}
+			defer db.Close()
+
+			var journalMode string
+			var synchronous, foreignKeys, busyTimeout int
+			for pragma, dst := range map[string]any{
+				"journal_mode": &journalMode,
+				"synchronous":  &synchronous,
+				"foreign_keys": &foreignKeys,
+				"busy_timeout": &busyTimeout,
+			} {
+				if err := db.QueryRow("PRAGMA " + pragma).Scan(dst); err != nil {
+					t.Fatalf("Failed to read %s: %v", pragma, err)
+				}
+			}
+			if journalMode != tt.journalMode || synchronous != tt.synchronous || foreignKeys != 1 || busyTimeout != 5000 {
+				t.Errorf("Unexpected pragmas: journal_mode %s, synchronous %d, foreign_keys %d, busy_timeout %d",
+					journalMode, synchronous, foreignKeys, busyTimeout)
+			}
+			if got := db.Stats().MaxOpenConnections; got != tt.maxConns {
+				t.Errorf("Expected at most %d connections, got %d", tt.maxConns, got)
+			}
+		})
+	}
+
+	// The schema's foreign keys are enforced
+	requireSQLite(t)
+	db, err := openSQLite(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := InitDatabase(db); err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO loan_schedule (loan_id, week_index, amount, paid, deferred) VALUES ('missing-loan', 0, 1, 0, 0)`)
+	if err == nil {
+		t.Error("Expected a schedule row without its loan to be rejected")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sqliteTimeLayout is the one format SQLite stores timestamps in: RFC 3339 in
+// UTC with a fixed nine-digit fraction. It keeps every instant exactly, and as
+// all values have the same width and zone, comparing the text compares the
+// times, so range queries and ORDER BY work on the stored column.
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// sqliteLegacyTimeLayouts are the formats the driver wrote and parsed before
+// timestamps were canonical, copied from sqlite3.SQLiteTimestampFormats so
+// that builds without cgo can read them too
+var sqliteLegacyTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// sqliteTime formats t for storage
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// sqliteNullTime formats t for storage, or stores NULL when t is nil
+func sqliteNullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return sqliteTime(*t)
+}
+
+// parseSQLiteTime reads a stored timestamp into UTC, or nil for NULL. Besides
+// the canonical layout it accepts the formats the driver wrote before
+// timestamps were canonical, and the time.Time the driver itself parses out of
+// DATETIME columns.
+func parseSQLiteTime(value any) (*time.Time, error) {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case time.Time:
+		t := v.UTC()
+		return &t, nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return nil, fmt.Errorf("unsupported timestamp type %T", value)
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		t = t.UTC()
+		return &t, nil
+	}
+	for _, layout := range sqliteLegacyTimeLayouts {
+		if t, err := time.ParseInLocation(layout, strings.TrimSuffix(s, "Z"), time.UTC); err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid timestamp %q", s)
+}
+
+// sqliteTimeScanner scans a stored timestamp into a time.Time
+type sqliteTimeScanner struct {
+	dst *time.Time
+}
+
+// scanSQLiteTime returns a scan destination that reads a NOT NULL timestamp into dst
+func scanSQLiteTime(dst *time.Time) sqliteTimeScanner {
+	return sqliteTimeScanner{dst: dst}
+}
+
+func (s sqliteTimeScanner) Scan(value any) error {
+	t, err := parseSQLiteTime(value)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return fmt.Errorf("unexpected NULL timestamp")
+	}
+	*s.dst = *t
+	return nil
+}
+
+// sqliteNullTimeScanner scans a nullable stored timestamp into a *time.Time
+type sqliteNullTimeScanner struct {
+	dst **time.Time
+}
+
+// scanSQLiteNullTime returns a scan destination that reads a nullable timestamp into dst
+func scanSQLiteNullTime(dst **time.Time) sqliteNullTimeScanner {
+	return sqliteNullTimeScanner{dst: dst}
+}
+
+func (s sqliteNullTimeScanner) Scan(value any) error {
+	t, err := parseSQLiteTime(value)
+	if err != nil {
+		return err
+	}
+	*s.dst = t
+	return nil
+}
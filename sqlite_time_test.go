@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSQLiteTimeRoundTrip(t *testing.T) {
+	var instants []time.Time
+	for _, name := range []string{"UTC", "Asia/Jakarta", "America/New_York", "Australia/Lord_Howe", "Asia/Kathmandu"} {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatalf("Failed to load time zone %s: %v", name, err)
+		}
+		instants = append(instants,
+			time.Date(2025, 1, 1, 0, 0, 0, 0, loc),
+			time.Date(2025, 3, 9, 2, 30, 0, 1, loc), // around New York's DST change
+			time.Date(2025, 12, 31, 23, 59, 59, 999999999, loc),
+		)
+	}
+
+	for _, instant := range instants {
+		stored := sqliteTime(instant)
+		if len(stored) != len(sqliteTimeLayout)-len("Z07:00")+1 {
+			t.Errorf("Expected fixed-width timestamp, got %q", stored)
+		}
+		got, err := parseSQLiteTime(stored)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", stored, err)
+		}
+		if !got.Equal(instant) || got.Location() != time.UTC {
+			t.Errorf("Expected %v to round-trip, got %v", instant, got)
+		}
+	}
+
+	// Comparing the stored text compares the instants
+	sorted := make([]string, len(instants))
+	for i, instant := range instants {
+		sorted[i] = sqliteTime(instant)
+	}
+	sort.Strings(sorted)
+	sort.Slice(instants, func(i, j int) bool { return instants[i].Before(instants[j]) })
+	for i, instant := range instants {
+		if sorted[i] != sqliteTime(instant) {
+			t.Errorf("Position %d: expected %s, got %s", i, sqliteTime(instant), sorted[i])
+		}
+	}
+}
+
+func TestParseSQLiteTimeLegacy(t *testing.T) {
+	want := time.Date(2025, 9, 1, 1, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value any
+	}{
+		{"driver format with offset", "2025-09-01 08:30:00+07:00"},
+		{"driver format with fraction", "2025-09-01 01:30:00.000000000+00:00"},
+		{"CURRENT_TIMESTAMP", "2025-09-01 01:30:00"},
+		{"RFC 3339", "2025-08-31T21:30:00-04:00"},
+		{"canonical", []byte("2025-09-01T01:30:00.000000000Z")},
+		{"parsed by the driver", want.In(time.FixedZone("WIB", 7*60*60))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSQLiteTime(tt.value)
+			if err != nil {
+				t.Fatalf("Failed to parse %v: %v", tt.value, err)
+			}
+			if !got.Equal(want) {
+				t.Errorf("Expected %v, got %v", want, got)
+			}
+		})
+	}
+
+	if got, err := parseSQLiteTime(nil); got != nil || err != nil {
+		t.Errorf("Expected NULL to parse as nil, got %v, %v", got, err)
+	}
+	if _, err := parseSQLiteTime("next tuesday"); err == nil {
+		t.Error("Expected an invalid timestamp to be rejected")
+	}
+	var dst time.Time
+	if err := scanSQLiteTime(&dst).Scan(nil); err == nil {
+		t.Error("Expected NULL to be rejected for a NOT NULL timestamp")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// FieldError describes why one field of a request was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// invalidFields reports field errors as an invalid request, listing them
+// under details.fields
+func invalidFields(fields ...FieldError) *APIError {
+	return &APIError{
+		Status:  http.StatusBadRequest,
+		Code:    CodeInvalidRequest,
+		Message: ErrInvalidRequest.Error(),
+		Details: map[string]any{"fields": fields},
+		Err:     ErrInvalidRequest,
+	}
+}
+
+// bindRequest decodes the JSON body into req, rejecting unknown fields and
+// values of the wrong type, and then checks the validate tags of req. An empty
+// body decodes as an empty object.
+func bindRequest(c echo.Context, req any) error {
+	dec := json.NewDecoder(c.Request().Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil && !errors.Is(err, io.EOF) {
+		return decodeError(err)
+	}
+	return validateRequest(req)
+}
+
+// decodeError turns a JSON decoding error into a field error
+func decodeError(err error) *APIError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return invalidFields(FieldError{Field: typeErr.Field, Rule: "type", Message: "must be " + jsonTypeName(typeErr.Type)})
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return invalidFields(FieldError{Field: strings.Trim(field, `"`), Rule: "unknown", Message: "is not a known field"})
+	}
+	return invalidFields(FieldError{Field: "body", Rule: "json", Message: "must be a JSON object"})
+}
+
+// jsonTypeName describes the JSON value expected for a Go type
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Slice:
+		return "an array"
+	}
+	return "an object"
+}
+
+// validateRequest checks every field of the struct pointed to by req against
+// the rules in its validate tag, a comma-separated list of:
+//
+//	required    the field must not be empty or zero
+//	min=N       numbers must be at least N
+//	max=N       numbers must be at most N, strings at most N characters long
+//	date        a YYYY-MM-DD date
+//	datetime    a YYYY-MM-DD date or an RFC 3339 timestamp
+//	timezone    an IANA time zone name
+//	duration    a Go duration such as "24h"
+//	id          a loan ID: letters, digits, "_" and "-"
+//
+// Rules other than required are skipped for empty fields.
+func validateRequest(req any) error {
+	v := reflect.ValueOf(req).Elem()
+	t := v.Type()
+
+	var fields []FieldError
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if fieldErr, ok := checkField(name, v.Field(i), strings.Split(tag, ",")); !ok {
+			fields = append(fields, fieldErr)
+		}
+	}
+
+	if len(fields) > 0 {
+		return invalidFields(fields...)
+	}
+	return nil
+}
+
+// checkField applies rules to one field and reports the first rule it breaks
+func checkField(name string, value reflect.Value, rules []string) (FieldError, bool) {
+	fail := func(rule, message string) (FieldError, bool) {
+		return FieldError{Field: name, Rule: rule, Message: message}, false
+	}
+
+	if value.IsZero() || (value.Kind() == reflect.Slice && value.Len() == 0) {
+		for _, rule := range rules {
+			if rule == "required" {
+				return fail(rule, "is required")
+			}
+		}
+		return FieldError{}, true
+	}
+
+	for _, rule := range rules {
+		rule, arg, _ := strings.Cut(rule, "=")
+		switch rule {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic(fmt.Sprintf("invalid %s rule on %s: %q", rule, name, arg))
+			}
+			var n float64
+			switch value.Kind() {
+			case reflect.Int, reflect.Int64:
+				n = float64(value.Int())
+			case reflect.Float64:
+				n = value.Float()
+			case reflect.String:
+				n = float64(len(value.String()))
+				if rule == "max" && n > limit {
+					return fail(rule, fmt.Sprintf("must be at most %s characters", arg))
+				}
+				continue
+			}
+			if rule == "min" && n < limit {
+				return fail(rule, "must be at least "+arg)
+			}
+			if rule == "max" && n > limit {
+				return fail(rule, "must be at most "+arg)
+			}
+		case "date":
+			if _, err := time.Parse("2006-01-02", value.String()); err != nil {
+				return fail(rule, "must be a date in YYYY-MM-DD format")
+			}
+		case "datetime":
+			if _, err := parseClockTime(value.String()); err != nil {
+				return fail(rule, "must be a YYYY-MM-DD date or an RFC 3339 timestamp")
+			}
+		case "timezone":
+			if _, err := time.LoadLocation(value.String()); err != nil {
+				return fail(rule, "must be an IANA time zone name")
+			}
+		case "duration":
+			if _, err := time.ParseDuration(value.String()); err != nil {
+				return fail(rule, "must be a duration such as 24h")
+			}
+		case "id":
+			if !loanIDPattern.MatchString(value.String()) {
+				return fail(rule, "must be up to 64 letters, digits, _ or -")
+			}
+		}
+	}
+	return FieldError{}, true
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// bindBody binds body into req as a handler would and returns the field errors
+func bindBody(t *testing.T, body string, req any) []FieldError {
+	t.Helper()
+
+	e := echo.New()
+	httpReq := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	httpReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c := e.NewContext(httpReq, httptest.NewRecorder())
+
+	err := bindRequest(c, req)
+	if err == nil {
+		return nil
+	}
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.Status != http.StatusBadRequest || apiErr.Code != CodeInvalidRequest {
+		t.Fatalf("expected an invalid request error, got %v", err)
+	}
+	return apiErr.Details["fields"].([]FieldError)
+}
+
+func TestBindCreateLoanRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected []FieldError
+	}{
+		{
+			name: "valid",
+			body: `{"principal": 5000000, "annual_rate": 0.10, "start_date": "2025-08-01", "timezone": "Asia/Jakarta"}`,
+		},
+		{
+			name: "rate above 100%",
+			body: `{"principal": 5000000, "annual_rate": 1.5, "start_date": "2025-08-01"}`,
+		},
+		{
+			name:     "empty body",
+			body:     ``,
+			expected: []FieldError{{"principal", "required", "is required"}, {"start_date", "required", "is required"}},
+		},
+		{
+			name:     "unknown field",
+			body:     `{"principal": 5000000, "start_date": "2025-08-01", "principle": 5000000}`,
+			expected: []FieldError{{"principle", "unknown", "is not a known field"}},
+		},
+		{
+			name:     "wrong type",
+			body:     `{"principal": "5000000", "start_date": "2025-08-01"}`,
+			expected: []FieldError{{"principal", "type", "must be a number"}},
+		},
+		{
+			name:     "not JSON",
+			body:     `principal=5000000`,
+			expected: []FieldError{{"body", "json", "must be a JSON object"}},
+		},
+		{
+			name: "every field invalid",
+			body: `{"id": "a/b", "external_id": "` + strings.Repeat("x", 65) + `", "principal": -1, "annual_rate": -0.1, "start_date": "01/08/2025", "timezone": "Mars/Olympus_Mons"}`,
+			expected: []FieldError{
+				{"id", "id", "must be up to 64 letters, digits, _ or -"},
+				{"external_id", "max", "must be at most 64 characters"},
+				{"principal", "min", "must be at least 1"},
+				{"annual_rate", "min", "must be at least 0"},
+				{"start_date", "date", "must be a date in YYYY-MM-DD format"},
+				{"timezone", "timezone", "must be an IANA time zone name"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req CreateLoanRequest
+			fields := bindBody(t, tt.body, &req)
+			if !reflect.DeepEqual(fields, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, fields)
+			}
+		})
+	}
+}
+
+func TestBindPaymentRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected []FieldError
+	}{
+		{"valid", `{"amount": 110000}`, nil},
+		{"valid with value date", `{"amount": 110000, "paid_at": "2025-08-14T10:00:00+07:00"}`, nil},
+		{"missing amount", `{}`, []FieldError{{"amount", "required", "is required"}}},
+		{"negative amount", `{"amount": -110000}`, []FieldError{{"amount", "min", "must be at least 1"}}},
+		{"bad value date", `{"amount": 110000, "paid_at": "yesterday"}`, []FieldError{{"paid_at", "datetime", "must be a YYYY-MM-DD date or an RFC 3339 timestamp"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req PaymentRequest
+			fields := bindBody(t, tt.body, &req)
+			if !reflect.DeepEqual(fields, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Recovery is money collected on a loan after it was written off
+type Recovery struct {
+	ID         int64     `json:"id"`
+	Amount     int64     `json:"amount"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// DaysPastDue returns how many days the oldest week unpaid at now is overdue
+func (l *Loan) DaysPastDue(now time.Time) int {
+	for _, week := range l.Schedule {
+		if week.paidBy(now) {
+			continue
+		}
+		if now.Before(week.DueDate) {
+			return 0
+		}
+		return daysBetween(week.DueDate, now)
+	}
+	return 0
+}
+
+// UnpaidPrincipal returns the principal portion of all unpaid weeks
+func (l *Loan) UnpaidPrincipal() int64 {
+	unpaid := int64(0)
+	for i, week := range l.Schedule {
+		if !week.Paid {
+			principal, _ := l.InstallmentSplit(i + 1)
+			unpaid += principal
+		}
+	}
+	return unpaid
+}
+
+// WriteOff moves the outstanding balance to the written-off state
+func (l *Loan) WriteOff(now time.Time) error {
+	if l.Status == LoanStatusWrittenOff {
+		return ErrLoanWrittenOff
+	}
+	outstanding := l.GetOutstanding()
+	if outstanding == 0 {
+		return ErrAlreadyPaid
+	}
+
+	l.Status = LoanStatusWrittenOff
+	l.WrittenOffAt = &now
+	l.WrittenOffAmount = outstanding
+	return nil
+}
+
+// RecoveredAmount returns the total collected after write-off
+func (l *Loan) RecoveredAmount() int64 {
+	recovered := int64(0)
+	for _, recovery := range l.Recoveries {
+		recovered += recovery.Amount
+	}
+	return recovered
+}
+
+// RecordRecovery registers a recovery payment on a written-off loan.
+// Recoveries are tracked separately from installments and never settle weeks.
+func (l *Loan) RecordRecovery(amount int64, now time.Time) (*Recovery, error) {
+	if l.Status != LoanStatusWrittenOff {
+		return nil, ErrLoanNotWrittenOff
+	}
+	if amount <= 0 {
+		return nil, ErrInvalidRequest
+	}
+	if l.RecoveredAmount()+amount > l.WrittenOffAmount {
+		return nil, ErrRecoveryExceedsBalance
+	}
+
+	l.Recoveries = append(l.Recoveries, Recovery{Amount: amount, ReceivedAt: now})
+	return &l.Recoveries[len(l.Recoveries)-1], nil
+}
+
+// WriteOffEntry derecognises the unpaid principal and any accrued but
+// uncollected interest of a written-off loan against the write-off expense
+func WriteOffEntry(loan *Loan, accruedInterest int64, chart ChartOfAccounts) *JournalEntry {
+	principal := loan.UnpaidPrincipal()
+	interest := accruedInterest - loan.CollectedInterest()
+	if interest < 0 {
+		interest = 0
+	}
+
+	lines := []JournalLine{
+		{Account: chart.WriteOffExpense, Debit: principal + interest},
+		{Account: chart.LoanReceivable, Credit: principal},
+	}
+	if interest > 0 {
+		lines = append(lines, JournalLine{Account: chart.InterestReceivable, Credit: interest})
+	}
+
+	return &JournalEntry{
+		ID:       fmt.Sprintf("je_%s_write_off", loan.ID),
+		LoanID:   loan.ID,
+		Event:    JournalEventWriteOff,
+		PostedAt: *loan.WrittenOffAt,
+		Lines:    lines,
+	}
+}
+
+// RecoveryEntry books cash recovered on a written-off loan as recovery income
+func RecoveryEntry(loan *Loan, sequence int, recovery *Recovery, chart ChartOfAccounts) *JournalEntry {
+	return &JournalEntry{
+		ID:       fmt.Sprintf("je_%s_recovery_%d", loan.ID, sequence),
+		LoanID:   loan.ID,
+		Event:    JournalEventRecovery,
+		PostedAt: recovery.ReceivedAt,
+		Lines: []JournalLine{
+			{Account: chart.Cash, Debit: recovery.Amount},
+			{Account: chart.RecoveryIncome, Credit: recovery.Amount},
+		},
+	}
+}
+
+// writeOffLoan writes the loan off, persists it and books the write-off in one
+// unit of work, so the loan is never written off without the loss booked
+func writeOffLoan(ctx context.Context, repo LoanRepository, chart ChartOfAccounts, loan *Loan, now time.Time) error {
+	if err := loan.WriteOff(now); err != nil {
+		return err
+	}
+
+	return repo.WithTx(ctx, func(tx LoanRepository) error {
+		accruals, err := tx.ListAccruals(ctx, loan.ID)
+		if err != nil {
+			return err
+		}
+		accrued := SummarizeInterest(loan, accruals).AccruedInterest
+
+		if err := tx.Update(ctx, loan); err != nil {
+			return err
+		}
+		return tx.PostJournalEntry(ctx, WriteOffEntry(loan, accrued, chart))
+	})
+}
+
+// WriteOffRunResult summarises one run of the automatic write-off rule
+type WriteOffRunResult struct {
+	LoansProcessed  int      `json:"loans_processed"`
+	WrittenOff      []string `json:"written_off"`
+	WrittenOffTotal int64    `json:"written_off_total"`
+}
+
+// RunAutoWriteOff writes off every active loan whose oldest unpaid week is at
+// least thresholdDays past due
+func RunAutoWriteOff(ctx context.Context, repo LoanRepository, chart ChartOfAccounts, thresholdDays int, now time.Time) (WriteOffRunResult, error) {
+	result := WriteOffRunResult{WrittenOff: []string{}}
+
+	loans, err := repo.List(ctx, LoanFilter{})
+	if err != nil {
+		return result, err
+	}
+
+	for _, summary := range loans {
+		result.LoansProcessed++
+		if summary.Status != LoanStatusActive {
+			continue
+		}
+
+		loan, err := repo.GetByID(ctx, summary.ID)
+		if err != nil {
+			return result, err
+		}
+		if loan.DaysPastDue(now) < thresholdDays {
+			continue
+		}
+
+		if err := writeOffLoan(ctx, repo, chart, loan, now); err != nil {
+			return result, fmt.Errorf("failed to write off loan %s: %w", loan.ID, err)
+		}
+		result.WrittenOff = append(result.WrittenOff, loan.ID)
+		result.WrittenOffTotal += loan.WrittenOffAmount
+	}
+
+	return result, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLoanDaysPastDue(t *testing.T) {
+	startDate := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	loan, err := NewLoan("test", 5_000_000, 0.10, startDate)
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		paid     int
+		expected int
+	}{
+		{name: "before first due date", now: startDate.AddDate(0, 0, 6), expected: 0},
+		{name: "on first due date", now: startDate.AddDate(0, 0, 7), expected: 0},
+		{name: "ten days after first due date", now: startDate.AddDate(0, 0, 17), expected: 10},
+		{name: "first week paid", now: startDate.AddDate(0, 0, 17), paid: 1, expected: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range loan.Schedule {
+				loan.Schedule[i].Paid = i < tt.paid
+			}
+			if got := loan.DaysPastDue(tt.now); got != tt.expected {
+				t.Errorf("expected %d days past due, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoanWriteOffAndRecovery(t *testing.T) {
+	startDate := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	loan, err := NewLoan("test", 5_000_000, 0.10, startDate)
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+	if _, err := loan.RecordRecovery(100_000, startDate); err != ErrLoanNotWrittenOff {
+		t.Errorf("expected ErrLoanNotWrittenOff, got %v", err)
+	}
+	if err := loan.MakePayment(110_000, startDate); err != nil {
+		t.Fatalf("payment failed: %v", err)
+	}
+
+	now := startDate.AddDate(0, 4, 0)
+	if err := loan.WriteOff(now); err != nil {
+		t.Fatalf("write-off failed: %v", err)
+	}
+	if loan.Status != LoanStatusWrittenOff || loan.WrittenOffAmount != 5_390_000 {
+		t.Errorf("unexpected loan state: status %s, written off %d", loan.Status, loan.WrittenOffAmount)
+	}
+	if err := loan.WriteOff(now); err != ErrLoanWrittenOff {
+		t.Errorf("expected ErrLoanWrittenOff on second write-off, got %v", err)
+	}
+	if err := loan.MakePayment(110_000, startDate); err != ErrLoanWrittenOff {
+		t.Errorf("expected ErrLoanWrittenOff on payment, got %v", err)
+	}
+	if delinquent, _, _ := loan.IsDelinquent(now); delinquent {
+		t.Error("written-off loan should not be reported as delinquent")
+	}
+
+	if _, err := loan.RecordRecovery(0, now); err != ErrInvalidRequest {
+		t.Errorf("expected ErrInvalidRequest, got %v", err)
+	}
+	if _, err := loan.RecordRecovery(5_000_000, now); err != nil {
+		t.Fatalf("recovery failed: %v", err)
+	}
+	if _, err := loan.RecordRecovery(390_001, now); err != ErrRecoveryExceedsBalance {
+		t.Errorf("expected ErrRecoveryExceedsBalance, got %v", err)
+	}
+	if loan.RecoveredAmount() != 5_000_000 {
+		t.Errorf("expected 5000000 recovered, got %d", loan.RecoveredAmount())
+	}
+	// Recoveries never settle scheduled weeks
+	if loan.GetOutstanding() != 5_390_000 {
+		t.Errorf("expected outstanding to stay 5390000, got %d", loan.GetOutstanding())
+	}
+}
+
+func TestWriteOffEntry(t *testing.T) {
+	chart := DefaultChartOfAccounts()
+	startDate := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	loan, err := NewLoan("test", 5_000_000, 0.10, startDate)
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+	if err := loan.MakePayment(110_000, startDate); err != nil {
+		t.Fatalf("payment failed: %v", err)
+	}
+	if err := loan.WriteOff(startDate.AddDate(0, 4, 0)); err != nil {
+		t.Fatalf("write-off failed: %v", err)
+	}
+
+	// 30_000 accrued, 10_000 collected with the first installment
+	entry := WriteOffEntry(loan, 30_000, chart)
+	if err := entry.Validate(); err != nil {
+		t.Fatalf("write-off entry is unbalanced: %v", err)
+	}
+	expected := []JournalLine{
+		{Account: chart.WriteOffExpense, Debit: 4_920_000},
+		{Account: chart.LoanReceivable, Credit: 4_900_000},
+		{Account: chart.InterestReceivable, Credit: 20_000},
+	}
+	if len(entry.Lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d", len(expected), len(entry.Lines))
+	}
+	for i := range expected {
+		if entry.Lines[i] != expected[i] {
+			t.Errorf("line %d: expected %+v, got %+v", i, expected[i], entry.Lines[i])
+		}
+	}
+}
+
+func TestRunAutoWriteOff(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewSQLiteLoanRepository(db)
+	chart := DefaultChartOfAccounts()
+
+	startDate := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	overdue, err := NewLoan("overdue-loan", 5_000_000, 0.10, startDate)
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+	current, err := NewLoan("current-loan", 5_000_000, 0.10, startDate.AddDate(0, 2, 0))
+	if err != nil {
+		t.Fatalf("failed to create loan: %v", err)
+	}
+	for _, loan := range []*Loan{overdue, current} {
+		if err := repo.Create(context.Background(), loan); err != nil {
+			t.Fatalf("failed to store loan: %v", err)
+		}
+	}
+
+	// The overdue loan's first week fell due on 2025-08-08
+	now := time.Date(2025, 11, 6, 0, 0, 0, 0, time.UTC)
+	result, err := RunAutoWriteOff(context.Background(), repo, chart, 90, now)
+	if err != nil {
+		t.Fatalf("write-off run failed: %v", err)
+	}
+	if result.LoansProcessed != 2 || len(result.WrittenOff) != 1 || result.WrittenOff[0] != overdue.ID {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if result.WrittenOffTotal != 5_500_000 {
+		t.Errorf("expected 5500000 written off, got %d", result.WrittenOffTotal)
+	}
+
+	stored, err := repo.GetByID(context.Background(), overdue.ID)
+	if err != nil {
+		t.Fatalf("failed to load loan: %v", err)
+	}
+	if stored.Status != LoanStatusWrittenOff || stored.WrittenOffAt == nil || !stored.WrittenOffAt.Equal(now) {
+		t.Errorf("unexpected stored loan: status %s, written off at %v", stored.Status, stored.WrittenOffAt)
+	}
+
+	// Written-off loans are skipped on later runs
+	result, err = RunAutoWriteOff(context.Background(), repo, chart, 90, now.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("second write-off run failed: %v", err)
+	}
+	if len(result.WrittenOff) != 0 {
+		t.Errorf("expected nothing written off on re-run, got %v", result.WrittenOff)
+	}
+
+	// No interest accrues from the write-off date onwards
+	accruals := stored.AccrueInterest(0, nil, now.AddDate(0, 1, 0), AccrualStraightLine)
+	last := accruals[len(accruals)-1].Date
+	if !last.Before(now) {
+		t.Errorf("expected accruals to stop before %v, last accrual on %v", now, last)
+	}
+}